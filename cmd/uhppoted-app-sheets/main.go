@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/uhppoted/uhppote-core/uhppote"
 	"github.com/uhppoted/uhppoted-app-sheets/commands"
@@ -14,11 +18,22 @@ import (
 
 var cli = []uhppoted.Command{
 	&commands.AuthoriseCmd,
+	&commands.TokensCmd,
+	&commands.CheckAuthCmd,
 	&commands.GetCmd,
 	&commands.PutCmd,
 	&commands.LoadACLCmd,
+	&commands.RunCmd,
+	&commands.RollbackCmd,
 	&commands.CompareACLCmd,
 	&commands.UploadACLCmd,
+	&commands.GetEventsCmd,
+	&commands.SetTimeProfilesCmd,
+	&commands.SetHolidaysCmd,
+	&commands.LoadDoorsCmd,
+	&commands.UploadDoorsCmd,
+	&commands.StatusCmd,
+	&commands.SetTimeCmd,
 	&uhppoted.Version{
 		Application: commands.APP,
 		Version:     uhppote.VERSION,
@@ -30,11 +45,14 @@ var options = commands.Options{
 	Debug:  false,
 }
 
+var timeout time.Duration
+
 var help = uhppoted.NewHelp("uhppoted-app-sheets", cli, nil)
 
 func main() {
 	flag.StringVar(&options.Config, "config", options.Config, "uhppoted configuration file path")
 	flag.BoolVar(&options.Debug, "debug", options.Debug, "Enable debugging information")
+	flag.DurationVar(&timeout, "timeout", timeout, "Maximum time allowed for the command (0 for no limit)")
 	flag.Parse()
 
 	cmd, err := uhppoted.Parse(cli, nil, help)
@@ -48,6 +66,25 @@ func main() {
 		os.Exit(1)
 	}
 
+	// ... cancel on SIGINT/SIGTERM (a second signal terminates immediately)
+	interrupted, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-interrupted.Done()
+		stop()
+	}()
+
+	ctx := interrupted
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timeout after %v", timeout))
+		defer cancel()
+	}
+
+	options.Context = ctx
+
 	if err = cmd.Execute(&options); err != nil {
 		log.Fatalf("ERROR: %v", err)
 		os.Exit(1)
@@ -1,13 +1,17 @@
 package commands
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -24,17 +28,36 @@ import (
 )
 
 var AuthoriseCmd = Authorise{
-	command{
+	command: command{
 		workdir:     DEFAULT_WORKDIR,
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
+
+	headless: false,
+	bind:     "",
+	port:     80,
 }
 
 type Authorise struct {
 	command
+	headless bool
+	bind     string
+	port     int
+	stdin    io.Reader // overrides os.Stdin for --headless (for testing)
+}
+
+// OAuth2 configuration and token file for each of the Google Sheets and Google Drive scopes.
+type authorisation struct {
+	sheets     *oauth2.Config
+	drive      *oauth2.Config
+	sheetsFile string
+	driveFile  string
+	key        []byte
 }
 
 func (cmd *Authorise) Name() string {
@@ -55,17 +78,30 @@ func (cmd *Authorise) Help() {
 	fmt.Println()
 	fmt.Println("  Authorises uhppoted-app-sheets access to a Google Sheets spreadsheet")
 	fmt.Println()
+	fmt.Println("  By default the authorisation page is served from a local web server (on port 80) and opened in the browser. On a")
+	fmt.Println("  system without a browser the --headless option prints the Google Sheets and Google Drive authorisation links instead")
+	fmt.Println("  and prompts for the redirect URL (or just the authorisation code) from the browser address bar after authorising")
+	fmt.Println("  access on any other machine.")
+	fmt.Println()
 
 	helpOptions(cmd.FlagSet())
 
 	fmt.Println()
 	fmt.Println("  Examples:")
 	fmt.Println(`    uhppote-app-sheets authorise --credentials "credentials.json" --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
+	fmt.Println(`    uhppote-app-sheets authorise --port 8080 --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
+	fmt.Println(`    uhppote-app-sheets authorise --headless --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
 	fmt.Println()
 }
 
 func (cmd *Authorise) FlagSet() *flag.FlagSet {
-	return cmd.flagset("authorise")
+	flagset := cmd.flagset("authorise")
+
+	flagset.BoolVar(&cmd.headless, "headless", cmd.headless, "Prints the authorisation links and prompts for the redirect URL, without starting a local web server")
+	flagset.StringVar(&cmd.bind, "bind", cmd.bind, "Local web server bind address (defaults to all interfaces)")
+	flagset.IntVar(&cmd.port, "port", cmd.port, "Local web server port (the OAuth2 redirect URL is updated to match)")
+
+	return flagset
 }
 
 func (cmd *Authorise) Execute(args ...any) error {
@@ -87,51 +123,191 @@ func (cmd *Authorise) Execute(args ...any) error {
 		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
 	}
 
+	// ... service account?
+	if b, err := os.ReadFile(cmd.credentials); err != nil {
+		return err
+	} else if isServiceAccount(b) {
+		infof("%v is a service account key - no authorisation required", cmd.credentials)
+		return nil
+	}
+
 	// ... authenticate
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
+	key, err := tokenKey(cmd.tokenKey)
+	if err != nil {
+		return err
 	}
 
-	if err := authenticate(cmd.credentials, tokens); err != nil {
+	auth, err := newAuthorisation(cmd.credentials, cmd.tokenDir())
+	if err != nil {
+		return fmt.Errorf("authorisation error (%v)", err)
+	}
+
+	auth.key = key
+
+	if cmd.headless {
+		stdin := cmd.stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+
+		if err := authenticateHeadless(auth, stdin); err != nil {
+			return fmt.Errorf("authorisation error (%v)", err)
+		}
+
+		return nil
+	}
+
+	if cmd.port < 1 || cmd.port > 65535 {
+		return fmt.Errorf("invalid --port (%v)", cmd.port)
+	}
+
+	if err := authenticate(auth, cmd.bind, cmd.port); err != nil {
 		return fmt.Errorf("authorisation error (%v)", err)
 	}
 
 	return nil
 }
 
-func authenticate(credentials, tokens string) error {
+func newAuthorisation(credentials, tokens string) (*authorisation, error) {
 	_, file := filepath.Split(credentials)
 	basename := strings.TrimSuffix(file, filepath.Ext(file))
 
-	type component struct {
-		URL  string
-		File string
+	auth := authorisation{
+		sheetsFile: filepath.Join(tokens, basename+".sheets"),
+		driveFile:  filepath.Join(tokens, basename+".drive"),
 	}
 
-	// ... get OAuth2 configuration
-	var sheets *oauth2.Config
-	var drive *oauth2.Config
-	var buffer []byte
-
-	if b, err := os.ReadFile(credentials); err != nil {
-		return err
-	} else {
-		buffer = b
+	buffer, err := os.ReadFile(credentials)
+	if err != nil {
+		return nil, err
 	}
 
 	if config, err := google.ConfigFromJSON(buffer, SHEETS); err != nil {
-		return err
+		return nil, err
 	} else {
-		sheets = config
+		auth.sheets = config
 	}
 
 	if config, err := google.ConfigFromJSON(buffer, gdrive.DriveMetadataReadonlyScope); err != nil {
-		return err
+		return nil, err
+	} else {
+		auth.drive = config
+	}
+
+	return &auth, nil
+}
+
+// Updates the redirect URLs for a local web server on a port other than 80. Google accepts any
+// port for the 'localhost' redirect URL of a desktop app.
+func (a *authorisation) redirectTo(port int) error {
+	for _, config := range []*oauth2.Config{a.sheets, a.drive} {
+		u, err := url.Parse(config.RedirectURL)
+		if err != nil {
+			return fmt.Errorf("invalid redirect URL '%v' (%v)", config.RedirectURL, err)
+		}
+
+		if port == 80 {
+			u.Host = u.Hostname()
+		} else {
+			u.Host = net.JoinHostPort(u.Hostname(), fmt.Sprintf("%v", port))
+		}
+
+		config.RedirectURL = u.String()
+	}
+
+	return nil
+}
+
+// Authorises access without a local web server. The user authorises access in a browser on any
+// machine and pastes the redirect URL (which includes the authorisation code) from the browser
+// address bar - the redirect itself fails unless the browser happens to be on the local machine.
+func authenticateHeadless(auth *authorisation, stdin io.Reader) error {
+	reader := bufio.NewReader(stdin)
+
+	steps := []struct {
+		name   string
+		config *oauth2.Config
+		file   string
+	}{
+		{"Google Sheets", auth.sheets, auth.sheetsFile},
+		{"Google Drive", auth.drive, auth.driveFile},
+	}
+
+	for _, step := range steps {
+		fmt.Println()
+		fmt.Printf("   Open the following link in a browser to authorise access to %v:\n", step.name)
+		fmt.Println()
+		fmt.Printf("   %v\n", step.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline))
+		fmt.Println()
+		fmt.Println("   After authorising access the browser is redirected to a (probably unreachable) localhost page. Copy the")
+		fmt.Println("   URL from the browser address bar and paste it below (or just the 'code' parameter):")
+		fmt.Println()
+		fmt.Print("   > ")
+
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || strings.TrimSpace(line) == "") {
+			return fmt.Errorf("no authorisation code for %v", step.name)
+		}
+
+		code, err := authCode(line)
+		if err != nil {
+			return err
+		}
+
+		token, err := step.config.Exchange(context.Background(), code)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve %v token (%v)", step.name, err)
+		}
+
+		saveToken(step.file, token, auth.key)
+	}
+
+	return nil
+}
+
+// Extracts the authorisation code from a pasted redirect URL, or returns the pasted text as is if it
+// is not a URL.
+func authCode(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.Contains(s, "?") {
+		if s == "" {
+			return "", fmt.Errorf("missing authorisation code")
+		}
+
+		return s, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL (%v)", err)
+	}
+
+	query := u.Query()
+	if e := query.Get("error"); e != "" {
+		return "", fmt.Errorf("authorisation refused (%v)", e)
+	} else if query.Get("state") != "state-token" {
+		return "", fmt.Errorf("invalid redirect URL - missing or incorrect 'state' parameter")
+	} else if code := query.Get("code"); code == "" {
+		return "", fmt.Errorf("invalid redirect URL - missing 'code' parameter")
 	} else {
-		drive = config
+		return code, nil
+	}
+}
+
+func authenticate(auth *authorisation, bind string, port int) error {
+	type component struct {
+		URL  string
+		File string
+	}
+
+	if err := auth.redirectTo(port); err != nil {
+		return err
 	}
 
+	sheets := auth.sheets
+	drive := auth.drive
+
 	// ... page template info
 	page := struct {
 		Sheets component
@@ -139,11 +315,11 @@ func authenticate(credentials, tokens string) error {
 	}{
 		Sheets: component{
 			URL:  sheets.AuthCodeURL("state-token", oauth2.AccessTypeOffline),
-			File: filepath.Join(tokens, basename+".sheets"),
+			File: auth.sheetsFile,
 		},
 		Drive: component{
 			URL:  drive.AuthCodeURL("state-token", oauth2.AccessTypeOffline),
-			File: filepath.Join(tokens, basename+".drive"),
+			File: auth.driveFile,
 		},
 	}
 
@@ -151,11 +327,11 @@ func authenticate(credentials, tokens string) error {
 	save := func(scope string, token *oauth2.Token) bool {
 		switch {
 		case strings.HasPrefix(scope, SHEETS):
-			saveToken(page.Sheets.File, token)
+			saveToken(page.Sheets.File, token, auth.key)
 			return true
 
 		case strings.HasPrefix(scope, DRIVE):
-			saveToken(page.Drive.File, token)
+			saveToken(page.Drive.File, token, auth.key)
 			return true
 
 		default:
@@ -246,10 +422,15 @@ func authenticate(credentials, tokens string) error {
 	})
 
 	srv := &http.Server{
-		Addr:    ":80",
+		Addr:    net.JoinHostPort(bind, fmt.Sprintf("%v", port)),
 		Handler: mux,
 	}
 
+	authURL := "http://localhost/auth.html"
+	if port != 80 {
+		authURL = fmt.Sprintf("http://localhost:%v/auth.html", port)
+	}
+
 	go func() {
 		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
 			panic(fmt.Sprintf("ERROR: %v", err))
@@ -262,9 +443,9 @@ func authenticate(credentials, tokens string) error {
 	signal.Notify(interrupt, os.Interrupt)
 
 	// ... open auth.html URL in browser
-	command := exec.Command("open", "http://localhost/auth.html")
+	command := exec.Command("open", authURL)
 	if _, err := command.CombinedOutput(); err != nil {
-		fmt.Println("Could not open authorisation page - please open http://localhost/auth.html in your browser")
+		fmt.Printf("Could not open authorisation page - please open %v in your browser\n", authURL)
 	}
 
 	// ... wait for authorisation
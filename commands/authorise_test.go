@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthoriseHeadless(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	credentials, _ := fake.authorise(t)
+	tokens := filepath.Join(t.TempDir(), ".google")
+
+	redirect := "http://localhost/?state=state-token&code=" + url.QueryEscape(fakeAuthCode) + "&scope=" + url.QueryEscape(SHEETS)
+
+	cmd := Authorise{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+		},
+		headless: true,
+		stdin:    strings.NewReader(redirect + "\n" + fakeAuthCode + "\n"),
+	}
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing 'authorise --headless' (%v)", err)
+	}
+
+	for _, file := range []string{"credentials.sheets", "credentials.drive"} {
+		if token, err := tokenFromFile(filepath.Join(tokens, file), nil); err != nil {
+			t.Errorf("Error reading %v (%v)", file, err)
+		} else if token.AccessToken != fakeAccessToken || token.RefreshToken != "fake-refresh-token" {
+			t.Errorf("Incorrect %v token\n   expected:%v\n   got:     %v", file, fakeAccessToken, token.AccessToken)
+		}
+	}
+}
+
+func TestAuthoriseHeadlessWithInvalidCode(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	credentials, _ := fake.authorise(t)
+	tokens := filepath.Join(t.TempDir(), ".google")
+
+	cmd := Authorise{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+		},
+		headless: true,
+		stdin:    strings.NewReader("4/0AfJohXsome-other-code\n"),
+	}
+
+	if err := cmd.Execute(&Options{}); err == nil {
+		t.Errorf("Expected error executing 'authorise --headless' with invalid authorisation code")
+	}
+
+	if _, err := tokenFromFile(filepath.Join(tokens, "credentials.sheets"), nil); err == nil {
+		t.Errorf("Unexpected Google Sheets token file for invalid authorisation code")
+	}
+}
+
+func TestAuthCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"4/0AfJohX-abcdef\n", "4/0AfJohX-abcdef", true},
+		{"http://localhost/?state=state-token&code=4/0AfJohX-abcdef&scope=https://www.googleapis.com/auth/spreadsheets", "4/0AfJohX-abcdef", true},
+		{"http://localhost/?state=state-token&code=4%2F0AfJohX-abcdef", "4/0AfJohX-abcdef", true},
+		{"http://localhost/?state=some-state&code=4/0AfJohX-abcdef", "", false},
+		{"http://localhost/?state=state-token", "", false},
+		{"http://localhost/?error=access_denied&state=state-token", "", false},
+		{"  \n", "", false},
+	}
+
+	for _, test := range tests {
+		code, err := authCode(test.input)
+
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("Unexpected error extracting authorisation code from '%v' (%v)", test.input, err)
+
+		case !test.valid && err == nil:
+			t.Errorf("Expected error extracting authorisation code from '%v'", test.input)
+
+		case code != test.expected:
+			t.Errorf("Incorrect authorisation code\n   expected:%v\n   got:     %v", test.expected, code)
+		}
+	}
+}
+
+func TestAuthoriseRedirectToPort(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	credentials, tokens := fake.authorise(t)
+
+	auth, err := newAuthorisation(credentials, tokens)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	if err := auth.redirectTo(8080); err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	for _, v := range []string{auth.sheets.RedirectURL, auth.drive.RedirectURL} {
+		if v != "http://localhost:8080" {
+			t.Errorf("Incorrect redirect URL\n   expected:%v\n   got:     %v", "http://localhost:8080", v)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"time"
+)
+
+// Backend is the interface to the spreadsheet store used by the commands. Areas are specified
+// in A1 notation (e.g. 'ACL!A2:K') and rows are zero-based indices relative to the worksheet.
+type Backend interface {
+	// Returns a short identifier for the spreadsheet e.g. the Google Sheets spreadsheet ID.
+	ID() string
+
+	// Returns the values in the area, including the header row.
+	Read(area string) ([][]any, error)
+
+	// Overwrites the areas with the supplied values.
+	Write(data ...valueRange) error
+
+	// Appends the rows after the last row in the area. If overwrite is false the rows are
+	// inserted, otherwise any existing rows below the area are overwritten.
+	Append(area string, rows [][]any, overwrite bool) error
+
+	// Clears the values in the areas.
+	Clear(areas ...string) error
+
+	// Deletes rows from the worksheet for the area. The row ranges are specified relative to
+	// the worksheet before any rows are deleted.
+	DeleteRows(area string, rows ...rowRange) error
+
+	// Returns the number of rows in the worksheet for the area.
+	RowCount(area string) (int64, error)
+
+	// Returns the current spreadsheet revision.
+	Revision() (*revision, error)
+
+	// Returns the spreadsheet time zone.
+	TimeZone() (*time.Location, error)
+
+	// Returns the worksheet names, in spreadsheet order.
+	Sheets() ([]string, error)
+}
+
+type valueRange struct {
+	area   string
+	values [][]any
+}
+
+// Half-open range of worksheet rows. An 'end' of 0 extends the range to the end of the worksheet.
+type rowRange struct {
+	start int64
+	end   int64
+}
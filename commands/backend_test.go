@@ -0,0 +1,433 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// In-memory Backend for testing the worksheet logic without Google Sheets.
+type memory struct {
+	sheets   map[string][][]any
+	revision *revision
+}
+
+type cells struct {
+	sheet  string
+	top    int
+	left   int
+	bottom int
+	right  int
+}
+
+func (m *memory) ID() string {
+	return "memory"
+}
+
+func (m *memory) Read(area string) ([][]any, error) {
+	r, err := m.parse(area)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := m.sheets[r.sheet]
+	rows := [][]any{}
+	for i := r.top; i <= r.bottom && i < len(sheet); i++ {
+		row := []any{}
+		for j := r.left; j <= r.right && j < len(sheet[i]); j++ {
+			row = append(row, sheet[i][j])
+		}
+
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+
+		rows = append(rows, row)
+	}
+
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	return rows, nil
+}
+
+func (m *memory) Write(data ...valueRange) error {
+	for _, v := range data {
+		r, err := m.parse(v.area)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range v.values {
+			for j, value := range row {
+				m.set(r.sheet, r.top+i, r.left+j, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *memory) Append(area string, rows [][]any, overwrite bool) error {
+	r, err := m.parse(area)
+	if err != nil {
+		return err
+	}
+
+	values, _ := m.Read(area)
+	top := r.top + len(values)
+
+	if !overwrite {
+		sheet := m.sheets[r.sheet]
+		if top < len(sheet) {
+			inserted := make([][]any, len(rows))
+			m.sheets[r.sheet] = append(sheet[:top], append(inserted, sheet[top:]...)...)
+		}
+	}
+
+	for i, row := range rows {
+		for j, value := range row {
+			m.set(r.sheet, top+i, r.left+j, value)
+		}
+	}
+
+	return nil
+}
+
+func (m *memory) Clear(areas ...string) error {
+	for _, area := range areas {
+		r, err := m.parse(area)
+		if err != nil {
+			return err
+		}
+
+		sheet := m.sheets[r.sheet]
+		for i := r.top; i <= r.bottom && i < len(sheet); i++ {
+			for j := r.left; j <= r.right && j < len(sheet[i]); j++ {
+				sheet[i][j] = ""
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *memory) DeleteRows(area string, rows ...rowRange) error {
+	r, err := m.parse(area)
+	if err != nil {
+		return err
+	}
+
+	sheet := m.sheets[r.sheet]
+	deleted := map[int]bool{}
+	for _, rr := range rows {
+		end := int(rr.end)
+		if end == 0 {
+			end = len(sheet)
+		}
+
+		for i := int(rr.start); i < end; i++ {
+			deleted[i] = true
+		}
+	}
+
+	list := [][]any{}
+	for i, row := range sheet {
+		if !deleted[i] {
+			list = append(list, row)
+		}
+	}
+
+	m.sheets[r.sheet] = list
+
+	return nil
+}
+
+func (m *memory) RowCount(area string) (int64, error) {
+	r, err := m.parse(area)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(m.sheets[r.sheet])), nil
+}
+
+func (m *memory) Revision() (*revision, error) {
+	return m.revision, nil
+}
+
+func (m *memory) TimeZone() (*time.Location, error) {
+	return time.Local, nil
+}
+
+func (m *memory) Sheets() ([]string, error) {
+	return slices.Sorted(maps.Keys(m.sheets)), nil
+}
+
+func (m *memory) parse(area string) (*cells, error) {
+	match := regexp.MustCompile(`^(.+?)!([A-Z]+)([0-9]+)(?::([A-Z]+)([0-9]+)?)?$`).FindStringSubmatch(area)
+	if len(match) < 6 {
+		return nil, fmt.Errorf("invalid area '%v'", area)
+	}
+
+	if _, ok := m.sheets[match[1]]; !ok {
+		return nil, fmt.Errorf("unable to identify worksheet for '%s'", area)
+	}
+
+	column := func(s string) int {
+		v := 0
+		for _, ch := range s {
+			v = 26*v + int(ch-'A'+1)
+		}
+
+		return v - 1
+	}
+
+	r := cells{
+		sheet:  match[1],
+		left:   column(match[2]),
+		right:  column(match[2]),
+		bottom: 1 << 20,
+	}
+
+	r.top, _ = strconv.Atoi(match[3])
+	r.top--
+
+	if match[4] != "" {
+		r.right = column(match[4])
+	}
+
+	if match[5] != "" {
+		r.bottom, _ = strconv.Atoi(match[5])
+		r.bottom--
+	} else if match[4] == "" {
+		r.bottom = r.top
+	}
+
+	return &r, nil
+}
+
+func (m *memory) set(sheet string, row, col int, value any) {
+	rows := m.sheets[sheet]
+	for len(rows) <= row {
+		rows = append(rows, []any{})
+	}
+
+	for len(rows[row]) <= col {
+		rows[row] = append(rows[row], "")
+	}
+
+	rows[row][col] = value
+	m.sheets[sheet] = rows
+}
+
+func TestUpdateLogSheet(t *testing.T) {
+	backend := memory{
+		sheets: map[string][][]any{
+			"Log": [][]any{
+				[]any{"Timestamp", "Device ID", "Unchanged", "Updated", "Added", "Deleted", "Failed", "Errors"},
+			},
+		},
+	}
+
+	cmd := LoadACL{
+		logRange: "Log!A1:H",
+	}
+
+	rpt := map[uint32]lib.Report{
+		405419896: lib.Report{
+			Unchanged: []uint32{6001001},
+			Updated:   []uint32{6001002},
+			Added:     []uint32{6001003, 6001004},
+		},
+		303986753: lib.Report{
+			Deleted: []uint32{6001005},
+			Errored: []uint32{6001006},
+		},
+	}
+
+	if err := cmd.updateLogSheet(&backend, rpt); err != nil {
+		t.Fatalf("Unexpected error updating log sheet (%v)", err)
+	}
+
+	rows := backend.sheets["Log"]
+	if len(rows) != 3 {
+		t.Fatalf("Incorrect number of log rows - expected:%v, got:%v", 3, len(rows))
+	}
+
+	expected := [][]any{
+		[]any{"'303986753", 0, 0, 0, 1, 0, 1},
+		[]any{"'405419896", 1, 1, 2, 0, 0, 0},
+	}
+
+	for i, row := range rows[1:] {
+		if _, err := time.ParseInLocation("2006-01-02 15:04:05", fmt.Sprintf("%v", row[0]), time.Local); err != nil {
+			t.Errorf("Invalid log timestamp '%v'", row[0])
+		}
+
+		if !reflect.DeepEqual(row[1:], expected[i]) {
+			t.Errorf("Incorrect log row\n   expected:%v\n   got:     %v", expected[i], row[1:])
+		}
+	}
+}
+
+func TestUpdateLogSheetWithOutOfOrderColumns(t *testing.T) {
+	backend := memory{
+		sheets: map[string][][]any{
+			"Log": [][]any{
+				[]any{"Device ID", "Timestamp", "Added", "Errors"},
+			},
+		},
+	}
+
+	cmd := LoadACL{
+		logRange: "Log!A1:H",
+	}
+
+	rpt := map[uint32]lib.Report{
+		405419896: lib.Report{
+			Added: []uint32{6001003, 6001004},
+		},
+	}
+
+	if err := cmd.updateLogSheet(&backend, rpt); err != nil {
+		t.Fatalf("Unexpected error updating log sheet (%v)", err)
+	}
+
+	row := backend.sheets["Log"][1]
+	if row[0] != "'405419896" || row[2] != 2 || row[3] != 0 {
+		t.Errorf("Incorrect log row %v", row)
+	}
+}
+
+func TestPruneSheet(t *testing.T) {
+	now := time.Now()
+	recent := now.Format("2006-01-02 15:04:05")
+	old := now.AddDate(0, 0, -45).Format("2006-01-02 15:04:05")
+
+	backend := memory{
+		sheets: map[string][][]any{
+			"Log": [][]any{
+				[]any{"Timestamp", "Device ID"},
+				[]any{old, "405419896"},
+				[]any{old, "303986753"},
+				[]any{recent, "405419896"},
+				[]any{old, "405419896"},
+				[]any{recent, "303986753"},
+			},
+		},
+	}
+
+	expected := [][]any{
+		[]any{"Timestamp", "Device ID"},
+		[]any{recent, "405419896"},
+		[]any{recent, "303986753"},
+	}
+
+	if err := pruneSheet(&backend, "Log!A1:H", 30); err != nil {
+		t.Fatalf("Unexpected error pruning sheet (%v)", err)
+	}
+
+	if rows := backend.sheets["Log"]; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrectly pruned sheet\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestUpdateReportSheet(t *testing.T) {
+	now := time.Now()
+	old := now.AddDate(0, 0, -30).Format("2006-01-02 15:04:05")
+	recent := now.Add(-time.Minute).Format("2006-01-02 15:04:05")
+
+	backend := memory{
+		sheets: map[string][][]any{
+			"Report": [][]any{
+				[]any{"Timestamp", "Action", "Card Number"},
+				[]any{old, "Added", "6001000"},
+				[]any{recent, "Deleted", "6001009"},
+			},
+		},
+	}
+
+	cmd := LoadACL{
+		reportRange:     "Report!A1:E",
+		reportRetention: 7,
+	}
+
+	rpt := map[uint32]lib.Report{
+		405419896: lib.Report{
+			Added:   []uint32{6001003},
+			Deleted: []uint32{6001005},
+		},
+	}
+
+	if err := cmd.updateReportSheet(&backend, rpt, nil); err != nil {
+		t.Fatalf("Unexpected error updating report sheet (%v)", err)
+	}
+
+	rows, _ := backend.Read("Report!A2:C")
+	actions := []string{}
+	for _, row := range rows {
+		actions = append(actions, fmt.Sprintf("%v:%v", row[1], row[2]))
+	}
+
+	expected := []string{"Deleted:6001009", "Added:6001003", "Deleted:6001005"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Incorrect report\n   expected:%v\n   got:     %v", expected, actions)
+	}
+}
+
+func TestCompareACLWrite(t *testing.T) {
+	backend := memory{
+		sheets: map[string][][]any{
+			"Audit": [][]any{
+				[]any{"2020-01-01 00:00:00"},
+				[]any{"Device", "Updated", "Added", "Deleted"},
+				[]any{"405419896", "6001000", "", ""},
+			},
+		},
+	}
+
+	cmd := CompareACL{
+		report: "Audit!A1:D",
+	}
+
+	diff := lib.SystemDiff{
+		405419896: lib.Diff{
+			Updated: []types.Card{{CardNumber: 6001001}},
+			Added:   []types.Card{{CardNumber: 6001002}, {CardNumber: 6001003}},
+		},
+		303986753: lib.Diff{
+			Deleted: []types.Card{{CardNumber: 6001004}},
+		},
+	}
+
+	if err := cmd.write(&backend, &diff, nil); err != nil {
+		t.Fatalf("Unexpected error writing compare report (%v)", err)
+	}
+
+	rows, _ := backend.Read("Audit!A3:D")
+	expected := [][]any{
+		[]any{"303986753", "'-", "'-", "6001004"},
+		[]any{},
+		[]any{"405419896", "6001001", "6001002", "'-"},
+		[]any{"", "", "6001003"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if title := fmt.Sprintf("%v", backend.sheets["Audit"][0][0]); strings.HasPrefix(title, "2020") {
+		t.Errorf("Report timestamp not updated (%v)", title)
+	}
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var CheckAuthCmd = CheckAuth{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+}
+
+type CheckAuth struct {
+	command
+}
+
+func (cmd *CheckAuth) Name() string {
+	return "check-auth"
+}
+
+func (cmd *CheckAuth) Description() string {
+	return "Verifies the Google Sheets and Google Drive authorisation for a spreadsheet"
+}
+
+func (cmd *CheckAuth) Usage() string {
+	return "--credentials <file> --url <url>"
+}
+
+func (cmd *CheckAuth) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] check-auth [options] --url <URL>\n", APP)
+	fmt.Println()
+	fmt.Println("  Verifies that the stored authorisation tokens (or service account) provide access to the Google Sheets spreadsheet")
+	fmt.Println("  and the Google Drive revision history, refreshing the tokens if necessary. Does not access the controllers.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets check-auth --credentials "credentials.json" --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
+	fmt.Println()
+}
+
+func (cmd *CheckAuth) FlagSet() *flag.FlagSet {
+	return cmd.flagset("check-auth")
+}
+
+func (cmd *CheckAuth) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if strings.TrimSpace(cmd.credentials) == "" {
+		return fmt.Errorf("--credentials is a required option")
+	}
+
+	if strings.TrimSpace(cmd.url) == "" {
+		return fmt.Errorf("--url is a required option")
+	}
+
+	backend, err := cmd.backend(options.context())
+	if err != nil {
+		return err
+	}
+
+	google, ok := backend.(*googleSheets)
+	if !ok {
+		return fmt.Errorf("check-auth requires a Google Sheets spreadsheet")
+	}
+
+	failed := 0
+
+	if title, err := google.checkSheets(); err != nil {
+		errorf("Google Sheets  %v", err)
+		failed++
+	} else {
+		infof("Google Sheets  ok (%v)", title)
+	}
+
+	if err := google.checkDrive(); err != nil {
+		errorf("Google Drive   %v", err)
+		failed++
+	} else {
+		infof("Google Drive   ok")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("not authorised")
+	}
+
+	return nil
+}
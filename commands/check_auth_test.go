@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func testCheckAuth(fake *fakeGoogle, t *testing.T) *CheckAuth {
+	credentials, tokens := fake.authorise(t)
+
+	return &CheckAuth{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+	}
+}
+
+// Replaces the 'authorise' Google Sheets and Google Drive tokens.
+func setTokens(t *testing.T, dir string, token oauth2.Token) {
+	for _, file := range []string{"credentials.sheets", "credentials.drive"} {
+		if err := writeToken(filepath.Join(dir, file), &token, nil); err != nil {
+			t.Fatalf("Error writing %v (%v)", file, err)
+		}
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	cmd := testCheckAuth(fake, t)
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing check-auth (%v)", err)
+	}
+
+	if n := fake.count("spreadsheets.get"); n != 1 {
+		t.Errorf("Incorrect number of Google Sheets requests - expected:%v, got:%v", 1, n)
+	}
+
+	if n := fake.count("revisions.list"); n != 1 {
+		t.Errorf("Incorrect number of Google Drive requests - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestCheckAuthWithExpiredToken(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	cmd := testCheckAuth(fake, t)
+
+	setTokens(t, cmd.tokens, oauth2.Token{
+		AccessToken:  "ya29.expired-access-token",
+		TokenType:    "Bearer",
+		RefreshToken: "fake-refresh-token",
+		Expiry:       time.Now().Add(-1 * time.Hour),
+	})
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing check-auth (%v)", err)
+	}
+
+	for _, file := range []string{"credentials.sheets", "credentials.drive"} {
+		if token, err := tokenFromFile(filepath.Join(cmd.tokens, file), nil); err != nil {
+			t.Errorf("Error reading %v (%v)", file, err)
+		} else if token.AccessToken != fakeAccessToken {
+			t.Errorf("Refreshed %v token not saved\n   expected:%v\n   got:     %v", file, fakeAccessToken, token.AccessToken)
+		} else if token.RefreshToken != "fake-refresh-token" {
+			t.Errorf("Refreshed %v token without refresh token", file)
+		} else if !token.Expiry.After(time.Now()) {
+			t.Errorf("Refreshed %v token has expired (%v)", file, token.Expiry)
+		}
+	}
+}
+
+func TestCheckAuthWithRevokedToken(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	cmd := testCheckAuth(fake, t)
+
+	setTokens(t, cmd.tokens, oauth2.Token{
+		AccessToken:  "ya29.expired-access-token",
+		TokenType:    "Bearer",
+		RefreshToken: "revoked-refresh-token",
+		Expiry:       time.Now().Add(-1 * time.Hour),
+	})
+
+	if err := cmd.Execute(&Options{}); err == nil {
+		t.Fatalf("Expected error executing check-auth with revoked token")
+	}
+
+	google, err := newGoogleSheets(fakeSpreadsheetURL, cmd.credentials, cmd.tokens)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	google.endpoint = fake.url
+
+	_, err = google.Read("ACL!A1:D")
+	if err == nil || !strings.Contains(err.Error(), "Google Sheets token expired or revoked") || !strings.Contains(err.Error(), "re-authorise") {
+		t.Errorf("Expected 're-authorise' error for revoked Google Sheets token, got '%v'", err)
+	}
+
+	_, err = google.Revision()
+	if err == nil || !strings.Contains(err.Error(), "Google Drive token expired or revoked") || !strings.Contains(err.Error(), "re-authorise") {
+		t.Errorf("Expected 're-authorise' error for revoked Google Drive token, got '%v'", err)
+	}
+}
+
+func TestCheckAuthWithoutRefreshToken(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	cmd := testCheckAuth(fake, t)
+
+	setTokens(t, cmd.tokens, oauth2.Token{
+		AccessToken: "ya29.expired-access-token",
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(-1 * time.Hour),
+	})
+
+	google, err := newGoogleSheets(fakeSpreadsheetURL, cmd.credentials, cmd.tokens)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	google.endpoint = fake.url
+
+	_, err = google.Read("ACL!A1:D")
+	if err == nil || !strings.Contains(err.Error(), "Google Sheets token expired") || !strings.Contains(err.Error(), "re-authorise") {
+		t.Errorf("Expected 're-authorise' error for expired Google Sheets token, got '%v'", err)
+	}
+}
@@ -1,15 +1,14 @@
 package commands
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
 
-	"google.golang.org/api/sheets/v4"
-
 	"github.com/uhppoted/uhppote-core/uhppote"
 	"github.com/uhppoted/uhppoted-app-sheets/log"
 	"github.com/uhppoted/uhppoted-lib/config"
@@ -18,15 +17,31 @@ import (
 const APP = "uhppoted-app-sheets"
 
 type Options struct {
-	Config string
-	Debug  bool
+	Config  string
+	Debug   bool
+	Context context.Context // cancelled on SIGINT/SIGTERM or when the --timeout expires (optional)
+}
+
+// Returns the command context, defaulting to context.Background() if not set.
+func (o *Options) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+
+	return o.Context
 }
 
 type command struct {
 	workdir     string
 	credentials string
 	tokens      string
+	tokenKey    string
 	url         string
+	workbook    string
+	apiRetries  int              // Google API retries after a rate-limit or transient error
+	apiBudget   int              // Google API requests per minute (the default Google Sheets per-user quota is 60)
+	endpoint    string           // overrides the Google API endpoint (for testing)
+	iuhppote    uhppote.IUHPPOTE // overrides the UHPPOTE controllers interface (for testing)
 	debug       bool
 }
 
@@ -37,11 +52,151 @@ func (c *command) flagset(name string) *flag.FlagSet {
 	flagset.StringVar(&c.workdir, "workdir", workdir, "Directory for working files (tokens, revisions, etc)'")
 	flagset.StringVar(&c.credentials, "credentials", c.credentials, "Path for the 'credentials.json' file")
 	flagset.StringVar(&c.tokens, "tokens", c.tokens, "Directory for the authorisation tokens. Default to the <workdir>/sheets/.google")
+	flagset.StringVar(&c.tokenKey, "token-key", c.tokenKey, "File containing the key for encrypted authorisation tokens. Defaults to the "+TOKEN_KEY+" environment variable")
 	flagset.StringVar(&c.url, "url", c.url, "Spreadsheet URL")
+	flagset.IntVar(&c.apiRetries, "api-retries", c.apiRetries, "Number of times a Google API request is retried after a rate-limit or transient error")
+	flagset.IntVar(&c.apiBudget, "api-rate-limit", c.apiBudget, "Maximum number of Google API requests per minute (0 for no limit)")
 
 	return flagset
 }
 
+// Returns the spreadsheet backend for the --url or --file option. Google API requests are cancelled
+// when the context is cancelled.
+func (c *command) backend(ctx context.Context) (Backend, error) {
+	if strings.TrimSpace(c.workbook) != "" {
+		return newWorkbook(c.workbook)
+	}
+
+	key, err := tokenKey(c.tokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	google, err := newGoogleSheets(c.url, c.credentials, c.tokenDir())
+	if err != nil {
+		return nil, err
+	}
+
+	google.ctx = ctx
+	google.key = key
+	google.endpoint = c.endpoint
+	google.retry = retryPolicy{
+		retries:  c.apiRetries,
+		backoff:  time.Second,
+		maxDelay: 32 * time.Second,
+		budget:   c.apiBudget,
+	}
+
+	return google, nil
+}
+
+// Reports a cancelled (or timed out) command and, unless nolog is set, records it on the log worksheet.
+// The log row is written with a short-lived context detached from the cancelled command context. Returns
+// the cancellation cause.
+func (c *command) cancelled(ctx context.Context, nolog bool, logRange string) error {
+	cause := context.Cause(ctx)
+
+	warnf("Cancelled (%v)", cause)
+
+	if nolog {
+		return cause
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	backend, err := c.backend(ctx)
+	if err == nil {
+		err = writeLogEntries(backend, logRange, []logEntry{{message: fmt.Sprintf("CANCELLED: %v", cause)}})
+	}
+
+	if err != nil {
+		errorf("unable to log cancelled command (%v)", err)
+	}
+
+	return cause
+}
+
+// Acquires the lockfile for a spreadsheet range, reclaiming a stale lockfile older than maxAge. The lock
+// is refreshed in the background until it is released.
+func (c *command) lock(backend Backend, area string, maxAge time.Duration) (*lock, error) {
+	file := lockFile(c.workdir, backend.ID(), area)
+
+	l, err := acquireLock(file, backend.ID(), area, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	l.keepalive(refreshInterval(maxAge))
+
+	return l, nil
+}
+
+// Acquires the lockfiles for the controllers (in controller ID order) so that commands that update the same
+// controllers exclude each other, irrespective of the spreadsheet. The locks are refreshed in the background
+// until they are released.
+func (c *command) lockControllers(devices []uhppote.Device, maxAge time.Duration) (locks, error) {
+	controllers := []uint32{}
+	for _, d := range devices {
+		controllers = append(controllers, d.DeviceID)
+	}
+
+	slices.Sort(controllers)
+
+	list := locks{}
+	for _, controller := range slices.Compact(controllers) {
+		l, err := acquireControllerLock(c.workdir, controller, maxAge)
+		if err != nil {
+			list.release()
+			return nil, err
+		}
+
+		l.keepalive(refreshInterval(maxAge))
+
+		list = append(list, l)
+	}
+
+	return list, nil
+}
+
+// Returns the interval at which to refresh a lock, which is reduced for a maximum age of less than 4 minutes
+// so that the lock is refreshed (at least) four times within the maximum age.
+func refreshInterval(maxAge time.Duration) time.Duration {
+	if maxAge > 0 && maxAge/4 < LOCK_REFRESH {
+		return maxAge / 4
+	}
+
+	return LOCK_REFRESH
+}
+
+// Returns the directory for the authorisation tokens, defaulting to <workdir>/.google.
+func (c *command) tokenDir() string {
+	if c.tokens == "" {
+		return filepath.Join(c.workdir, ".google")
+	}
+
+	return c.tokens
+}
+
+// Validates the --url/--file spreadsheet options for the commands that support a local spreadsheet file.
+func (c *command) validateSpreadsheet() error {
+	url := strings.TrimSpace(c.url)
+	file := strings.TrimSpace(c.workbook)
+
+	switch {
+	case url == "" && file == "":
+		return fmt.Errorf("either --url or --file is required")
+
+	case url != "" && file != "":
+		return fmt.Errorf("--url and --file are mutually exclusive")
+
+	case url != "" && strings.TrimSpace(c.credentials) == "":
+		return fmt.Errorf("--credentials is a required option")
+	}
+
+	return nil
+}
+
 type report struct {
 	top     int64
 	left    string
@@ -71,6 +226,14 @@ func helpOptions(flagset *flag.FlagSet) {
 	}
 }
 
+func (c *command) controllers(conf *config.Config) (uhppote.IUHPPOTE, []uhppote.Device) {
+	if c.iuhppote != nil {
+		return c.iuhppote, conf.Devices.ToControllers()
+	}
+
+	return getDevices(conf, c.debug)
+}
+
 func getDevices(conf *config.Config, debug bool) (uhppote.IUHPPOTE, []uhppote.Device) {
 	bind, broadcast, listen := config.DefaultIpAddresses()
 
@@ -93,26 +256,6 @@ func getDevices(conf *config.Config, debug bool) (uhppote.IUHPPOTE, []uhppote.De
 	return u, controllers
 }
 
-func getSpreadsheet(google *sheets.Service, id string) (*sheets.Spreadsheet, error) {
-	spreadsheet, err := google.Spreadsheets.Get(id).Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch spreadsheet (%v)", err)
-	}
-
-	return spreadsheet, nil
-}
-
-func getSheet(spreadsheet *sheets.Spreadsheet, area string) (*sheets.Sheet, error) {
-	name := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(area)[1]
-	for _, sheet := range spreadsheet.Sheets {
-		if strings.EqualFold(strings.TrimSpace(sheet.Properties.Title), strings.TrimSpace(name)) {
-			return sheet, nil
-		}
-	}
-
-	return nil, fmt.Errorf("unable to identify worksheet for '%s'", area)
-}
-
 func buildIndex(rows [][]any, fields []string) (map[string]int, int) {
 	index := map[string]int{}
 
@@ -4,16 +4,12 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	"google.golang.org/api/option"
-	"google.golang.org/api/sheets/v4"
-
 	"github.com/uhppoted/uhppote-core/uhppote"
 	lib "github.com/uhppoted/uhppoted-lib/acl"
 	"github.com/uhppoted/uhppoted-lib/config"
@@ -25,20 +21,34 @@ var CompareACLCmd = CompareACL{
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
 
 	config: config.DefaultConfig,
 	acl:    "",
 	report: "Audit!A1:D",
+
+	lockMaxAge: 2 * time.Hour,
+
+	workers: workers{
+		concurrency: 4,
+		timeout:     5 * time.Minute,
+		retries:     2,
+	},
 }
 
 type CompareACL struct {
 	command
-	config  string
-	acl     string
-	report  string
-	withPIN bool
+	config       string
+	acl          string
+	report       string
+	timeProfiles string
+	groups       string
+	withPIN      bool
+	lockMaxAge   time.Duration
+	workers      workers
 }
 
 func (cmd *CompareACL) Name() string {
@@ -50,7 +60,7 @@ func (cmd *CompareACL) Description() string {
 }
 
 func (cmd *CompareACL) Usage() string {
-	return "--credentials <file> --url <url>"
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
 }
 
 func (cmd *CompareACL) Help() {
@@ -72,15 +82,25 @@ func (cmd *CompareACL) Help() {
 	fmt.Println(`                                                               --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
 	fmt.Println(`                                                               --range "ACL!A2:E" \`)
 	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets compare-acl --file "site.ods" --range "ACL!A2:E" --report-range "Audit!A1:D"`)
+	fmt.Println(`    uhppote-app-sheets compare-acl --file "site.ods" --range "ACL-*!A2:E" --report-range "Audit!A1:D"`)
+	fmt.Println()
 }
 
 func (cmd *CompareACL) FlagSet() *flag.FlagSet {
 	flagset := cmd.flagset("compare-acl")
 
-	flagset.StringVar(&cmd.acl, "range", cmd.acl, "Spreadsheet range e.g. 'ACL!A2:E'")
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.acl, "range", cmd.acl, "Spreadsheet range e.g. 'ACL!A2:E', or a comma separated list of ranges (e.g. 'Staff!A2:E,Students!A2:E') in which the worksheet name may be a pattern e.g. '*!A2:E'")
 	flagset.StringVar(&cmd.report, "report-range", cmd.report, "Spreadsheet range for compare report e.g. 'Audit!A1:D'")
+	flagset.StringVar(&cmd.timeProfiles, "time-profiles", cmd.timeProfiles, "Spreadsheet range of the time profiles worksheet for door time profiles specified by name e.g. 'TimeProfiles!A1:B'")
+	flagset.StringVar(&cmd.groups, "groups", cmd.groups, "Spreadsheet range of the groups worksheet for ACL rows that specify a group e.g. 'Groups!A1:F'")
 	flagset.BoolVar(&cmd.withPIN, "with-pin", cmd.withPIN, "Includes the card keypad PIN codes when comparing ACLs")
 
+	flagset.DurationVar(&cmd.lockMaxAge, "lock-max-age", cmd.lockMaxAge, "Age after which a lockfile from another host that has not been refreshed is regarded as stale and reclaimed (0 to never reclaim)")
+
+	cmd.workers.flags(flagset)
+
 	return flagset
 }
 
@@ -100,42 +120,27 @@ func (cmd *CompareACL) Execute(args ...any) error {
 		return fmt.Errorf("could not load configuration (%v)", err)
 	}
 
-	u, devices := getDevices(conf, cmd.debug)
+	u, devices := cmd.controllers(conf)
 
-	match := regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(strings.TrimSpace(cmd.url))
-	if len(match) < 2 {
-		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
-	}
+	ctx := options.context()
 
-	spreadsheetId := match[1]
-
-	if cmd.debug {
-		debugf("Spreadsheet - ID:%s  range:%s  audit:%s", spreadsheetId, cmd.acl, cmd.report)
-	}
-
-	// ... authorise
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
-	}
-
-	client, err := authorize(cmd.credentials, SHEETS, tokens)
+	backend, err := cmd.backend(ctx)
 	if err != nil {
-		//lint:ignore ST1005 Google should be capitalized
-		return fmt.Errorf("Google Sheets authentication/authorization error (%w)", err)
+		return err
 	}
 
-	google, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return fmt.Errorf("unable to create new Google Sheets client (%w)", err)
+	// ... locked?
+	if lock, err := cmd.lock(backend, cmd.acl, cmd.lockMaxAge); err != nil {
+		return err
+	} else {
+		defer lock.release()
 	}
 
-	spreadsheet, err := getSpreadsheet(google, spreadsheetId)
-	if err != nil {
-		return err
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s  audit:%s", backend.ID(), cmd.acl, cmd.report)
 	}
 
-	list, err := cmd.getACL(google, spreadsheet, devices)
+	list, err := cmd.getACL(backend, devices)
 	if err != nil {
 		return err
 	}
@@ -144,12 +149,12 @@ func (cmd *CompareACL) Execute(args ...any) error {
 		infof("%v  Downloaded %v records", k, len(l))
 	}
 
-	diff, err := cmd.compare(u, devices, list)
+	diff, unavailable, err := cmd.compare(ctx, u, devices, list)
 	if err != nil {
 		return err
 	}
 
-	if err := cmd.write(google, spreadsheet, diff); err != nil {
+	if err := cmd.write(backend, diff, unavailable); err != nil {
 		return err
 	}
 
@@ -157,33 +162,58 @@ func (cmd *CompareACL) Execute(args ...any) error {
 }
 
 func (c *CompareACL) validate() error {
-	if strings.TrimSpace(c.credentials) == "" {
-		return fmt.Errorf("--credentials is a required option")
-	}
-
-	if strings.TrimSpace(c.url) == "" {
-		return fmt.Errorf("--url is a required option")
+	if err := c.validateSpreadsheet(); err != nil {
+		return err
 	}
 
 	if strings.TrimSpace(c.acl) == "" {
 		return fmt.Errorf("--range is a required option")
 	}
 
-	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(c.acl)); len(match) < 2 {
-		return fmt.Errorf("invalid range '%s' - expected something like 'ACL!A2:K", c.acl)
+	for _, area := range strings.Split(c.acl, ",") {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(area)); len(match) < 2 {
+			return fmt.Errorf("invalid range '%s' - expected something like 'ACL!A2:K", area)
+		}
+	}
+
+	if c.timeProfiles != "" {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(c.timeProfiles)); len(match) < 2 {
+			return fmt.Errorf("invalid time-profiles range '%s' - expected something like 'TimeProfiles!A1:B", c.timeProfiles)
+		}
+	}
+
+	if c.groups != "" {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(c.groups)); len(match) < 2 {
+			return fmt.Errorf("invalid groups range '%s' - expected something like 'Groups!A1:F", c.groups)
+		}
 	}
 
 	if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(c.report); len(match) < 5 {
 		return fmt.Errorf("invalid report-range '%s' - expected something like 'Audit!A1:E", c.report)
 	}
 
+	if err := c.workers.validate(); err != nil {
+		return err
+	}
+
+	if c.lockMaxAge < 0 {
+		return fmt.Errorf("invalid --lock-max-age '%v' - expected a positive duration", c.lockMaxAge)
+	}
+
 	return nil
 }
 
-func (cmd *CompareACL) compare(u uhppote.IUHPPOTE, devices []uhppote.Device, list *lib.ACL) (*lib.SystemDiff, error) {
-	current, errors := lib.GetACL(u, devices)
-	if len(errors) > 0 {
-		return nil, fmt.Errorf("%v", errors)
+// Compares the controller ACLs with the worksheet ACL. Controllers that could not be retrieved are excluded
+// from the comparison and returned separately.
+func (cmd *CompareACL) compare(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, list *lib.ACL) (*lib.SystemDiff, map[uint32]error, error) {
+	current, unavailable := cmd.workers.getACL(ctx, u, devices)
+	if len(current) == 0 && len(unavailable) > 0 {
+		return nil, nil, fmt.Errorf("no controllers available (%v)", joinErrors(unavailable))
+	}
+
+	for k, err := range unavailable {
+		warnf("%v  controller unavailable (%v)", k, err)
+		delete(*list, k)
 	}
 
 	f := func(current lib.ACL, list lib.ACL) (map[uint32]lib.Diff, error) {
@@ -195,27 +225,18 @@ func (cmd *CompareACL) compare(u uhppote.IUHPPOTE, devices []uhppote.Device, lis
 	}
 
 	if d, err := f(current, *list); err != nil {
-		return nil, err
+		return nil, nil, err
 	} else {
 		diff := lib.SystemDiff(d)
 
-		return &diff, nil
+		return &diff, unavailable, nil
 	}
 }
 
-func (cmd *CompareACL) getACL(google *sheets.Service, spreadsheet *sheets.Spreadsheet, devices []uhppote.Device) (*lib.ACL, error) {
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, cmd.acl).Do()
+func (cmd *CompareACL) getACL(backend Backend, devices []uhppote.Device) (*lib.ACL, error) {
+	table, _, err := getACLTable(backend, cmd.acl, cmd.groups, cmd.timeProfiles)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve data from sheet (%v)", err)
-	}
-
-	if len(response.Values) == 0 {
-		return nil, fmt.Errorf("no data in spreadsheet/range")
-	}
-
-	table, err := makeTable(response.Values)
-	if err != nil {
-		return nil, fmt.Errorf("error creating table from worksheet (%v)", err)
+		return nil, err
 	}
 
 	f := func(table *lib.Table, devices []uhppote.Device) (*lib.ACL, []error, error) {
@@ -239,40 +260,23 @@ func (cmd *CompareACL) getACL(google *sheets.Service, spreadsheet *sheets.Spread
 	}
 }
 
-func (c *CompareACL) write(google *sheets.Service, spreadsheet *sheets.Spreadsheet, diff *lib.SystemDiff) error {
+func (c *CompareACL) write(backend Backend, diff *lib.SystemDiff, unavailable map[uint32]error) error {
 	// ... create report format
-	sheet, err := getSheet(spreadsheet, c.report)
-	if err != nil {
-		return err
-	}
-
-	format, err := c.buildReportFormat(google, spreadsheet)
+	format, err := c.buildReportFormat()
 	if err != nil {
 		return err
 	}
 
 	// ... clear existing report
 	infof("Clearing existing report from worksheet")
-	if err := clear(google, spreadsheet, []string{format.title, format.data}); err != nil {
+	if err := backend.Clear(format.title, format.data); err != nil {
 		return err
 	}
 
-	if sheet.Properties.GridProperties.RowCount > format.top+16 {
-		prune := sheets.BatchUpdateSpreadsheetRequest{
-			Requests: []*sheets.Request{
-				&sheets.Request{
-					DeleteDimension: &sheets.DeleteDimensionRequest{
-						Range: &sheets.DimensionRange{
-							SheetId:    sheet.Properties.SheetId,
-							Dimension:  "ROWS",
-							StartIndex: int64(format.top + 2),
-						},
-					},
-				},
-			},
-		}
-
-		if _, err := google.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &prune).Do(); err != nil {
+	if rows, err := backend.RowCount(c.report); err != nil {
+		return err
+	} else if rows > format.top+16 {
+		if err := backend.DeleteRows(c.report, rowRange{start: format.top + 2}); err != nil {
 			return fmt.Errorf("error pruning report worksheet (%w)", err)
 		}
 	}
@@ -280,18 +284,18 @@ func (c *CompareACL) write(google *sheets.Service, spreadsheet *sheets.Spreadshe
 	// ... write report
 	infof("Writing report to worksheet")
 
-	var timestamp = sheets.ValueRange{
-		Range: format.title,
-		Values: [][]any{
+	var timestamp = valueRange{
+		area: format.title,
+		values: [][]any{
 			[]any{
 				time.Now().Format("2006-01-02 15:04:05"),
 			},
 		},
 	}
 
-	var values = sheets.ValueRange{
-		Range:  format.data,
-		Values: [][]any{},
+	var values = valueRange{
+		area:   format.data,
+		values: [][]any{},
 	}
 
 	keys := []uint32{}
@@ -299,12 +303,18 @@ func (c *CompareACL) write(google *sheets.Service, spreadsheet *sheets.Spreadshe
 		keys = append(keys, k)
 	}
 
+	for k := range unavailable {
+		keys = append(keys, k)
+	}
+
 	slices.Sort(keys)
 
 	for _, k := range keys {
-		if v, ok := (*diff)[k]; ok {
-			top := len(values.Values)
-			values.Values = append(values.Values, []any{fmt.Sprintf("%v", k), "'-", "'-", "'-"})
+		if _, ok := unavailable[k]; ok {
+			values.values = append(values.values, []any{fmt.Sprintf("%v", k), "UNAVAILABLE", "", ""}, []any{"", "", "", ""})
+		} else if v, ok := (*diff)[k]; ok {
+			top := len(values.values)
+			values.values = append(values.values, []any{fmt.Sprintf("%v", k), "'-", "'-", "'-"})
 
 			rows := max(len(v.Added), len(v.Updated))
 			if len(v.Deleted) > rows {
@@ -312,49 +322,39 @@ func (c *CompareACL) write(google *sheets.Service, spreadsheet *sheets.Spreadshe
 			}
 
 			for i := 1; i <= rows; i++ {
-				values.Values = append(values.Values, []any{"", "", "", ""})
+				values.values = append(values.values, []any{"", "", "", ""})
 			}
 
 			for i, c := range v.Updated {
-				values.Values[top+i][1] = fmt.Sprintf("%v", c.CardNumber)
+				values.values[top+i][1] = fmt.Sprintf("%v", c.CardNumber)
 			}
 
 			for i, c := range v.Added {
-				values.Values[top+i][2] = fmt.Sprintf("%v", c.CardNumber)
+				values.values[top+i][2] = fmt.Sprintf("%v", c.CardNumber)
 			}
 
 			for i, c := range v.Deleted {
-				values.Values[top+i][3] = fmt.Sprintf("%v", c.CardNumber)
+				values.values[top+i][3] = fmt.Sprintf("%v", c.CardNumber)
 			}
 		}
 	}
 
-	rq := sheets.BatchUpdateValuesRequest{
-		ValueInputOption: "USER_ENTERED",
-		Data:             []*sheets.ValueRange{&timestamp, &values},
-	}
-
-	if _, err := google.Spreadsheets.Values.BatchUpdate(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
+	if err := backend.Write(timestamp, values); err != nil {
 		return err
 	}
 
 	// ... pad
 
-	var pad = sheets.ValueRange{
-		Values: [][]any{[]any{""}},
-	}
+	var pad = [][]any{[]any{""}}
 
-	if _, err := google.Spreadsheets.Values.Append(spreadsheet.SpreadsheetId, c.report, &pad).
-		ValueInputOption("USER_ENTERED").
-		InsertDataOption("OVERWRITE").
-		Do(); err != nil {
+	if err := backend.Append(c.report, pad, true); err != nil {
 		return fmt.Errorf("error padding report worksheet (%w)", err)
 	}
 
 	return nil
 }
 
-func (c *CompareACL) buildReportFormat(google *sheets.Service, spreadsheet *sheets.Spreadsheet) (*report, error) {
+func (c *CompareACL) buildReportFormat() (*report, error) {
 	match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(c.report)
 	name := match[1]
 	left := match[2]
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareACL(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := CompareACL{
+		command: fake.command(t, sim),
+		acl:     "ACL!A1:H",
+		report:  "Audit!A1:D",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing compare-acl (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "6001001", "6001002", "-"},
+		[]any{"", "", "6001004"},
+		[]any{},
+		[]any{"405419896", "6001002", "6001004", "6001003"},
+	}
+
+	if rows := fake.values("Audit"); len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	// ... compare-acl should not update the controllers
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+}
+
+func TestCompareACLWithOfflineController(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	controllers[405419896].offline = true
+	sim := newSimulator(controllers)
+
+	cmd := CompareACL{
+		command: fake.command(t, sim),
+		acl:     "ACL!A1:H",
+		report:  "Audit!A1:D",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing compare-acl with offline controller (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "6001001", "6001002", "-"},
+		[]any{"", "", "6001004"},
+		[]any{},
+		[]any{"405419896", "UNAVAILABLE"},
+	}
+
+	if rows := fake.values("Audit"); len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestCompareACLWithMultipleRanges(t *testing.T) {
+	worksheets := testACLRangeWorksheets(
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "N", "Y", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := CompareACL{
+		command: fake.command(t, sim),
+		acl:     "Staff!A1:H, Students!A1:H",
+		report:  "Audit!A1:D",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing compare-acl (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "6001001", "6001002", "-"},
+		[]any{"", "", "6001004"},
+		[]any{},
+		[]any{"405419896", "6001002", "6001004", "6001003"},
+	}
+
+	if rows := fake.values("Audit"); len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
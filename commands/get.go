@@ -1,16 +1,13 @@
 package commands
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
-	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 
 	lib "github.com/uhppoted/uhppoted-lib/os"
@@ -22,6 +19,8 @@ var GetCmd = Get{
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
 
@@ -94,40 +93,23 @@ func (cmd *Get) Execute(args ...any) error {
 		return fmt.Errorf("--range is a required option")
 	}
 
-	match := regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(cmd.url)
-	if len(match) < 2 {
-		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
+	backend, err := cmd.backend(options.context())
+	if err != nil {
+		return err
 	}
 
-	spreadsheet := match[1]
 	area := cmd.area
 
 	if cmd.debug {
-		debugf("Spreadsheet - ID:%s  range:%s", spreadsheet, area)
-	}
-
-	// ... authorise
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
-	}
-
-	client, err := authorize(cmd.credentials, SHEETS, tokens)
-	if err != nil {
-		return fmt.Errorf("authentication/authorization error (%v)", err)
-	}
-
-	google, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return fmt.Errorf("unable to create new Sheets client (%v)", err)
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), area)
 	}
 
-	response, err := google.Spreadsheets.Values.Get(spreadsheet, area).Do()
+	values, err := backend.Read(area)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve data from sheet (%v)", err)
 	}
 
-	if len(response.Values) == 0 {
+	if len(values) == 0 {
 		return fmt.Errorf("no data in spreadsheet/range")
 	}
 
@@ -141,7 +123,7 @@ func (cmd *Get) Execute(args ...any) error {
 		os.Remove(tmp.Name())
 	}()
 
-	if err := sheetToTSV(tmp, response, cmd.withPIN); err != nil {
+	if err := sheetToTSV(tmp, &sheets.ValueRange{Values: values}, cmd.withPIN); err != nil {
 		return fmt.Errorf("error creating TSV file (%v)", err)
 	}
 
@@ -0,0 +1,393 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	"github.com/uhppoted/uhppoted-lib/config"
+	"github.com/uhppoted/uhppoted-lib/locales"
+)
+
+var GetEventsCmd = GetEvents{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config:    config.DefaultConfig,
+	area:      "Events!A1:H",
+	retention: 30,
+	maxEvents: 1000,
+
+	lockMaxAge: 2 * time.Hour,
+}
+
+type GetEvents struct {
+	command
+	config     string
+	area       string
+	retention  int
+	maxEvents  int
+	lockMaxAge time.Duration
+}
+
+// Last retrieved event index for each controller, keyed by controller ID.
+type eventIndices map[uint32]uint32
+
+func (cmd *GetEvents) Name() string {
+	return "get-events"
+}
+
+func (cmd *GetEvents) Description() string {
+	return "Retrieves the events from a set of configured UHPPOTE access controllers and appends them to a Google Sheets worksheet"
+}
+
+func (cmd *GetEvents) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *GetEvents) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] get-events [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Retrieves the events from a set of configured controllers and appends them to a Google Sheets worksheet. Only the events")
+	fmt.Println("  that have not already been retrieved are appended to the worksheet - the index of the last retrieved event for each")
+	fmt.Println("  controller is stored in the working directory.")
+	fmt.Println()
+	fmt.Println("  The worksheet columns are matched by the column names in the first row of the range (case- and space-insensitive):")
+	fmt.Println("  Timestamp, Device ID, Event ID, Type, Door, Card Number, Granted, Reason.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets get-events --credentials "credentials.json" \`)
+	fmt.Println(`                                  --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                  --range "Events!A1:H"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets get-events --file "site.xlsx" --range "Events!A1:H" --retention 90`)
+	fmt.Println()
+}
+
+func (cmd *GetEvents) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("get-events")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range for events e.g. 'Events!A1:H'")
+	flagset.IntVar(&cmd.retention, "retention", cmd.retention, "Events older than 'retention' days are automatically pruned (0 to disable)")
+	flagset.IntVar(&cmd.maxEvents, "max-events", cmd.maxEvents, "Maximum number of events to retrieve from a controller in a single run")
+	flagset.DurationVar(&cmd.lockMaxAge, "lock-max-age", cmd.lockMaxAge, "Age after which a lockfile from another host that has not been refreshed is regarded as stale and reclaimed (0 to never reclaim)")
+
+	return flagset
+}
+
+func (cmd *GetEvents) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	// ... locked?
+	if lock, err := cmd.lock(backend, cmd.area, cmd.lockMaxAge); err != nil {
+		return err
+	} else {
+		defer lock.release()
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), cmd.area)
+	}
+
+	file := filepath.Join(cmd.workdir, ".google", fmt.Sprintf("%s.events", backend.ID()))
+	indices := eventIndices{}
+	if err := indices.load(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading last retrieved event indices from %s (%v)", file, err)
+	}
+
+	type retrieved struct {
+		events []types.Event
+		err    error
+	}
+
+	results, _ := forEach(ctx, devices, func(d uhppote.Device) (retrieved, error) {
+		list, err := cmd.getEvents(u, d.DeviceID, indices)
+
+		return retrieved{list, err}, nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, true, "")
+	}
+
+	events := []types.Event{}
+	for _, device := range devices {
+		list, err := results[device.DeviceID].events, results[device.DeviceID].err
+		if err != nil {
+			errorf("%v  %v", device.DeviceID, err)
+		}
+
+		if len(list) > 0 {
+			infof("%v  Retrieved %v events (%v to %v)", device.DeviceID, len(list), list[0].Index, list[len(list)-1].Index)
+		} else {
+			infof("%v  No new events", device.DeviceID)
+		}
+
+		events = append(events, list...)
+	}
+
+	if len(events) > 0 {
+		if err := cmd.updateEventsSheet(backend, events); err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			indices[uint32(e.SerialNumber)] = e.Index
+		}
+
+		if err := indices.store(file); err != nil {
+			return fmt.Errorf("error storing last retrieved event indices to %s (%v)", file, err)
+		}
+	}
+
+	if cmd.retention > 0 {
+		if err := pruneSheet(backend, cmd.area, cmd.retention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *GetEvents) validate() error {
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(cmd.area) == "" {
+		return fmt.Errorf("--range is a required option")
+	}
+
+	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(cmd.area)); len(match) < 2 {
+		return fmt.Errorf("invalid range '%s' - expected something like 'Events!A1:H", cmd.area)
+	}
+
+	if cmd.maxEvents < 1 {
+		return fmt.Errorf("invalid --max-events (%v)", cmd.maxEvents)
+	}
+
+	if cmd.lockMaxAge < 0 {
+		return fmt.Errorf("invalid --lock-max-age '%v' - expected a positive duration", cmd.lockMaxAge)
+	}
+
+	return nil
+}
+
+// Retrieves the events following the last retrieved event from a controller, up to a maximum of
+// --max-events. Retrieves the most recent events if no events have previously been retrieved
+// from the controller. Returns the events retrieved before an error, along with the error.
+func (cmd *GetEvents) getEvents(u uhppote.IUHPPOTE, deviceID uint32, indices eventIndices) ([]types.Event, error) {
+	events := []types.Event{}
+
+	first, err := u.GetEvent(deviceID, 0)
+	if err != nil {
+		return events, err
+	} else if first == nil {
+		return events, nil
+	}
+
+	last, err := u.GetEvent(deviceID, 0xffffffff)
+	if err != nil {
+		return events, err
+	} else if last == nil {
+		return events, nil
+	}
+
+	from := max(first.Index, last.Index-min(last.Index, uint32(cmd.maxEvents))+1)
+	if index, ok := indices[deviceID]; ok {
+		switch {
+		case index == last.Index:
+			return events, nil
+
+		case index > last.Index:
+			warnf("%v  Last retrieved event index %v is after the controller's last event %v - retrieving from first event", deviceID, index, last.Index)
+			from = first.Index
+
+		case index+1 < first.Index:
+			warnf("%v  Events %v to %v have been overwritten", deviceID, index+1, first.Index-1)
+			from = first.Index
+
+		default:
+			from = index + 1
+		}
+	}
+
+	to := min(last.Index, from+uint32(cmd.maxEvents)-1)
+
+	for index := from; index <= to; index++ {
+		event, err := u.GetEvent(deviceID, index)
+		if err != nil {
+			return events, err
+		} else if event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	return events, nil
+}
+
+func (cmd *GetEvents) updateEventsSheet(backend Backend, events []types.Event) error {
+	values, err := backend.Read(cmd.area)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve column headers from events sheet (%v)", err)
+	}
+
+	fields := []string{"timestamp", "deviceid", "eventid", "type", "door", "cardnumber", "granted", "reason"}
+
+	index, columns := buildIndex(values, fields)
+
+	list := slices.Clone(events)
+	slices.SortFunc(list, func(p, q types.Event) int {
+		if p.SerialNumber != q.SerialNumber {
+			return int(p.SerialNumber) - int(q.SerialNumber)
+		}
+
+		return int(p.Index) - int(q.Index)
+	})
+
+	rows := [][]any{}
+	for _, e := range list {
+		row := make([]any, columns)
+
+		for i := range columns {
+			row[i] = ""
+		}
+
+		if ix, ok := index["timestamp"]; ok {
+			row[ix] = e.Timestamp.String()
+		}
+
+		if ix, ok := index["deviceid"]; ok {
+			row[ix] = fmt.Sprintf("'%v", uint32(e.SerialNumber))
+		}
+
+		if ix, ok := index["eventid"]; ok {
+			row[ix] = e.Index
+		}
+
+		if ix, ok := index["type"]; ok {
+			row[ix] = lookup("event.type", e.Type)
+		}
+
+		if ix, ok := index["door"]; ok {
+			row[ix] = e.Door
+		}
+
+		if ix, ok := index["cardnumber"]; ok && e.CardNumber != 0 {
+			row[ix] = e.CardNumber
+		}
+
+		if ix, ok := index["granted"]; ok {
+			if e.Granted {
+				row[ix] = "Y"
+			} else {
+				row[ix] = "N"
+			}
+		}
+
+		if ix, ok := index["reason"]; ok {
+			row[ix] = lookup("event.reason", e.Reason)
+		}
+
+		rows = append(rows, row)
+	}
+
+	infof("Appending %v events to worksheet", len(rows))
+
+	if err := backend.Append(cmd.area, rows, false); err != nil {
+		return fmt.Errorf("error writing events to worksheet (%w)", err)
+	}
+
+	return nil
+}
+
+func (e *eventIndices) load(file string) error {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	object := map[string]uint32{}
+	if err := json.Unmarshal(bytes, &object); err != nil {
+		return err
+	}
+
+	for k, v := range object {
+		if id, err := strconv.ParseUint(k, 10, 32); err != nil {
+			return fmt.Errorf("invalid controller ID '%v'", k)
+		} else {
+			(*e)[uint32(id)] = v
+		}
+	}
+
+	return nil
+}
+
+func (e eventIndices) store(file string) error {
+	dir := filepath.Dir(file)
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+
+	if bytes, err := json.MarshalIndent(e, "", "  "); err != nil {
+		return err
+	} else if err := os.WriteFile(file, bytes, 0660); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the dictionary text for an event type/reason code, defaulting to the code itself.
+func lookup(prefix string, code uint8) string {
+	if v, ok := locales.Lookup(fmt.Sprintf("%v.%v", prefix, code)); ok {
+		return v
+	}
+
+	return fmt.Sprintf("%v", code)
+}
@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func mkevent(deviceID uint32, index uint32, timestamp time.Time, card uint32, door uint8, granted bool) types.Event {
+	return types.Event{
+		SerialNumber: types.SerialNumber(deviceID),
+		Index:        index,
+		Type:         1,
+		Granted:      granted,
+		Door:         door,
+		Direction:    1,
+		CardNumber:   card,
+		Timestamp:    types.DateTime(timestamp),
+		Reason:       1,
+	}
+}
+
+func testEvents() (map[uint32]*simulated, time.Time) {
+	now := time.Now().Truncate(time.Second)
+	controllers := testControllers()
+
+	controllers[405419896].events = []types.Event{
+		mkevent(405419896, 1, now.Add(-3*time.Hour), 6001001, 1, true),
+		mkevent(405419896, 2, now.Add(-2*time.Hour), 6001002, 2, false),
+		mkevent(405419896, 3, now.Add(-1*time.Hour), 6001003, 3, true),
+	}
+
+	controllers[303986753].events = []types.Event{
+		mkevent(303986753, 101, now.Add(-90*time.Minute), 6001001, 4, true),
+	}
+
+	return controllers, now
+}
+
+func testEventsWorksheets() map[string][][]any {
+	return map[string][][]any{
+		"Events": [][]any{
+			[]any{"Timestamp", "Device ID", "Event ID", "Type", "Door", "Card Number", "Granted", "Reason"},
+		},
+	}
+}
+
+func testGetEvents(fake *fakeGoogle, sim *simulator, t *testing.T) *GetEvents {
+	return &GetEvents{
+		command:    fake.command(t, sim),
+		area:       "Events!A1:H",
+		retention:  30,
+		maxEvents:  1000,
+		lockMaxAge: time.Hour,
+	}
+}
+
+// Returns the device ID and event ID columns of the Events worksheet rows.
+func eventRows(fake *fakeGoogle) [][]any {
+	rows := [][]any{}
+	for _, row := range fake.values("Events")[1:] {
+		rows = append(rows, row[1:3])
+	}
+
+	return rows
+}
+
+func TestGetEvents(t *testing.T) {
+	controllers, now := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Timestamp", "Device ID", "Event ID", "Type", "Door", "Card Number", "Granted", "Reason"},
+		[]any{now.Add(-90 * time.Minute).Format("2006-01-02 15:04:05"), "303986753", "101", "card swipe", "4", "6001001", "Y", "swipe"},
+		[]any{now.Add(-3 * time.Hour).Format("2006-01-02 15:04:05"), "405419896", "1", "card swipe", "1", "6001001", "Y", "swipe"},
+		[]any{now.Add(-2 * time.Hour).Format("2006-01-02 15:04:05"), "405419896", "2", "card swipe", "2", "6001002", "N", "swipe"},
+		[]any{now.Add(-1 * time.Hour).Format("2006-01-02 15:04:05"), "405419896", "3", "card swipe", "3", "6001003", "Y", "swipe"},
+	}
+
+	if rows := fake.values("Events"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	indices := eventIndices{}
+	if err := indices.load(filepath.Join(cmd.workdir, ".google", fakeSpreadsheetID+".events")); err != nil {
+		t.Fatalf("Unexpected error reading event indices (%v)", err)
+	}
+
+	if expected := (eventIndices{405419896: 3, 303986753: 101}); !reflect.DeepEqual(indices, expected) {
+		t.Errorf("Incorrect event indices\n   expected:%v\n   got:     %v", expected, indices)
+	}
+}
+
+func TestGetEventsWithLockedRange(t *testing.T) {
+	controllers, _ := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+
+	file := lockFile(cmd.workdir, fakeSpreadsheetID, cmd.area)
+	l, err := acquireLock(file, fakeSpreadsheetID, cmd.area, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Errorf("Expected error executing get-events with the events range locked")
+	}
+
+	if rows := eventRows(fake); len(rows) != 0 {
+		t.Errorf("Unexpected events appended to locked range %v", rows)
+	}
+
+	// ... other events ranges are not locked
+	cmd.area = "Events!A1:I"
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Errorf("Unexpected error executing get-events (%v)", err)
+	}
+
+	l.release()
+}
+
+func TestGetEventsWithNewEvents(t *testing.T) {
+	controllers, now := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+	conf := sim.config(t)
+
+	if err := cmd.Execute(&Options{Config: conf}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	sim.controllers[405419896].events = append(sim.controllers[405419896].events,
+		mkevent(405419896, 4, now, 6001001, 1, true),
+		mkevent(405419896, 5, now, 6001002, 1, true))
+
+	if err := cmd.Execute(&Options{Config: conf}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "101"},
+		[]any{"405419896", "1"},
+		[]any{"405419896", "2"},
+		[]any{"405419896", "3"},
+		[]any{"405419896", "4"},
+		[]any{"405419896", "5"},
+	}
+
+	if rows := eventRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetEventsWithMaxEvents(t *testing.T) {
+	controllers, _ := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+	conf := sim.config(t)
+
+	cmd.maxEvents = 2
+
+	if err := cmd.Execute(&Options{Config: conf}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "101"},
+		[]any{"405419896", "2"},
+		[]any{"405419896", "3"},
+	}
+
+	if rows := eventRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetEventsWithOverwrittenEvents(t *testing.T) {
+	controllers, now := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+
+	if err := os.MkdirAll(filepath.Join(cmd.workdir, ".google"), 0770); err != nil {
+		t.Fatalf("Unexpected error creating workdir (%v)", err)
+	}
+
+	indices := eventIndices{405419896: 1, 303986753: 101}
+	if err := indices.store(filepath.Join(cmd.workdir, ".google", fakeSpreadsheetID+".events")); err != nil {
+		t.Fatalf("Unexpected error storing event indices (%v)", err)
+	}
+
+	sim.controllers[405419896].events = []types.Event{
+		mkevent(405419896, 7, now, 6001001, 1, true),
+		mkevent(405419896, 8, now, 6001002, 1, true),
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"405419896", "7"},
+		[]any{"405419896", "8"},
+	}
+
+	if rows := eventRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetEventsWithOfflineController(t *testing.T) {
+	controllers, _ := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+
+	sim.controllers[405419896].offline = true
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "101"},
+	}
+
+	if rows := eventRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetEventsWithRetention(t *testing.T) {
+	controllers, now := testEvents()
+	fake, _ := newFakeGoogle(t, testEventsWorksheets())
+	sim := newSimulator(controllers)
+	cmd := testGetEvents(fake, sim, t)
+
+	sim.controllers[405419896].events[0].Timestamp = types.DateTime(now.AddDate(0, 0, -45))
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing get-events (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "101"},
+		[]any{"405419896", "2"},
+		[]any{"405419896", "3"},
+	}
+
+	if rows := eventRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect events\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
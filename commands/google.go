@@ -1,21 +1,49 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
-	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
+type googleSheets struct {
+	spreadsheetId string
+	credentials   string
+	tokens        string
+	key           []byte // token encryption key (nil if the tokens are not encrypted)
+	endpoint      string
+	ctx           context.Context // context for the Google API requests (defaults to context.Background())
+	retry         retryPolicy
+	limiter       *rateLimiter // request budget shared by the Google Sheets and Google Drive clients
+	google        *sheets.Service
+	gdrive        *drive.Service
+	spreadsheet   *sheets.Spreadsheet
+}
+
 type revision struct {
 	FileID   string    `json:"file-id"`
 	ID       string    `json:"id"`
 	Modified time.Time `json:"modified"`
+	Hash     string    `json:"hash,omitempty"`
+	Pending  *pending  `json:"pending,omitempty"`
+}
+
+// Changed ACL hash (and when the change was first seen) for --change-detection content, which is only
+// loaded once the ACL has been unchanged for the --delay settling interval.
+type pending struct {
+	Hash  string    `json:"hash"`
+	Since time.Time `json:"since"`
 }
 
 func (r *revision) load(file string) error {
@@ -33,6 +61,8 @@ func (r *revision) load(file string) error {
 		r.FileID = object.FileID
 		r.ID = object.ID
 		r.Modified = object.Modified
+		r.Hash = object.Hash
+		r.Pending = object.Pending
 	}
 
 	return nil
@@ -54,11 +84,16 @@ func (r *revision) store(file string) error {
 	return nil
 }
 
+// Compares the spreadsheet revisions, ignoring the ACL hash.
 func (r *revision) sameAs(v *revision) bool {
-	return reflect.DeepEqual(r, v)
+	if r == nil || v == nil {
+		return r == v
+	}
+
+	return r.FileID == v.FileID && r.ID == v.ID && r.Modified.Equal(v.Modified)
 }
 
-func getRevision(gdrive *drive.Service, fileId string) (*revision, error) {
+func getRevision(ctx context.Context, gdrive *drive.Service, fileId string) (*revision, error) {
 	page := ""
 	latest := revision{
 		FileID:   fileId,
@@ -72,7 +107,7 @@ func getRevision(gdrive *drive.Service, fileId string) (*revision, error) {
 			call.PageToken(page)
 		}
 
-		revisions, err := call.Do()
+		revisions, err := call.Context(ctx).Do()
 		if err != nil {
 			return nil, err
 		}
@@ -101,14 +136,372 @@ func getRevision(gdrive *drive.Service, fileId string) (*revision, error) {
 	return &latest, nil
 }
 
-func clear(google *sheets.Service, spreadsheet *sheets.Spreadsheet, ranges []string) error {
+func newGoogleSheets(url, credentials, tokens string) (*googleSheets, error) {
+	match := regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(strings.TrimSpace(url))
+	if len(match) < 2 {
+		return nil, fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
+	}
+
+	return &googleSheets{
+		spreadsheetId: match[1],
+		credentials:   credentials,
+		tokens:        tokens,
+	}, nil
+}
+
+func (g *googleSheets) ID() string {
+	return g.spreadsheetId
+}
+
+func (g *googleSheets) Read(area string) ([][]any, error) {
+	google, err := g.service()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := google.Spreadsheets.Values.Get(g.spreadsheetId, area).Context(g.context()).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Values, nil
+}
+
+func (g *googleSheets) Write(data ...valueRange) error {
+	google, err := g.service()
+	if err != nil {
+		return err
+	}
+
+	rq := sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             []*sheets.ValueRange{},
+	}
+
+	for _, v := range data {
+		rq.Data = append(rq.Data, &sheets.ValueRange{
+			Range:  v.area,
+			Values: v.values,
+		})
+	}
+
+	if _, err := google.Spreadsheets.Values.BatchUpdate(g.spreadsheetId, &rq).Context(g.context()).Do(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (g *googleSheets) Append(area string, rows [][]any, overwrite bool) error {
+	google, err := g.service()
+	if err != nil {
+		return err
+	}
+
+	values := sheets.ValueRange{
+		Values: rows,
+	}
+
+	option := "INSERT_ROWS"
+	if overwrite {
+		option = "OVERWRITE"
+	}
+
+	if _, err := google.Spreadsheets.Values.Append(g.spreadsheetId, area, &values).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption(option).
+		Context(g.context()).
+		Do(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (g *googleSheets) Clear(areas ...string) error {
+	google, err := g.service()
+	if err != nil {
+		return err
+	}
+
 	rq := sheets.BatchClearValuesRequest{
-		Ranges: ranges,
+		Ranges: areas,
 	}
 
-	if _, err := google.Spreadsheets.Values.BatchClear(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
+	if _, err := google.Spreadsheets.Values.BatchClear(g.spreadsheetId, &rq).Context(g.context()).Do(); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (g *googleSheets) DeleteRows(area string, rows ...rowRange) error {
+	google, err := g.service()
+	if err != nil {
+		return err
+	}
+
+	sheet, err := g.sheet(area)
+	if err != nil {
+		return err
+	}
+
+	// ... delete from the bottom up so that the row indices remain valid
+	list := slices.Clone(rows)
+	slices.SortFunc(list, func(p, q rowRange) int {
+		switch {
+		case p.start > q.start:
+			return -1
+		case p.start < q.start:
+			return +1
+		default:
+			return 0
+		}
+	})
+
+	rq := sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{},
+	}
+
+	for _, r := range list {
+		rq.Requests = append(rq.Requests, &sheets.Request{
+			DeleteDimension: &sheets.DeleteDimensionRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    sheet.Properties.SheetId,
+					Dimension:  "ROWS",
+					StartIndex: r.start,
+					EndIndex:   r.end,
+				},
+			},
+		})
+	}
+
+	if len(rq.Requests) > 0 {
+		if _, err := google.Spreadsheets.BatchUpdate(g.spreadsheetId, &rq).Context(g.context()).Do(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *googleSheets) RowCount(area string) (int64, error) {
+	sheet, err := g.sheet(area)
+	if err != nil {
+		return 0, err
+	}
+
+	return sheet.Properties.GridProperties.RowCount, nil
+}
+
+func (g *googleSheets) Revision() (*revision, error) {
+	gdrive, err := g.drive()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := getRevision(g.context(), gdrive, g.spreadsheetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve spreadsheet revision (%v)", err)
+	}
+
+	return version, nil
+}
+
+// Returns the time zone from the spreadsheet properties.
+func (g *googleSheets) TimeZone() (*time.Location, error) {
+	if g.spreadsheet == nil {
+		google, err := g.service()
+		if err != nil {
+			return nil, err
+		}
+
+		spreadsheet, err := getSpreadsheet(g.context(), google, g.spreadsheetId)
+		if err != nil {
+			return nil, err
+		}
+
+		g.spreadsheet = spreadsheet
+	}
+
+	if g.spreadsheet.Properties == nil || g.spreadsheet.Properties.TimeZone == "" {
+		return nil, fmt.Errorf("spreadsheet time zone not set")
+	}
+
+	tz, err := time.LoadLocation(g.spreadsheet.Properties.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spreadsheet time zone '%v' (%v)", g.spreadsheet.Properties.TimeZone, err)
+	}
+
+	return tz, nil
+}
+
+func (g *googleSheets) Sheets() ([]string, error) {
+	if g.spreadsheet == nil {
+		google, err := g.service()
+		if err != nil {
+			return nil, err
+		}
+
+		spreadsheet, err := getSpreadsheet(g.context(), google, g.spreadsheetId)
+		if err != nil {
+			return nil, err
+		}
+
+		g.spreadsheet = spreadsheet
+	}
+
+	names := []string{}
+	for _, sheet := range g.spreadsheet.Sheets {
+		if sheet.Properties != nil {
+			names = append(names, sheet.Properties.Title)
+		}
+	}
+
+	return names, nil
+}
+
+// Verifies access to the spreadsheet, returning the spreadsheet title.
+func (g *googleSheets) checkSheets() (string, error) {
+	google, err := g.service()
+	if err != nil {
+		return "", err
+	}
+
+	spreadsheet, err := google.Spreadsheets.Get(g.spreadsheetId).Fields("spreadsheetId", "properties.title").Context(g.context()).Do()
+	if err != nil {
+		return "", err
+	}
+
+	if spreadsheet.Properties != nil {
+		return spreadsheet.Properties.Title, nil
+	}
+
+	return spreadsheet.SpreadsheetId, nil
+}
+
+// Verifies access to the spreadsheet revision history.
+func (g *googleSheets) checkDrive() error {
+	gdrive, err := g.drive()
+	if err != nil {
+		return err
+	}
+
+	if _, err := drive.NewRevisionsService(gdrive).List(g.spreadsheetId).PageSize(1).Context(g.context()).Do(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (g *googleSheets) service() (*sheets.Service, error) {
+	if g.google == nil {
+		client, err := authorize(g.credentials, SHEETS, g.tokens, g.key)
+		if err != nil {
+			//lint:ignore ST1005 Google should be capitalized
+			return nil, fmt.Errorf("Google Sheets authentication/authorization error (%w)", err)
+		}
+
+		google, err := sheets.NewService(g.context(), g.options(client)...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create new Google Sheets client (%w)", err)
+		}
+
+		g.google = google
+	}
+
+	return g.google, nil
+}
+
+func (g *googleSheets) drive() (*drive.Service, error) {
+	if g.gdrive == nil {
+		client, err := authorize(g.credentials, drive.DriveMetadataReadonlyScope, g.tokens, g.key)
+		if err != nil {
+			//lint:ignore ST1005 Google should be capitalized
+			return nil, fmt.Errorf("Google Drive authentication/authorization error (%w)", err)
+		}
+
+		gdrive, err := drive.NewService(g.context(), g.options(client)...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create new Google Drive client (%w)", err)
+		}
+
+		g.gdrive = gdrive
+	}
+
+	return g.gdrive, nil
+}
+
+func (g *googleSheets) context() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+
+	return g.ctx
+}
+
+func (g *googleSheets) options(client *http.Client) []option.ClientOption {
+	if g.limiter == nil {
+		g.limiter = newRateLimiter(g.retry.budget)
+	}
+
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	retrying := *client
+	retrying.Transport = &retryTransport{
+		transport: transport,
+		policy:    g.retry,
+		limiter:   g.limiter,
+	}
+
+	options := []option.ClientOption{
+		option.WithHTTPClient(&retrying),
+	}
+
+	if g.endpoint != "" {
+		options = append(options, option.WithEndpoint(g.endpoint))
+	}
+
+	return options
+}
+
+func (g *googleSheets) sheet(area string) (*sheets.Sheet, error) {
+	if g.spreadsheet == nil {
+		google, err := g.service()
+		if err != nil {
+			return nil, err
+		}
+
+		spreadsheet, err := getSpreadsheet(g.context(), google, g.spreadsheetId)
+		if err != nil {
+			return nil, err
+		}
+
+		g.spreadsheet = spreadsheet
+	}
+
+	return getSheet(g.spreadsheet, area)
+}
+
+func getSpreadsheet(ctx context.Context, google *sheets.Service, id string) (*sheets.Spreadsheet, error) {
+	spreadsheet, err := google.Spreadsheets.Get(id).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spreadsheet (%v)", err)
+	}
+
+	return spreadsheet, nil
+}
+
+func getSheet(spreadsheet *sheets.Spreadsheet, area string) (*sheets.Sheet, error) {
+	name := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(area)[1]
+	for _, sheet := range spreadsheet.Sheets {
+		if strings.EqualFold(strings.TrimSpace(sheet.Properties.Title), strings.TrimSpace(name)) {
+			return sheet, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to identify worksheet for '%s'", area)
+}
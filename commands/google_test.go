@@ -0,0 +1,1140 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jws"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// In-process stand-in for the subset of the Google Sheets v4 and Google Drive v3 APIs used
+// by the commands. Values are stored as they would be by Google Sheets with the USER_ENTERED
+// value input option and returned as formatted (string) values. Both APIs are served from the
+// same endpoint (the Sheets API paths start with /v4/spreadsheets and the Drive API paths with
+// /files).
+type fakeGoogle struct {
+	sync.Mutex
+	url       string
+	id        string
+	token     string
+	sheets    []*fakeSheet
+	revisions []*drive.Revision
+	requests  []string
+	key       *rsa.PrivateKey // service account key for the stand-in token endpoint
+	scopes    []string        // scopes requested from the stand-in token endpoint
+	timezone  string          // spreadsheet time zone
+	failures  []int           // HTTP status codes returned (in order) for the next API requests
+}
+
+type fakeSheet struct {
+	id int64
+	worksheet
+}
+
+const fakeSpreadsheetID = "1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"
+const fakeSpreadsheetURL = "https://docs.google.com/spreadsheets/d/" + fakeSpreadsheetID
+const fakeAccessToken = "ya29.fake-access-token"
+const fakeAuthCode = "4/0AfJohXfake-auth-code"
+
+// Minimum number of rows in a worksheet grid (Google Sheets creates new worksheets with 1000 rows).
+const fakeGridRows = 1000
+
+// Number of revisions returned per page by the revisions.list stand-in.
+const fakeRevisionsPage = 2
+
+func newFakeGoogle(t *testing.T, worksheets map[string][][]any) (*fakeGoogle, *googleSheets) {
+	f := fakeGoogle{
+		id:        fakeSpreadsheetID,
+		token:     fakeAccessToken,
+		sheets:    []*fakeSheet{},
+		revisions: []*drive.Revision{},
+		timezone:  "Europe/London",
+	}
+
+	id := int64(0)
+	for name, rows := range worksheets {
+		sheet := fakeSheet{
+			id: id,
+			worksheet: worksheet{
+				name: name,
+				rows: [][]cell{},
+			},
+		}
+
+		for i, row := range rows {
+			for j, v := range row {
+				sheet.set(i, j, v)
+			}
+		}
+
+		f.sheets = append(f.sheets, &sheet)
+		id += 1000
+	}
+
+	srv := httptest.NewServer(&f)
+	t.Cleanup(srv.Close)
+
+	f.url = srv.URL + "/"
+
+	// ... pre-authorised client
+	client := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: fakeAccessToken,
+		TokenType:   "Bearer",
+	}))
+
+	google := googleSheets{
+		spreadsheetId: fakeSpreadsheetID,
+		endpoint:      f.url,
+		retry: retryPolicy{
+			retries: 2,
+			backoff: 10 * time.Millisecond,
+		},
+	}
+
+	if service, err := sheets.NewService(context.Background(), google.options(client)...); err != nil {
+		t.Fatalf("Error creating Google Sheets client (%v)", err)
+	} else {
+		google.google = service
+	}
+
+	if service, err := drive.NewService(context.Background(), google.options(client)...); err != nil {
+		t.Fatalf("Error creating Google Drive client (%v)", err)
+	} else {
+		google.gdrive = service
+	}
+
+	return &f, &google
+}
+
+// Creates a credentials file and the Google Sheets and Google Drive token files for the
+// commands that authorise access using the 'authorise' command tokens.
+func (f *fakeGoogle) authorise(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials.json")
+	tokens := filepath.Join(dir, ".google")
+
+	installed := map[string]any{
+		"installed": map[string]any{
+			"client_id":     "fake-client-id.apps.googleusercontent.com",
+			"client_secret": "fake-client-secret",
+			"auth_uri":      f.url + "o/oauth2/auth",
+			"token_uri":     f.url + "token",
+			"redirect_uris": []string{"http://localhost"},
+		},
+	}
+
+	token := oauth2.Token{
+		AccessToken:  fakeAccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: "fake-refresh-token",
+		Expiry:       time.Now().Add(1 * time.Hour),
+	}
+
+	if bytes, err := json.Marshal(installed); err != nil {
+		t.Fatalf("Error creating credentials file (%v)", err)
+	} else if err := os.WriteFile(credentials, bytes, 0600); err != nil {
+		t.Fatalf("Error creating credentials file (%v)", err)
+	}
+
+	if err := os.MkdirAll(tokens, 0700); err != nil {
+		t.Fatalf("Error creating tokens directory (%v)", err)
+	}
+
+	for _, file := range []string{"credentials.sheets", "credentials.drive"} {
+		if bytes, err := json.Marshal(token); err != nil {
+			t.Fatalf("Error creating tokens file (%v)", err)
+		} else if err := os.WriteFile(filepath.Join(tokens, file), bytes, 0600); err != nil {
+			t.Fatalf("Error creating tokens file (%v)", err)
+		}
+	}
+
+	return credentials, tokens
+}
+
+// Creates a service account key file for a service account with access to the spreadsheet. The
+// key 'token_uri' is the stand-in token endpoint.
+func (f *fakeGoogle) serviceAccount(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating service account key (%v)", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error encoding service account key (%v)", err)
+	}
+
+	account := map[string]any{
+		"type":           "service_account",
+		"project_id":     "uhppoted",
+		"private_key_id": "fake-private-key-id",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "uhppoted@uhppoted.iam.gserviceaccount.com",
+		"client_id":      "123456789012345678901",
+		"token_uri":      f.url + "token",
+	}
+
+	credentials := filepath.Join(t.TempDir(), "service-account.json")
+	if bytes, err := json.Marshal(account); err != nil {
+		t.Fatalf("Error creating service account key file (%v)", err)
+	} else if err := os.WriteFile(credentials, bytes, 0600); err != nil {
+		t.Fatalf("Error creating service account key file (%v)", err)
+	}
+
+	f.Lock()
+	f.key = key
+	f.Unlock()
+
+	return credentials
+}
+
+// Stand-in for the OAuth2 token endpoint. Issues the fake access token for the JWT bearer grant used
+// by service accounts (if the assertion is signed with the service account key), for the
+// authorisation code grant used by the 'authorise' command (if the code is fakeAuthCode) and for
+// the refresh token grant (if the refresh token is the 'authorise' refresh token).
+func (f *fakeGoogle) oauthToken(w http.ResponseWriter, r *http.Request) {
+	invalid := func(description string) {
+		f.reply(w, http.StatusBadRequest, map[string]any{
+			"error":             "invalid_grant",
+			"error_description": description,
+		})
+	}
+
+	if err := r.ParseForm(); err != nil {
+		invalid(err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+		assertion := r.PostForm.Get("assertion")
+
+		if f.key == nil {
+			invalid("unknown service account")
+		} else if err := jws.Verify(assertion, &f.key.PublicKey); err != nil {
+			invalid("invalid JWT signature")
+		} else if claims, err := jws.Decode(assertion); err != nil {
+			invalid(err.Error())
+		} else {
+			f.scopes = append(f.scopes, claims.Scope)
+			f.reply(w, http.StatusOK, map[string]any{
+				"access_token": f.token,
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		}
+
+	case "authorization_code":
+		if r.PostForm.Get("code") != fakeAuthCode {
+			invalid("invalid authorisation code")
+		} else {
+			f.reply(w, http.StatusOK, map[string]any{
+				"access_token":  f.token,
+				"refresh_token": "fake-refresh-token",
+				"token_type":    "Bearer",
+				"expires_in":    3600,
+			})
+		}
+
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != "fake-refresh-token" {
+			invalid("Token has been expired or revoked.")
+		} else {
+			f.reply(w, http.StatusOK, map[string]any{
+				"access_token": f.token,
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		}
+
+	default:
+		invalid("unsupported grant type")
+	}
+}
+
+// Returns the common settings for a command that uses the stand-in Google APIs and the
+// (optional) simulated controllers.
+func (f *fakeGoogle) command(t *testing.T, u uhppote.IUHPPOTE) command {
+	credentials, tokens := f.authorise(t)
+
+	return command{
+		workdir:     t.TempDir(),
+		credentials: credentials,
+		tokens:      tokens,
+		url:         fakeSpreadsheetURL,
+		endpoint:    f.url,
+		iuhppote:    u,
+	}
+}
+
+func (f *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	path := r.URL.Path
+	sheetsAPI := "/v4/spreadsheets/" + f.id
+	driveAPI := "/files/" + f.id + "/revisions"
+
+	var reply any
+	var err error
+
+	if r.Method == http.MethodPost && path == "/token" {
+		f.requests = append(f.requests, "token")
+		f.oauthToken(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		f.reply(w, http.StatusUnauthorized, f.error(http.StatusUnauthorized, "UNAUTHENTICATED", "Request had invalid authentication credentials."))
+		return
+	}
+
+	if len(f.failures) > 0 {
+		status := f.failures[0]
+		f.failures = f.failures[1:]
+		f.requests = append(f.requests, fmt.Sprintf("%v", status))
+
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+
+		f.reply(w, status, f.error(status, http.StatusText(status), "simulated failure"))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == sheetsAPI:
+		f.requests = append(f.requests, "spreadsheets.get")
+		reply = f.spreadsheet()
+
+	case r.Method == http.MethodPost && path == sheetsAPI+":batchUpdate":
+		f.requests = append(f.requests, "spreadsheets.batchUpdate")
+		reply, err = f.batchUpdate(r)
+
+	case r.Method == http.MethodPost && path == sheetsAPI+"/values:batchUpdate":
+		f.requests = append(f.requests, "values.batchUpdate")
+		reply, err = f.valuesBatchUpdate(r)
+
+	case r.Method == http.MethodPost && path == sheetsAPI+"/values:batchClear":
+		f.requests = append(f.requests, "values.batchClear")
+		reply, err = f.valuesBatchClear(r)
+
+	case r.Method == http.MethodPost && strings.HasPrefix(path, sheetsAPI+"/values/") && strings.HasSuffix(path, ":append"):
+		f.requests = append(f.requests, "values.append")
+		area := strings.TrimSuffix(strings.TrimPrefix(path, sheetsAPI+"/values/"), ":append")
+		reply, err = f.valuesAppend(r, area)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, sheetsAPI+"/values/"):
+		f.requests = append(f.requests, "values.get")
+		reply, err = f.valuesGet(strings.TrimPrefix(path, sheetsAPI+"/values/"))
+
+	case r.Method == http.MethodGet && path == driveAPI:
+		f.requests = append(f.requests, "revisions.list")
+		reply, err = f.revisionsList(r)
+
+	default:
+		f.reply(w, http.StatusNotFound, f.error(http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("%v %v not found", r.Method, path)))
+		return
+	}
+
+	if err != nil {
+		f.reply(w, http.StatusBadRequest, f.error(http.StatusBadRequest, "INVALID_ARGUMENT", err.Error()))
+	} else {
+		f.reply(w, http.StatusOK, reply)
+	}
+}
+
+func (f *fakeGoogle) reply(w http.ResponseWriter, status int, reply any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (f *fakeGoogle) error(code int, status, message string) any {
+	return map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	}
+}
+
+func (f *fakeGoogle) spreadsheet() *sheets.Spreadsheet {
+	spreadsheet := sheets.Spreadsheet{
+		SpreadsheetId: f.id,
+		Properties: &sheets.SpreadsheetProperties{
+			Title:    "uhppoted-app-sheets",
+			TimeZone: f.timezone,
+		},
+		Sheets: []*sheets.Sheet{},
+	}
+
+	for _, s := range f.sheets {
+		spreadsheet.Sheets = append(spreadsheet.Sheets, &sheets.Sheet{
+			Properties: &sheets.SheetProperties{
+				SheetId: s.id,
+				Title:   s.name,
+				GridProperties: &sheets.GridProperties{
+					RowCount:    int64(max(fakeGridRows, len(s.rows))),
+					ColumnCount: 26,
+				},
+			},
+		})
+	}
+
+	return &spreadsheet
+}
+
+func (f *fakeGoogle) batchUpdate(r *http.Request) (any, error) {
+	var rq sheets.BatchUpdateSpreadsheetRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		return nil, err
+	}
+
+	for _, request := range rq.Requests {
+		if request.DeleteDimension == nil {
+			return nil, fmt.Errorf("unsupported request")
+		}
+
+		dimension := request.DeleteDimension.Range
+		if dimension.Dimension != "ROWS" {
+			return nil, fmt.Errorf("unsupported dimension '%v'", dimension.Dimension)
+		}
+
+		var sheet *fakeSheet
+		for _, s := range f.sheets {
+			if s.id == dimension.SheetId {
+				sheet = s
+			}
+		}
+
+		if sheet == nil {
+			return nil, fmt.Errorf("no grid with id: %v", dimension.SheetId)
+		}
+
+		start := int(dimension.StartIndex)
+		end := int(dimension.EndIndex)
+		if end == 0 || end > len(sheet.rows) {
+			end = len(sheet.rows)
+		}
+
+		if start < end {
+			sheet.rows = append(sheet.rows[:start], sheet.rows[end:]...)
+		}
+	}
+
+	return &sheets.BatchUpdateSpreadsheetResponse{SpreadsheetId: f.id}, nil
+}
+
+func (f *fakeGoogle) valuesGet(area string) (any, error) {
+	r, sheet, err := f.lookup(area)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sheets.ValueRange{
+		Range:          area,
+		MajorDimension: "ROWS",
+		Values:         f.read(r, sheet),
+	}, nil
+}
+
+func (f *fakeGoogle) valuesBatchUpdate(r *http.Request) (any, error) {
+	var rq sheets.BatchUpdateValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		return nil, err
+	}
+
+	if rq.ValueInputOption != "USER_ENTERED" {
+		return nil, fmt.Errorf("unsupported value input option '%v'", rq.ValueInputOption)
+	}
+
+	for _, v := range rq.Data {
+		r, sheet, err := f.lookup(v.Range)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, row := range v.Values {
+			for j, value := range row {
+				sheet.set(r.top+i, r.left+j, value)
+			}
+		}
+	}
+
+	return &sheets.BatchUpdateValuesResponse{SpreadsheetId: f.id}, nil
+}
+
+func (f *fakeGoogle) valuesBatchClear(r *http.Request) (any, error) {
+	var rq sheets.BatchClearValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		return nil, err
+	}
+
+	for _, area := range rq.Ranges {
+		r, sheet, err := f.lookup(area)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := r.top; i <= r.bottom && i < len(sheet.rows); i++ {
+			for j := r.left; j <= r.right && j < len(sheet.rows[i]); j++ {
+				sheet.rows[i][j] = cell{}
+			}
+		}
+	}
+
+	return &sheets.BatchClearValuesResponse{SpreadsheetId: f.id, ClearedRanges: rq.Ranges}, nil
+}
+
+func (f *fakeGoogle) valuesAppend(rq *http.Request, area string) (any, error) {
+	var values sheets.ValueRange
+	if err := json.NewDecoder(rq.Body).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	if option := rq.URL.Query().Get("valueInputOption"); option != "USER_ENTERED" {
+		return nil, fmt.Errorf("unsupported value input option '%v'", option)
+	}
+
+	r, sheet, err := f.lookup(area)
+	if err != nil {
+		return nil, err
+	}
+
+	top := r.top + len(f.read(r, sheet))
+
+	switch rq.URL.Query().Get("insertDataOption") {
+	case "INSERT_ROWS":
+		if top < len(sheet.rows) {
+			inserted := make([][]cell, len(values.Values))
+			sheet.rows = append(sheet.rows[:top], append(inserted, sheet.rows[top:]...)...)
+		}
+
+	case "OVERWRITE", "":
+
+	default:
+		return nil, fmt.Errorf("unsupported insert data option '%v'", rq.URL.Query().Get("insertDataOption"))
+	}
+
+	for i, row := range values.Values {
+		for j, value := range row {
+			sheet.set(top+i, r.left+j, value)
+		}
+	}
+
+	return &sheets.AppendValuesResponse{SpreadsheetId: f.id}, nil
+}
+
+func (f *fakeGoogle) revisionsList(r *http.Request) (any, error) {
+	start := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		if v, err := strconv.Atoi(token); err != nil {
+			return nil, fmt.Errorf("invalid page token '%v'", token)
+		} else {
+			start = v
+		}
+	}
+
+	end := min(start+fakeRevisionsPage, len(f.revisions))
+	list := drive.RevisionList{
+		Revisions: f.revisions[start:end],
+	}
+
+	if end < len(f.revisions) {
+		list.NextPageToken = fmt.Sprintf("%v", end)
+	}
+
+	return &list, nil
+}
+
+func (f *fakeGoogle) lookup(a string) (*area, *fakeSheet, error) {
+	r, err := parseArea(a)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse range: %v", a)
+	}
+
+	for _, s := range f.sheets {
+		if s.name == r.sheet {
+			return r, s, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("Unable to parse range: %v", a)
+}
+
+func (f *fakeGoogle) read(r *area, sheet *fakeSheet) [][]any {
+	rows := [][]any{}
+	for i := r.top; i <= r.bottom && i < len(sheet.rows); i++ {
+		row := []any{}
+		for j := r.left; j <= r.right && j < len(sheet.rows[i]); j++ {
+			row = append(row, sheet.rows[i][j].value)
+		}
+
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+
+		rows = append(rows, row)
+	}
+
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	return rows
+}
+
+func (f *fakeGoogle) values(name string) [][]any {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, s := range f.sheets {
+		if s.name == name {
+			return f.read(&area{sheet: name, right: 1<<31 - 1, bottom: 1<<31 - 1}, s)
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeGoogle) count(request string) int {
+	f.Lock()
+	defer f.Unlock()
+
+	count := 0
+	for _, rq := range f.requests {
+		if rq == request {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestGoogleRead(t *testing.T) {
+	_, google := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+			[]any{6001001, "2020-01-01", "2020-12-31", "Y"},
+			[]any{"'6001002", "2020-01-01", "2020-12-31", "N"},
+		},
+	})
+
+	expected := [][]any{
+		[]any{"6001001", "2020-01-01", "2020-12-31", "Y"},
+		[]any{"6001002", "2020-01-01", "2020-12-31", "N"},
+	}
+
+	if values, err := google.Read("ACL!A2:D"); err != nil {
+		t.Fatalf("Unexpected error reading worksheet (%v)", err)
+	} else if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Incorrect values\n   expected:%v\n   got:     %v", expected, values)
+	}
+
+	if _, err := google.Read("Report!A1:E"); err == nil {
+		t.Errorf("Expected error reading unknown worksheet")
+	}
+}
+
+func TestGoogleRevision(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{})
+
+	fake.revisions = []*drive.Revision{
+		{Id: "101", ModifiedTime: "2023-01-01T10:11:12.000Z"},
+		{Id: "103", ModifiedTime: "2023-01-03T10:11:12.000Z"},
+		{Id: "105", ModifiedTime: "2023-01-05T10:11:12.345Z"},
+		{Id: "104", ModifiedTime: "2023-01-04T10:11:12.000Z"},
+		{Id: "102", ModifiedTime: "2023-01-02T10:11:12.000Z"},
+	}
+
+	expected := revision{
+		FileID:   fakeSpreadsheetID,
+		ID:       "105",
+		Modified: time.Date(2023, time.January, 5, 10, 11, 12, 345000000, time.UTC),
+	}
+
+	r, err := google.Revision()
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving revision (%v)", err)
+	}
+
+	if !r.sameAs(&expected) {
+		t.Errorf("Incorrect revision\n   expected:%+v\n   got:     %+v", expected, *r)
+	}
+
+	if n := fake.count("revisions.list"); n != 3 {
+		t.Errorf("Incorrect number of revisions.list requests - expected:%v, got:%v", 3, n)
+	}
+}
+
+func TestGoogleRevisionWithoutRevisions(t *testing.T) {
+	_, google := newFakeGoogle(t, map[string][][]any{})
+
+	if _, err := google.Revision(); err == nil {
+		t.Errorf("Expected error retrieving revision for spreadsheet without revisions")
+	}
+}
+
+func TestGoogleUpdateLogSheet(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Log": [][]any{
+			[]any{"Timestamp", "Device ID", "Unchanged", "Updated", "Added", "Deleted", "Failed", "Errors"},
+		},
+		"Notes": [][]any{
+			[]any{"Something else entirely"},
+		},
+	})
+
+	cmd := LoadACL{
+		logRange: "Log!A1:H",
+	}
+
+	rpt := map[uint32]lib.Report{
+		405419896: lib.Report{
+			Unchanged: []uint32{6001001},
+			Updated:   []uint32{6001002},
+			Added:     []uint32{6001003, 6001004},
+		},
+		303986753: lib.Report{
+			Deleted: []uint32{6001005},
+			Errored: []uint32{6001006},
+		},
+	}
+
+	if err := cmd.updateLogSheet(google, rpt); err != nil {
+		t.Fatalf("Unexpected error updating log sheet (%v)", err)
+	}
+
+	rows := fake.values("Log")
+	if len(rows) != 3 {
+		t.Fatalf("Incorrect number of log rows - expected:%v, got:%v", 3, len(rows))
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "0", "0", "0", "1", "0", "1"},
+		[]any{"405419896", "1", "1", "2", "0", "0", "0"},
+	}
+
+	for i, row := range rows[1:] {
+		if _, err := time.ParseInLocation("2006-01-02 15:04:05", fmt.Sprintf("%v", row[0]), time.Local); err != nil {
+			t.Errorf("Invalid log timestamp '%v'", row[0])
+		}
+
+		if !reflect.DeepEqual(row[1:], expected[i]) {
+			t.Errorf("Incorrect log row\n   expected:%v\n   got:     %v", expected[i], row[1:])
+		}
+	}
+
+	if notes := fake.values("Notes"); !reflect.DeepEqual(notes, [][]any{[]any{"Something else entirely"}}) {
+		t.Errorf("Unrelated worksheet modified (%v)", notes)
+	}
+}
+
+func TestGooglePruneSheet(t *testing.T) {
+	now := time.Now()
+	recent := now.Format("2006-01-02 15:04:05")
+	old := now.AddDate(0, 0, -45).Format("2006-01-02 15:04:05")
+
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Log": [][]any{
+			[]any{"Timestamp", "Device ID"},
+			[]any{old, "405419896"},
+			[]any{old, "303986753"},
+			[]any{recent, "405419896"},
+			[]any{old, "405419896"},
+			[]any{recent, "303986753"},
+		},
+	})
+
+	expected := [][]any{
+		[]any{"Timestamp", "Device ID"},
+		[]any{recent, "405419896"},
+		[]any{recent, "303986753"},
+	}
+
+	if err := pruneSheet(google, "Log!A1:H", 30); err != nil {
+		t.Fatalf("Unexpected error pruning sheet (%v)", err)
+	}
+
+	if rows := fake.values("Log"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrectly pruned sheet\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if n := fake.count("spreadsheets.batchUpdate"); n != 1 {
+		t.Errorf("Incorrect number of spreadsheets.batchUpdate requests - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestGooglePruneSheetWithNothingToPrune(t *testing.T) {
+	recent := time.Now().Format("2006-01-02 15:04:05")
+
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Log": [][]any{
+			[]any{"Timestamp", "Device ID"},
+			[]any{recent, "405419896"},
+		},
+	})
+
+	if err := pruneSheet(google, "Log!A1:H", 30); err != nil {
+		t.Fatalf("Unexpected error pruning sheet (%v)", err)
+	}
+
+	if n := fake.count("spreadsheets.batchUpdate"); n != 0 {
+		t.Errorf("Unexpected spreadsheets.batchUpdate request")
+	}
+}
+
+func TestGoogleUpdateReportSheet(t *testing.T) {
+	now := time.Now()
+	old := now.AddDate(0, 0, -30).Format("2006-01-02 15:04:05")
+	recent := now.Add(-time.Minute).Format("2006-01-02 15:04:05")
+
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Report": [][]any{
+			[]any{"Timestamp", "Action", "Card Number"},
+			[]any{old, "Added", "6001000"},
+			[]any{recent, "Deleted", "6001009"},
+		},
+	})
+
+	cmd := LoadACL{
+		reportRange:     "Report!A1:E",
+		reportRetention: 7,
+	}
+
+	rpt := map[uint32]lib.Report{
+		405419896: lib.Report{
+			Added:   []uint32{6001003},
+			Deleted: []uint32{6001005},
+		},
+	}
+
+	if err := cmd.updateReportSheet(google, rpt, nil); err != nil {
+		t.Fatalf("Unexpected error updating report sheet (%v)", err)
+	}
+
+	actions := []string{}
+	for _, row := range fake.values("Report")[1:] {
+		actions = append(actions, fmt.Sprintf("%v:%v", row[1], row[2]))
+	}
+
+	expected := []string{"Deleted:6001009", "Added:6001003", "Deleted:6001005"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Incorrect report\n   expected:%v\n   got:     %v", expected, actions)
+	}
+}
+
+func TestGoogleCompareACLWrite(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Audit": [][]any{
+			[]any{"2020-01-01 00:00:00"},
+			[]any{"Device", "Updated", "Added", "Deleted"},
+			[]any{"405419896", "6001000", "", ""},
+			[]any{"303986753", "6001009", "", ""},
+		},
+	})
+
+	cmd := CompareACL{
+		report: "Audit!A1:D",
+	}
+
+	diff := lib.SystemDiff{
+		405419896: lib.Diff{
+			Updated: []types.Card{{CardNumber: 6001001}},
+			Added:   []types.Card{{CardNumber: 6001002}, {CardNumber: 6001003}},
+		},
+		303986753: lib.Diff{
+			Deleted: []types.Card{{CardNumber: 6001004}},
+		},
+	}
+
+	if err := cmd.write(google, &diff, nil); err != nil {
+		t.Fatalf("Unexpected error writing compare report (%v)", err)
+	}
+
+	rows := fake.values("Audit")
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "-", "-", "6001004"},
+		[]any{},
+		[]any{"405419896", "6001001", "6001002", "-"},
+		[]any{"", "", "6001003"},
+	}
+
+	if len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if title := fmt.Sprintf("%v", rows[0][0]); strings.HasPrefix(title, "2020") {
+		t.Errorf("Report timestamp not updated (%v)", title)
+	}
+}
+
+func TestGoogleUploadACL(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Uploaded": [][]any{
+			[]any{"2020-01-01 00:00:00"},
+			[]any{"Card Number", "From", "To", "Side Door", "Great Hall"},
+			[]any{"6001000", "2020-01-01", "2020-12-31", "Y", "Y"},
+			[]any{"6001009", "2020-01-01", "2020-12-31", "N", "Y"},
+			[]any{"6001010", "2020-01-01", "2020-12-31", "N", "N"},
+		},
+	})
+
+	cmd := UploadACL{
+		acl: "Uploaded!A1:E",
+	}
+
+	table := lib.Table{
+		Header: []string{"Card Number", "From", "To", "Great Hall", "Side Door"},
+		Records: [][]string{
+			{"6001001", "2023-01-01", "2023-12-31", "Y", "N"},
+			{"6001002", "2023-01-01", "2023-12-31", "N", "Y"},
+		},
+	}
+
+	if err := cmd.upload(google, &table); err != nil {
+		t.Fatalf("Unexpected error uploading ACL (%v)", err)
+	}
+
+	rows := fake.values("Uploaded")
+	expected := [][]any{
+		[]any{"Card Number", "From", "To", "Side Door", "Great Hall"},
+		[]any{"6001001", "2023-01-01", "2023-12-31", "N", "Y"},
+		[]any{"6001002", "2023-01-01", "2023-12-31", "Y", "N"},
+	}
+
+	if len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect uploaded ACL\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if title := fmt.Sprintf("%v", rows[0][0]); strings.HasPrefix(title, "2020") {
+		t.Errorf("Upload timestamp not updated (%v)", title)
+	}
+}
+
+func TestGoogleWithInvalidToken(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+		},
+	})
+
+	fake.token = "ya29.some-other-token"
+
+	if _, err := google.Read("ACL!A1:D"); err == nil {
+		t.Errorf("Expected error reading worksheet with invalid access token")
+	}
+}
+
+func TestGetCommand(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall", "Side Door"},
+			[]any{"6001001", "2023-01-01", "2023-12-31", "Y", "N"},
+			[]any{"6001002", "2023-02-03", "2023-11-30", "N", "Y"},
+		},
+	})
+
+	credentials, tokens := fake.authorise(t)
+	file := filepath.Join(t.TempDir(), "acl.tsv")
+
+	cmd := Get{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+		area: "ACL!A1:E",
+		file: file,
+	}
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing 'get' command (%v)", err)
+	}
+
+	expected := `Card Number	From	To	Great Hall	Side Door
+6001001	2023-01-01	2023-12-31	Y	N
+6001002	2023-02-03	2023-11-30	N	Y
+`
+
+	if bytes, err := os.ReadFile(file); err != nil {
+		t.Fatalf("Error reading TSV file (%v)", err)
+	} else if string(bytes) != expected {
+		t.Errorf("Incorrect TSV\n   expected: %s\n   got:      %s\n", expected, string(bytes))
+	}
+}
+
+func TestPutCommand(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+			[]any{"6001000", "2020-01-01", "2020-12-31", "Y"},
+			[]any{"6001009", "2020-01-01", "2020-12-31", "Y"},
+			[]any{"6001010", "2020-01-01", "2020-12-31", "Y"},
+		},
+	})
+
+	credentials, tokens := fake.authorise(t)
+	file := filepath.Join(t.TempDir(), "acl.tsv")
+	tsv := `Card Number	From	To	Great Hall	Side Door
+6001001	2023-01-01	2023-12-31	Y	N
+6001002	2023-02-03	2023-11-30	N	Y
+`
+
+	if err := os.WriteFile(file, []byte(tsv), 0600); err != nil {
+		t.Fatalf("Error creating TSV file (%v)", err)
+	}
+
+	cmd := Put{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+		area: "ACL!A1:E",
+		file: file,
+	}
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing 'put' command (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Card Number", "From", "To", "Great Hall", "Side Door"},
+		[]any{"6001001", "2023-01-01", "2023-12-31", "Y", "N"},
+		[]any{"6001002", "2023-02-03", "2023-11-30", "N", "Y"},
+	}
+
+	if rows := fake.values("ACL"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect worksheet\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetCommandWithoutTokens(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+		},
+	})
+
+	credentials, _ := fake.authorise(t)
+
+	cmd := Get{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      t.TempDir(),
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+		area: "ACL!A1:E",
+		file: filepath.Join(t.TempDir(), "acl.tsv"),
+	}
+
+	if err := cmd.Execute(&Options{}); err == nil {
+		t.Errorf("Expected error executing 'get' command without authorisation tokens")
+	}
+
+	if n := fake.count("values.get"); n != 0 {
+		t.Errorf("Unexpected request to Google Sheets without authorisation tokens")
+	}
+}
+
+func TestGetCommandWithServiceAccount(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+			[]any{"6001001", "2023-01-01", "2023-12-31", "Y"},
+		},
+	})
+
+	file := filepath.Join(t.TempDir(), "acl.tsv")
+
+	cmd := Get{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: fake.serviceAccount(t),
+			tokens:      t.TempDir(),
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+		area: "ACL!A1:D",
+		file: file,
+	}
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error executing 'get' command (%v)", err)
+	}
+
+	expected := `Card Number	From	To	Great Hall
+6001001	2023-01-01	2023-12-31	Y
+`
+
+	if bytes, err := os.ReadFile(file); err != nil {
+		t.Fatalf("Error reading TSV file (%v)", err)
+	} else if string(bytes) != expected {
+		t.Errorf("Incorrect TSV\n   expected: %s\n   got:      %s\n", expected, string(bytes))
+	}
+
+	if !reflect.DeepEqual(fake.scopes, []string{SHEETS}) {
+		t.Errorf("Incorrect service account scopes\n   expected:%v\n   got:     %v", []string{SHEETS}, fake.scopes)
+	}
+}
+
+func TestServiceAccountWithInvalidKey(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+		},
+	})
+
+	credentials := fake.serviceAccount(t)
+
+	// ... replace the key known to the token endpoint
+	fake.serviceAccount(t)
+
+	google, err := newGoogleSheets(fakeSpreadsheetURL, credentials, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	google.endpoint = fake.url
+
+	if _, err := google.Read("ACL!A1:D"); err == nil {
+		t.Errorf("Expected error reading worksheet with invalid service account key")
+	}
+
+	if n := fake.count("values.get"); n != 0 {
+		t.Errorf("Unexpected request to Google Sheets with invalid service account key")
+	}
+}
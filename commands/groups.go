@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// Door permissions for the groups defined on the Groups worksheet, used to expand ACL rows that specify
+// a group rather than the individual door permissions. Keyed by the normalised group name and door.
+type groups map[string]map[string]string
+
+// Reads the group door permissions from the groups worksheet, which has a 'Group' column and a column
+// for each door. The door cells contain the same Y, N, time profile ID or time profile name permissions
+// as the ACL.
+func getGroups(backend Backend, area string) (groups, error) {
+	values, err := backend.Read(area)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve groups from sheet (%v)", err)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no data in groups spreadsheet/range")
+	}
+
+	header := []string{}
+	for _, v := range values[0] {
+		header = append(header, normalise(fmt.Sprintf("%v", v)))
+	}
+
+	column := slices.Index(header, "group")
+	if column < 0 {
+		return nil, fmt.Errorf("missing 'Group' column in groups worksheet")
+	}
+
+	list := groups{}
+
+	for row, record := range values[1:] {
+		name := clean(value(record, column))
+		if name == "" {
+			continue
+		}
+
+		if _, ok := list[normalise(name)]; ok {
+			return nil, fmt.Errorf("groups row %v: duplicate group '%v'", row+2, name)
+		}
+
+		doors := map[string]string{}
+		for ix, door := range header {
+			if ix != column && door != "" {
+				doors[door] = clean(value(record, ix))
+			}
+		}
+
+		list[normalise(name)] = doors
+	}
+
+	return list, nil
+}
+
+// Replaces the ACL 'Group' column with the group door permissions. A door cell that is not blank in the
+// ACL overrides the group permission for that door, and a door that is not defined for the group is left
+// as is. Rows with a blank group are unchanged.
+func (g groups) expand(table *lib.Table) error {
+	column := slices.IndexFunc(table.Header, func(h string) bool { return normalise(h) == "group" })
+	if column < 0 {
+		return nil
+	}
+
+	doors := map[int]string{}
+	for _, ix := range doorColumns(table.Header) {
+		if ix != column {
+			doors[ix] = normalise(table.Header[ix])
+		}
+	}
+
+	for row, record := range table.Records {
+		if column >= len(record) {
+			continue
+		}
+
+		name := clean(record[column])
+		if name == "" {
+			continue
+		}
+
+		permissions, ok := g[normalise(name)]
+		if !ok {
+			return fmt.Errorf("row %v: unknown group '%v'", row+1, name)
+		}
+
+		for ix, door := range doors {
+			if ix < len(record) && clean(record[ix]) == "" {
+				if v, ok := permissions[door]; ok {
+					record[ix] = v
+				}
+			}
+		}
+	}
+
+	// ... remove 'Group' column
+	table.Header = slices.Delete(table.Header, column, column+1)
+
+	for i, record := range table.Records {
+		if column < len(record) {
+			table.Records[i] = slices.Delete(record, column, column+1)
+		}
+	}
+
+	return nil
+}
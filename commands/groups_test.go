@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/uhppoted/uhppote-core/types"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+func testGroupWorksheets(acl ...[]any) map[string][][]any {
+	worksheets := testWorksheets()
+
+	worksheets["ACL"] = append([][]any{
+		[]any{"Card Number", "PIN", "From", "To", "Group", "Front Door", "Side Door", "Great Hall", "Kitchen"},
+	}, acl...)
+
+	worksheets["Groups"] = [][]any{
+		[]any{"Group", "Front Door", "Side Door", "Great Hall", "Kitchen"},
+		[]any{"Students", "Y", "N", "Y", "N"},
+		[]any{"Staff", "Y", "Y", "Y", "Weekdays 8-6"},
+	}
+
+	return worksheets
+}
+
+func TestGroupsExpand(t *testing.T) {
+	g := groups{
+		"students": {"frontdoor": "Y", "sidedoor": "N", "greathall": "Y"},
+	}
+
+	table := lib.Table{
+		Header: []string{"Card Number", "From", "To", "Group", "Front Door", "Side Door", "Great Hall", "Kitchen"},
+		Records: [][]string{
+			[]string{"6001001", "2023-01-01", "2023-12-31", "Students", "", "", "", ""},
+			[]string{"6001002", "2023-01-01", "2023-12-31", "students", "N", "", "", "Y"},
+			[]string{"6001003", "2023-01-01", "2023-12-31", "", "N", "Y", "N", "N"},
+		},
+	}
+
+	if err := g.expand(&table); err != nil {
+		t.Fatalf("Unexpected error expanding groups (%v)", err)
+	}
+
+	expected := lib.Table{
+		Header: []string{"Card Number", "From", "To", "Front Door", "Side Door", "Great Hall", "Kitchen"},
+		Records: [][]string{
+			[]string{"6001001", "2023-01-01", "2023-12-31", "Y", "N", "Y", ""},
+			[]string{"6001002", "2023-01-01", "2023-12-31", "N", "N", "Y", "Y"},
+			[]string{"6001003", "2023-01-01", "2023-12-31", "N", "Y", "N", "N"},
+		},
+	}
+
+	if !reflect.DeepEqual(table, expected) {
+		t.Errorf("Incorrect expanded table\n   expected:%v\n   got:     %v", expected, table)
+	}
+}
+
+func TestLoadACLWithGroups(t *testing.T) {
+	worksheets := testGroupWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Students"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Students", "N", "", "", "Y"},
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "", "N", "Y", "N", "Y"},
+	)
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "ACL!A1:I"
+	cmd.groups = "Groups!A1:E"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 1, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+}
+
+func TestLoadACLWithGroupTimeProfiles(t *testing.T) {
+	worksheets := testGroupWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Staff"},
+	)
+	worksheets["TimeProfiles"] = testTimeProfiles()
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[303986753].profiles = map[uint8]types.TimeProfile{29: types.TimeProfile{ID: 29}}
+	sim := newSimulator(controllers)
+
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "ACL!A1:I"
+	cmd.groups = "Groups!A1:E"
+	cmd.timeProfiles = "TimeProfiles!A1:B"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 1, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 29, 0, 0))
+}
+
+func TestLoadACLWithUnknownGroup(t *testing.T) {
+	worksheets := testGroupWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Visitors"},
+	)
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "ACL!A1:I"
+	cmd.groups = "Groups!A1:E"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with unknown group")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+}
+
+func TestCompareACLWithGroups(t *testing.T) {
+	worksheets := testGroupWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Students"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Students", "", "", "N"},
+	)
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := CompareACL{
+		command: fake.command(t, sim),
+		acl:     "ACL!A1:I",
+		groups:  "Groups!A1:E",
+		report:  "Audit!A1:D",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing compare-acl (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "6001001", "6001002", "-"},
+		[]any{},
+		[]any{"405419896", "6001002", "-", "6001003"},
+	}
+
+	if rows := fake.values("Audit"); len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
@@ -4,21 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"maps"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"google.golang.org/api/drive/v3"
-	"google.golang.org/api/option"
-	"google.golang.org/api/sheets/v4"
-
 	"github.com/uhppoted/uhppote-core/uhppote"
 	lib "github.com/uhppoted/uhppoted-lib/acl"
 	"github.com/uhppoted/uhppoted-lib/config"
-	"github.com/uhppoted/uhppoted-lib/lockfile"
 )
 
 var LoadACLCmd = LoadACL{
@@ -27,6 +24,8 @@ var LoadACLCmd = LoadACL{
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
 
@@ -41,11 +40,21 @@ var LoadACLCmd = LoadACL{
 	noreport:    false,
 	reportRange: "Report!A1:E",
 
-	force:     false,
-	strict:    false,
-	dryrun:    false,
-	delay:     15 * time.Minute,
-	revisions: filepath.Join(DEFAULT_WORKDIR, ".google", "uhppoted-app-sheets.revision"),
+	force:      false,
+	strict:     false,
+	dryrun:     false,
+	delay:      15 * time.Minute,
+	snapshots:  10,
+	lockMaxAge: 2 * time.Hour,
+
+	changeDetection: "revision",
+	revisions:       filepath.Join(DEFAULT_WORKDIR, ".google", "uhppoted-app-sheets.revision"),
+
+	workers: workers{
+		concurrency: 4,
+		timeout:     5 * time.Minute,
+		retries:     2,
+	},
 }
 
 type LoadACL struct {
@@ -54,6 +63,8 @@ type LoadACL struct {
 	config          string
 	withPIN         bool
 	area            string
+	timeProfiles    string
+	groups          string
 	nolog           bool
 	logRange        string
 	logRetention    int
@@ -64,7 +75,19 @@ type LoadACL struct {
 	strict          bool
 	dryrun          bool
 	delay           time.Duration
+	maxDeletes      string
+	snapshots       int
+	changeDetection string
 	revisions       string
+	lockMaxAge      time.Duration
+	workers         workers
+}
+
+// Limit on the number of cards that can be deleted from a controller by a single load, either as an
+// absolute number of cards or as a percentage of the cards currently on the controller.
+type maxDeletes struct {
+	count   int
+	percent float64
 }
 
 func (cmd *LoadACL) Name() string {
@@ -76,7 +99,7 @@ func (cmd *LoadACL) Description() string {
 }
 
 func (cmd *LoadACL) Usage() string {
-	return "--credentials <file> --url <url>"
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
 }
 
 func (cmd *LoadACL) Help() {
@@ -87,8 +110,23 @@ func (cmd *LoadACL) Help() {
 	fmt.Println("  is specified updates will be silently ignored (no log and no report) if the spreadsheet revision has not changed or the updated")
 	fmt.Println("  spreadsheet contains no relevant changes.")
 	fmt.Println()
+	fmt.Println("  With --change-detection content, the ACL is only reloaded if a hash of the ACL range has changed since the last load, ignoring")
+	fmt.Println("  changes to the rest of the spreadsheet (and without requiring access to the Google Drive revision history). A changed ACL")
+	fmt.Println("  is only loaded once it has been unchanged for the --delay settling interval (measured from the first check that found the")
+	fmt.Println("  change).")
+	fmt.Println()
 	fmt.Println("  Duplicate card numbers are automatically deleted across the system unless the --strict option is provided to fail the load.")
 	fmt.Println()
+	fmt.Println("  The ACL can be split across multiple worksheets (e.g. Staff, Students and Contractors) by specifying a list of ranges or a")
+	fmt.Println("  worksheet name pattern with --range. The worksheets are merged into a single ACL - a card that is listed on more than one")
+	fmt.Println("  worksheet with conflicting permissions is treated as a duplicate card number.")
+	fmt.Println()
+	fmt.Println("  The --max-deletes option aborts the load (unless --force is specified) if it would delete more than the number or percentage")
+	fmt.Println("  of cards on any controller.")
+	fmt.Println()
+	fmt.Println("  The current controller cards are saved as a snapshot in <workdir>/snapshots before the controllers are updated and can be")
+	fmt.Println("  restored with the 'rollback' command.")
+	fmt.Println()
 
 	helpOptions(cmd.FlagSet())
 
@@ -102,17 +140,38 @@ func (cmd *LoadACL) Help() {
 	fmt.Println(`                                                            --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
 	fmt.Println(`                                                            --range "ACL!A2:E" \`)
 	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets load-acl --file "site.xlsx" --range "ACL!A2:E"`)
+	fmt.Println(`    uhppote-app-sheets load-acl --file "site.xlsx" --range "Staff!A2:E,Students!A2:E"`)
+	fmt.Println()
 }
 
 func (cmd *LoadACL) FlagSet() *flag.FlagSet {
 	flagset := cmd.flagset("load-acl")
 
-	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range e.g. 'ACL!A2:E'")
-	flagset.BoolVar(&cmd.withPIN, "with-pin", cmd.withPIN, "Updates card keypad PIN codes when loading an ACL")
+	cmd.flags(flagset)
+
 	flagset.BoolVar(&cmd.force, "force", cmd.force, "Forces an update, overriding the spreadsheet version and compare logic")
+
+	return flagset
+}
+
+// Adds the load-acl options shared with the 'run' command to a flagset.
+func (cmd *LoadACL) flags(flagset *flag.FlagSet) {
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range e.g. 'ACL!A2:E', or a comma separated list of ranges (e.g. 'Staff!A2:E,Students!A2:E') in which the worksheet name may be a pattern e.g. '*!A2:E'")
+	flagset.StringVar(&cmd.timeProfiles, "time-profiles", cmd.timeProfiles, "Spreadsheet range of the time profiles worksheet for door time profiles specified by name e.g. 'TimeProfiles!A1:B'")
+	flagset.StringVar(&cmd.groups, "groups", cmd.groups, "Spreadsheet range of the groups worksheet for ACL rows that specify a group e.g. 'Groups!A1:F'")
+	flagset.BoolVar(&cmd.withPIN, "with-pin", cmd.withPIN, "Updates card keypad PIN codes when loading an ACL")
 	flagset.BoolVar(&cmd.strict, "strict", cmd.strict, "Fails with an error if the spreadsheet contains duplicate card numbers")
 	flagset.BoolVar(&cmd.dryrun, "dry-run", cmd.dryrun, "Simulates a load-acl without making any changes to the access controllers")
 	flagset.DurationVar(&cmd.delay, "delay", cmd.delay, "Sets the delay between when a spreadsheet is modified and when it is regarded as sufficiently stable to use")
+	flagset.StringVar(&cmd.maxDeletes, "max-deletes", cmd.maxDeletes, "Aborts the load if more than this number (e.g. 50) or percentage (e.g. 10%) of the cards would be deleted from a controller")
+	flagset.StringVar(&cmd.changeDetection, "change-detection", cmd.changeDetection, "Detects changes to the ACL from the spreadsheet 'revision' or from the ACL 'content'")
+	flagset.IntVar(&cmd.snapshots, "snapshots", cmd.snapshots, "Number of pre-load controller ACL snapshots to keep for 'rollback' (0 disables snapshots)")
+
+	flagset.DurationVar(&cmd.lockMaxAge, "lock-max-age", cmd.lockMaxAge, "Age after which a lockfile from another host that has not been refreshed is regarded as stale and reclaimed (0 to never reclaim)")
+
+	cmd.workers.flags(flagset)
 
 	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing a summary to the 'log' worksheet")
 	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
@@ -121,8 +180,6 @@ func (cmd *LoadACL) FlagSet() *flag.FlagSet {
 	flagset.BoolVar(&cmd.noreport, "no-report", cmd.noreport, "Disables writing a report to the 'report' worksheet")
 	flagset.StringVar(&cmd.reportRange, "report-range", cmd.reportRange, "Spreadsheet range for load report")
 	flagset.IntVar(&cmd.reportRetention, "report-retention", cmd.reportRetention, "Report sheet records older than 'report-retention' days are automatically pruned")
-
-	return flagset
 }
 
 func (cmd *LoadACL) Execute(args ...any) error {
@@ -136,74 +193,87 @@ func (cmd *LoadACL) Execute(args ...any) error {
 		return err
 	}
 
-	// ... locked?
-	lockFile := config.Lockfile{
-		File:   filepath.Join(cmd.workdir, ".google", "uhppoted-app-sheets.lock"),
-		Remove: lockfile.RemoveLockfile,
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
 	}
 
-	if kraken, err := lockfile.MakeLockFile(lockFile); err != nil {
+	u, devices := cmd.controllers(conf)
+
+	ctx := options.context()
+
+	backend, err := cmd.backend(ctx)
+	if err != nil {
 		return err
-	} else {
-		defer func() {
-			infof("Removing lockfile '%v'", lockFile.File)
-			kraken.Release()
-		}()
 	}
 
-	// ... good to go!
-	conf := config.NewConfig()
-	if err := conf.Load(cmd.config); err != nil {
-		return fmt.Errorf("could not load configuration (%v)", err)
+	// ... locked?
+	if lock, err := cmd.lock(backend, cmd.area, cmd.lockMaxAge); err != nil {
+		return err
+	} else {
+		defer lock.release()
 	}
 
-	u, devices := getDevices(conf, cmd.debug)
+	if err := cmd.load(ctx, u, devices, backend); err != nil {
+		if ctx.Err() != nil {
+			cmd.logCancelled(ctx)
+		}
 
-	match := regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(strings.TrimSpace(cmd.url))
-	if len(match) < 2 {
-		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
+		return err
 	}
 
-	spreadsheetId := match[1]
-	cmd.revisions = filepath.Join(cmd.workdir, ".google", fmt.Sprintf("%s.revision", spreadsheetId))
+	return nil
+}
+
+// Updates the controllers from the ACL worksheet if the spreadsheet has been revised since the last load
+// (or unconditionally with --force).
+func (cmd *LoadACL) load(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, backend Backend) error {
+	cmd.revisions = filepath.Join(cmd.workdir, ".google", fmt.Sprintf("%s.revision", backend.ID()))
 
 	if cmd.debug {
-		debugf("Spreadsheet - ID:%s  range:%s  log:%s", spreadsheetId, cmd.area, cmd.logRange)
+		debugf("Spreadsheet - ID:%s  range:%s  log:%s", backend.ID(), cmd.area, cmd.logRange)
 	}
 
-	version, err := cmd.getRevision(spreadsheetId)
-	if err != nil {
-		errorf("%v", err)
-	}
+	var version *revision
+	var err error
 
-	if !cmd.force && !cmd.revised(version) {
-		infof("Nothing to do")
-		return nil
-	}
+	if cmd.changeDetection != "content" {
+		if version, err = backend.Revision(); err != nil {
+			errorf("%v", err)
+		}
 
-	// ... authorise
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
+		if !cmd.force && !cmd.revised(version) {
+			infof("Nothing to do")
+			return nil
+		}
 	}
 
-	client, err := authorize(cmd.credentials, SHEETS, tokens)
+	table, sources, err := getACLTable(backend, cmd.area, cmd.groups, cmd.timeProfiles)
 	if err != nil {
-		//lint:ignore ST1005 Google should be capitalized
-		return fmt.Errorf("Google Sheets authentication/authorization error (%w)", err)
+		return err
 	}
 
-	google, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
+	hash, err := hashTable(table)
 	if err != nil {
-		return fmt.Errorf("unable to create new Google Sheets client (%w)", err)
+		return err
 	}
 
-	spreadsheet, err := getSpreadsheet(google, spreadsheetId)
-	if err != nil {
-		return err
+	if cmd.changeDetection == "content" {
+		version = &revision{
+			FileID: backend.ID(),
+		}
+
+		if !cmd.force && !cmd.changed(hash) {
+			return nil
+		}
+	}
+
+	if version != nil {
+		version.Hash = hash
 	}
 
-	list, warnings, err := cmd.getACL(google, spreadsheet, devices)
+	list, warnings, err := cmd.parseTable(table, devices)
 	if err != nil {
 		return err
 	}
@@ -216,87 +286,192 @@ func (cmd *LoadACL) Execute(args ...any) error {
 		infof("%v  Downloaded %v records", k, len(l))
 	}
 
-	updated, err := cmd.compare(u, devices, list)
+	// ... exclude other commands updating the same controllers (e.g. rollback) until loaded
+	if locks, err := cmd.lockControllers(devices, cmd.lockMaxAge); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	current, diff, unavailable, err := cmd.compare(ctx, u, devices, list)
 	if err != nil {
 		return err
 	}
 
-	if cmd.force || updated {
-		f := func(u uhppote.IUHPPOTE, list lib.ACL) (map[uint32]lib.Report, []error) {
-			if cmd.withPIN {
-				return lib.PutACLWithPIN(u, list, cmd.dryrun)
-			} else {
-				return lib.PutACL(u, list, cmd.dryrun)
-			}
-		}
+	if err := cmd.logUnavailable(backend, unavailable); err != nil {
+		return err
+	}
 
-		rpt, errors := f(u, *list)
-		if len(errors) > 0 {
-			return fmt.Errorf("%v", errors)
-		}
+	if !cmd.force {
+		if warnings := cmd.checkDeletes(diff); len(warnings) > 0 {
+			entries := []logEntry{}
+			for _, w := range warnings {
+				warnf("%v  %v", w.deviceID, w.message)
+				entries = append(entries, logEntry{
+					deviceID: w.deviceID,
+					message:  fmt.Sprintf("WARNING: %v - load aborted", w.message),
+				})
+			}
 
-		for _, w := range warnings {
-			if duplicate, ok := w.(*lib.DuplicateCardError); ok {
-				for k, v := range rpt {
-					v.Errored = append(v.Errored, duplicate.CardNumber)
-					rpt[k] = v
+			if !cmd.nolog {
+				if err := writeLogEntries(backend, cmd.logRange, entries); err != nil {
+					return err
 				}
 			}
-		}
 
-		summary := lib.Summarize(rpt)
-		format := "%v  unchanged:%v  updated:%v  added:%v  deleted:%v  failed:%v  errors:%v"
-		for _, v := range summary {
-			infof(format, v.DeviceID, v.Unchanged, v.Updated, v.Added, v.Deleted, v.Failed, v.Errored+len(warnings))
+			// ... don't retry (and re-log) the same revision
+			if version != nil {
+				version.store(cmd.revisions)
+			}
+
+			return fmt.Errorf("load aborted - exceeds --max-deletes %v (use --force to override)", cmd.maxDeletes)
 		}
+	}
 
-		for k, v := range rpt {
-			for _, err := range v.Errors {
-				errorf("%v  %v", k, err)
-			}
+	updated := false
+	for _, v := range diff {
+		if v.HasChanges() {
+			updated = true
 		}
+	}
 
-		if !cmd.nolog {
-			if err := cmd.updateLogSheet(google, spreadsheet, rpt); err != nil {
-				return err
-			}
+	if err := ctx.Err(); err != nil {
+		return context.Cause(ctx)
+	}
 
-			if err := pruneSheet(google, spreadsheet, cmd.logRange, cmd.logRetention); err != nil {
-				return err
+	if cmd.force || updated {
+		if !cmd.dryrun && cmd.snapshots > 0 {
+			if file, err := saveSnapshot(cmd.snapshotDir(), current, cmd.snapshots); err != nil {
+				return fmt.Errorf("error saving ACL snapshot (%v)", err)
+			} else {
+				infof("Saved ACL snapshot to %v", file)
 			}
 		}
 
-		if !cmd.noreport {
-			if err := cmd.updateReportSheet(google, spreadsheet, rpt); err != nil {
-				return err
-			}
+		if failed, err := cmd.put(ctx, u, backend, *list, warnings, sources); err != nil {
+			return err
+		} else {
+			maps.Copy(unavailable, failed)
 		}
 	} else {
 		infof("No changes - Nothing to do")
 	}
 
-	if version != nil {
+	// ... retry the same revision if any controller was not updated
+	if len(unavailable) > 0 {
+		warnf("%v controller(s) not updated - will retry on next load", len(unavailable))
+	} else if version != nil {
 		version.store(cmd.revisions)
 	}
 
 	return nil
 }
 
-func (l *LoadACL) validate() error {
-	if strings.TrimSpace(l.credentials) == "" {
-		return fmt.Errorf("--credentials is a required option")
+// Records a cancelled (or timed out) load on the log worksheet.
+func (cmd *LoadACL) logCancelled(ctx context.Context) {
+	cmd.cancelled(ctx, cmd.nolog, cmd.logRange)
+}
+
+// Updates the controllers from an ACL and writes the summary to the log and report worksheets (skipped
+// if there is no spreadsheet i.e. a rollback without --url or --file). The sources are the worksheets
+// from which the cards were taken, for the report. Returns the controllers that could not be updated,
+// which are logged separately and fail the update only if no controller was updated.
+func (cmd *LoadACL) put(ctx context.Context, u uhppote.IUHPPOTE, backend Backend, list lib.ACL, warnings []error, sources map[uint32]string) (map[uint32]error, error) {
+	rpt, failed := cmd.workers.putACL(ctx, u, list, cmd.withPIN, cmd.dryrun)
+	if len(rpt) == 0 && len(failed) > 0 {
+		return nil, fmt.Errorf("no controllers updated (%v)", joinErrors(failed))
+	}
+
+	if err := cmd.logUnavailable(backend, failed); err != nil {
+		return nil, err
+	}
+
+	for _, w := range warnings {
+		if duplicate, ok := w.(*lib.DuplicateCardError); ok {
+			for k, v := range rpt {
+				v.Errored = append(v.Errored, duplicate.CardNumber)
+				rpt[k] = v
+			}
+		}
+	}
+
+	summary := lib.Summarize(rpt)
+	format := "%v  unchanged:%v  updated:%v  added:%v  deleted:%v  failed:%v  errors:%v"
+	for _, v := range summary {
+		infof(format, v.DeviceID, v.Unchanged, v.Updated, v.Added, v.Deleted, v.Failed, v.Errored+len(warnings))
+	}
+
+	for k, v := range rpt {
+		for _, err := range v.Errors {
+			errorf("%v  %v", k, err)
+		}
+	}
+
+	if !cmd.nolog && backend != nil {
+		if err := cmd.updateLogSheet(backend, rpt); err != nil {
+			return nil, err
+		}
+
+		if err := pruneSheet(backend, cmd.logRange, cmd.logRetention); err != nil {
+			return nil, err
+		}
+	}
+
+	if !cmd.noreport && backend != nil {
+		if err := cmd.updateReportSheet(backend, rpt, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	return failed, nil
+}
+
+// Logs the controllers that could not be accessed and records them on the log worksheet (skipped if there
+// is no spreadsheet).
+func (cmd *LoadACL) logUnavailable(backend Backend, unavailable map[uint32]error) error {
+	keys := slices.Sorted(maps.Keys(unavailable))
+	entries := []logEntry{}
+
+	for _, k := range keys {
+		errorf("%v  controller unavailable (%v)", k, unavailable[k])
+		entries = append(entries, logEntry{
+			deviceID: k,
+			message:  fmt.Sprintf("ERROR: controller unavailable (%v)", unavailable[k]),
+		})
 	}
 
-	if strings.TrimSpace(l.url) == "" {
-		return fmt.Errorf("--url is a required option")
+	if !cmd.nolog && backend != nil && len(entries) > 0 {
+		return writeLogEntries(backend, cmd.logRange, entries)
+	}
+
+	return nil
+}
+
+func (l *LoadACL) validate() error {
+	if err := l.validateSpreadsheet(); err != nil {
+		return err
 	}
 
 	if strings.TrimSpace(l.area) == "" {
 		return fmt.Errorf("--range is a required option")
 	}
 
-	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(l.area)); len(match) < 2 {
-		return fmt.Errorf("invalid range '%s' - expected something like 'ACL!A2:K", l.area)
+	for _, area := range strings.Split(l.area, ",") {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(area)); len(match) < 2 {
+			return fmt.Errorf("invalid range '%s' - expected something like 'ACL!A2:K", area)
+		}
+	}
+
+	if l.timeProfiles != "" {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(l.timeProfiles)); len(match) < 2 {
+			return fmt.Errorf("invalid time-profiles range '%s' - expected something like 'TimeProfiles!A1:B", l.timeProfiles)
+		}
+	}
+
+	if l.groups != "" {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(l.groups)); len(match) < 2 {
+			return fmt.Errorf("invalid groups range '%s' - expected something like 'Groups!A1:F", l.groups)
+		}
 	}
 
 	if !l.nolog {
@@ -311,32 +486,84 @@ func (l *LoadACL) validate() error {
 		}
 	}
 
+	if _, err := parseMaxDeletes(l.maxDeletes); err != nil {
+		return err
+	}
+
+	if cd := l.changeDetection; cd != "" && cd != "revision" && cd != "content" {
+		return fmt.Errorf("invalid --change-detection '%v' - expected 'revision' or 'content'", cd)
+	}
+
+	if l.snapshots < 0 {
+		return fmt.Errorf("invalid --snapshots %v - expected 0 or more", l.snapshots)
+	}
+
+	if err := l.workers.validate(); err != nil {
+		return err
+	}
+
+	if l.lockMaxAge < 0 {
+		return fmt.Errorf("invalid --lock-max-age '%v' - expected a positive duration", l.lockMaxAge)
+	}
+
 	return nil
 }
 
-func (cmd *LoadACL) getRevision(spreadsheetId string) (*revision, error) {
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
+func parseMaxDeletes(s string) (*maxDeletes, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return nil, nil
 	}
 
-	client, err := authorize(cmd.credentials, drive.DriveMetadataReadonlyScope, tokens)
-	if err != nil {
-		//lint:ignore ST1005 Google should be capitalized
-		return nil, fmt.Errorf("Google Drive authentication/authorization error (%w)", err)
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		if percent, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid --max-deletes '%s' - expected a number of cards (e.g. 50) or a percentage (e.g. 10%%)", s)
+		} else {
+			return &maxDeletes{count: -1, percent: percent}, nil
+		}
 	}
 
-	gdrive, err := drive.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("unable to create new Google Drive client (%w)", err)
+	if count, err := strconv.Atoi(s); err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid --max-deletes '%s' - expected a number of cards (e.g. 50) or a percentage (e.g. 10%%)", s)
+	} else {
+		return &maxDeletes{count: count, percent: -1}, nil
 	}
+}
 
-	version, err := getRevision(gdrive, spreadsheetId)
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve spreadsheet revision (%v)", err)
+// Returns a warning for each controller from which the load would delete more than --max-deletes cards.
+func (l *LoadACL) checkDeletes(diff map[uint32]lib.Diff) []logEntry {
+	limit, err := parseMaxDeletes(l.maxDeletes)
+	if err != nil || limit == nil {
+		return nil
+	}
+
+	warnings := []logEntry{}
+	for _, id := range slices.Sorted(maps.Keys(diff)) {
+		d := diff[id]
+		deleted := len(d.Deleted)
+		total := len(d.Unchanged) + len(d.Updated) + len(d.Deleted)
+
+		if deleted == 0 {
+			continue
+		}
+
+		if limit.count >= 0 && deleted > limit.count {
+			warnings = append(warnings, logEntry{
+				deviceID: id,
+				message:  fmt.Sprintf("load would delete %v of %v cards (--max-deletes %v)", deleted, total, l.maxDeletes),
+			})
+		}
+
+		if limit.percent >= 0 && 100*float64(deleted) > limit.percent*float64(total) {
+			warnings = append(warnings, logEntry{
+				deviceID: id,
+				message:  fmt.Sprintf("load would delete %v of %v cards (%.0f%%) (--max-deletes %v)", deleted, total, 100*float64(deleted)/float64(total), l.maxDeletes),
+			})
+		}
 	}
 
-	return version, nil
+	return warnings
 }
 
 func (l *LoadACL) revised(version *revision) bool {
@@ -366,10 +593,16 @@ func (l *LoadACL) revised(version *revision) bool {
 	return true
 }
 
-func (cmd *LoadACL) compare(u uhppote.IUHPPOTE, devices []uhppote.Device, list *lib.ACL) (bool, error) {
-	current, errors := lib.GetACL(u, devices)
-	if len(errors) > 0 {
-		return false, fmt.Errorf("%v", errors)
+// Returns the current controller ACL and the changes required to update it from the worksheet ACL. Controllers
+// that could not be retrieved are removed from the worksheet ACL and returned separately.
+func (cmd *LoadACL) compare(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, list *lib.ACL) (lib.ACL, map[uint32]lib.Diff, map[uint32]error, error) {
+	current, unavailable := cmd.workers.getACL(ctx, u, devices)
+	if len(current) == 0 && len(unavailable) > 0 {
+		return nil, nil, nil, fmt.Errorf("no controllers available (%v)", joinErrors(unavailable))
+	}
+
+	for k := range unavailable {
+		delete(*list, k)
 	}
 
 	f := func(current lib.ACL, list lib.ACL) (map[uint32]lib.Diff, error) {
@@ -380,35 +613,62 @@ func (cmd *LoadACL) compare(u uhppote.IUHPPOTE, devices []uhppote.Device, list *
 		}
 	}
 
-	if diff, err := f(current, *list); err != nil {
-		return false, err
-	} else {
+	diff, err := f(current, *list)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return current, diff, unavailable, nil
+}
+
+// Returns true if the hash of the ACL table differs from the hash stored with the last load and the
+// changed ACL has been unchanged for (at least) the --delay settling interval. A changed hash is recorded
+// in the revisions file as 'pending' when it is first seen, so that the delay is measured from the first
+// check that found the change.
+func (l *LoadACL) changed(hash string) bool {
+	var last revision
+
+	if err := last.load(l.revisions); err != nil {
+		errorf("Error reading last ACL hash from %s", l.revisions)
+		errorf("%v", err)
+		return true
+	}
+
+	infof("ACL hash        %v", hash)
+	infof("Last ACL hash   %v", last.Hash)
 
-		for _, v := range diff {
-			if v.HasChanges() {
-				return true, nil
+	if hash == last.Hash {
+		if last.Pending != nil {
+			last.Pending = nil
+			if err := last.store(l.revisions); err != nil {
+				warnf("Error updating %v (%v)", l.revisions, err)
 			}
 		}
 
-		return false, nil
+		infof("ACL unchanged - Nothing to do")
+		return false
 	}
-}
 
-func (l *LoadACL) getACL(google *sheets.Service, spreadsheet *sheets.Spreadsheet, devices []uhppote.Device) (*lib.ACL, []error, error) {
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, l.area).Do()
-	if err != nil {
-		return nil, nil, fmt.Errorf("unable to retrieve data from sheet (%v)", err)
-	}
+	if last.Pending == nil || last.Pending.Hash != hash {
+		last.Pending = &pending{
+			Hash:  hash,
+			Since: time.Now(),
+		}
 
-	if len(response.Values) == 0 {
-		return nil, nil, fmt.Errorf("no data in spreadsheet/range")
+		if err := last.store(l.revisions); err != nil {
+			warnf("Error updating %v (%v)", l.revisions, err)
+		}
 	}
 
-	table, err := makeTable(response.Values)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error creating table from worksheet (%v)", err)
+	if since := last.Pending.Since; time.Since(since) < l.delay {
+		infof("ACL changed less than %s ago (%s)", l.delay, since.Local().Format("2006-01-02 15:04:05 MST"))
+		return false
 	}
 
+	return true
+}
+
+func (l *LoadACL) parseTable(table *lib.Table, devices []uhppote.Device) (*lib.ACL, []error, error) {
 	list, warnings, err := lib.ParseTable(table, devices, l.strict)
 	if err != nil {
 		return nil, nil, err
@@ -421,20 +681,23 @@ func (l *LoadACL) getACL(google *sheets.Service, spreadsheet *sheets.Spreadsheet
 	return list, warnings, nil
 }
 
-func (l *LoadACL) updateLogSheet(google *sheets.Service, spreadsheet *sheets.Spreadsheet, rpt map[uint32]lib.Report) error {
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, l.logRange).Do()
+func (l *LoadACL) updateLogSheet(backend Backend, rpt map[uint32]lib.Report) error {
+	return writeLog(backend, l.logRange, rpt)
+}
+
+// Appends a per-controller summary of the report to the log worksheet.
+func writeLog(backend Backend, area string, rpt map[uint32]lib.Report) error {
+	values, err := backend.Read(area)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve column headers from log sheet (%v)", err)
 	}
 
 	fields := []string{"timestamp", "deviceid", "unchanged", "updated", "added", "deleted", "failed", "errors"}
 
-	index, columns := buildIndex(response.Values, fields)
+	index, columns := buildIndex(values, fields)
 
 	summary := lib.Summarize(rpt)
-	var rows = sheets.ValueRange{
-		Values: [][]any{},
-	}
+	rows := [][]any{}
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	for _, v := range summary {
@@ -476,20 +739,69 @@ func (l *LoadACL) updateLogSheet(google *sheets.Service, spreadsheet *sheets.Spr
 			row[ix] = v.Errored
 		}
 
-		rows.Values = append(rows.Values, row)
+		rows = append(rows, row)
 	}
 
-	if _, err := google.Spreadsheets.Values.Append(spreadsheet.SpreadsheetId, l.logRange, &rows).
-		ValueInputOption("USER_ENTERED").
-		InsertDataOption("INSERT_ROWS").
-		Do(); err != nil {
-		return fmt.Errorf("error writing log to Google Sheets (%w)", err)
+	if err := backend.Append(area, rows, false); err != nil {
+		return fmt.Errorf("error writing log to worksheet (%w)", err)
 	}
 
 	return nil
 }
 
-func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.Spreadsheet, rpt map[uint32]lib.Report) error {
+// Free text log worksheet entry for a controller.
+type logEntry struct {
+	deviceID uint32
+	message  string
+}
+
+// Appends the entries to the log worksheet, with the message text in the column following the device ID
+// (left blank for entries that do not apply to a single controller).
+func writeLogEntries(backend Backend, area string, entries []logEntry) error {
+	values, err := backend.Read(area)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve column headers from log sheet (%v)", err)
+	}
+
+	fields := []string{"timestamp", "deviceid", "unchanged", "updated", "added", "deleted", "failed", "errors"}
+
+	index, columns := buildIndex(values, fields)
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	rows := [][]any{}
+
+	for _, e := range entries {
+		row := make([]any, max(columns, 3))
+
+		for i := range row {
+			row[i] = ""
+		}
+
+		ix := 0
+		if v, ok := index["timestamp"]; ok {
+			row[v] = timestamp
+			ix = v + 1
+		}
+
+		if v, ok := index["deviceid"]; ok {
+			if e.deviceID != 0 {
+				row[v] = fmt.Sprintf("'%v", e.deviceID)
+			}
+			ix = v + 1
+		}
+
+		row[min(ix, len(row)-1)] = e.message
+
+		rows = append(rows, row)
+	}
+
+	if err := backend.Append(area, rows, false); err != nil {
+		return fmt.Errorf("error writing log to worksheet (%w)", err)
+	}
+
+	return nil
+}
+
+func (l *LoadACL) updateReportSheet(backend Backend, rpt map[uint32]lib.Report, sources map[uint32]string) error {
 	infof("Appending report to worksheet")
 
 	// ... include 'after cutoff' rows from existing report
@@ -503,9 +815,9 @@ func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.
 	top, _ := strconv.Atoi(match[3])
 	right := match[4]
 
-	var rows = sheets.ValueRange{
-		Range:  fmt.Sprintf("%s!%s%v:%s", name, left, top+1, right),
-		Values: [][]any{},
+	var rows = valueRange{
+		area:   fmt.Sprintf("%s!%s%v:%s", name, left, top+1, right),
+		values: [][]any{},
 	}
 
 	before := time.Now().
@@ -515,15 +827,15 @@ func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.
 
 	cutoff := time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, before.Location())
 
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, l.reportRange).Do()
+	values, err := backend.Read(l.reportRange)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve column headers from report sheet (%v)", err)
 	}
 
-	fields := []string{"timestamp", "action", "cardnumber"}
-	index, columns := buildIndex(response.Values, fields)
+	fields := []string{"timestamp", "action", "cardnumber", "source"}
+	index, columns := buildIndex(values, fields)
 
-	for _, record := range response.Values[1:] {
+	for _, record := range values[min(1, len(values)):] {
 		row := make([]any, columns)
 		for i := range columns {
 			row[i] = ""
@@ -538,7 +850,7 @@ func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.
 					}
 				}
 
-				rows.Values = append(rows.Values, row)
+				rows.values = append(rows.values, row)
 			}
 		}
 	}
@@ -578,7 +890,11 @@ func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.
 				row[ix] = card
 			}
 
-			rows.Values = append(rows.Values, row)
+			if ix, ok := index["source"]; ok {
+				row[ix] = sources[card]
+			}
+
+			rows.values = append(rows.values, row)
 		}
 	}
 
@@ -590,43 +906,41 @@ func (l *LoadACL) updateReportSheet(google *sheets.Service, spreadsheet *sheets.
 			row[i] = ""
 		}
 
-		rows.Values = append(rows.Values, row)
+		rows.values = append(rows.values, row)
 	}
 
 	// ... update worksheet
-	rq := sheets.BatchUpdateValuesRequest{
-		ValueInputOption: "USER_ENTERED",
-		Data:             []*sheets.ValueRange{&rows},
-	}
 
-	// TEENSY LITTLE HACK - top+len(rows.Values) relies on the padding below the report to avoid
+	// TEENSY LITTLE HACK - top+len(rows.values) relies on the padding below the report to avoid
 	//                      an error because the 'below' range is out of range
-	below := fmt.Sprintf("%s!%s%v:%s", name, left, top+len(rows.Values), right)
+	below := fmt.Sprintf("%s!%s%v:%s", name, left, top+len(rows.values), right)
 
-	if _, err := google.Spreadsheets.Values.BatchUpdate(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
+	if err := backend.Write(rows); err != nil {
 		return err
 	}
 
-	if err := clear(google, spreadsheet, []string{below}); err != nil {
+	if err := backend.Clear(below); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func pruneSheet(google *sheets.Service, spreadsheet *sheets.Spreadsheet, area string, retention int) error {
-	sheet, err := getSheet(spreadsheet, area)
-	if err != nil {
-		return err
+func pruneSheet(backend Backend, area string, retention int) error {
+	match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(area)
+	if len(match) < 2 {
+		return fmt.Errorf("unable to identify worksheet for '%s'", area)
 	}
 
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, area).Do()
+	name := match[1]
+
+	values, err := backend.Read(area)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve data from %s (%v)", area, err)
 	}
 
 	fields := []string{"timestamp"}
-	index, _ := buildIndex(response.Values, fields)
+	index, _ := buildIndex(values, fields)
 
 	before := time.Now().
 		In(time.Local).
@@ -637,9 +951,9 @@ func pruneSheet(google *sheets.Service, spreadsheet *sheets.Spreadsheet, area st
 	list := []int{}
 	deleted := 0
 
-	infof("Pruning records before %v from '%s' worksheet ", cutoff.Format("2006-01-02"), sheet.Properties.Title)
+	infof("Pruning records before %v from '%s' worksheet ", cutoff.Format("2006-01-02"), name)
 
-	for row, record := range response.Values {
+	for row, record := range values {
 		if ix, ok := index["timestamp"]; ok && ix < len(record) {
 			timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", record[ix].(string), time.Local)
 			if err == nil && timestamp.Before(cutoff) {
@@ -651,46 +965,27 @@ func pruneSheet(google *sheets.Service, spreadsheet *sheets.Spreadsheet, area st
 	if len(list) > 0 {
 		sort.Ints(list[:])
 
-		ranges := map[int]int{}
+		ranges := []rowRange{}
 		start := list[0]
 		last := list[0]
 		for _, row := range list[1:] {
 			if row != last+1 {
-				ranges[start] = last
+				ranges = append(ranges, rowRange{int64(start), int64(last + 1)})
 				start = row
 			}
 
 			last = row
 		}
-		ranges[start] = last
-
-		if len(ranges) > 0 {
-			rq := sheets.BatchUpdateSpreadsheetRequest{
-				Requests: []*sheets.Request{},
-			}
-
-			for start, end := range ranges {
-				rq.Requests = append(rq.Requests, &sheets.Request{
-					DeleteDimension: &sheets.DeleteDimensionRequest{
-						Range: &sheets.DimensionRange{
-							SheetId:    sheet.Properties.SheetId,
-							Dimension:  "ROWS",
-							StartIndex: int64(start - deleted),
-							EndIndex:   int64(end - deleted + 1),
-						},
-					},
-				})
+		ranges = append(ranges, rowRange{int64(start), int64(last + 1)})
 
-				deleted += end - start + 1
-			}
-
-			if _, err := google.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
-				return err
-			}
+		if err := backend.DeleteRows(area, ranges...); err != nil {
+			return err
 		}
+
+		deleted = len(list)
 	}
 
-	infof("Pruned %d records from '%s' worksheet", deleted, sheet.Properties.Title)
+	infof("Pruned %d records from '%s' worksheet", deleted, name)
 
 	return nil
 }
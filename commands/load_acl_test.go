@@ -0,0 +1,747 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"google.golang.org/api/drive/v3"
+)
+
+func testControllers() map[uint32]*simulated {
+	return map[uint32]*simulated{
+		405419896: &simulated{
+			doors: []string{"Front Door", "Side Door", "Garage", "Workshop"},
+			cards: []*types.Card{
+				mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+				mkcard(6001002, "2023-01-01", "2023-12-31", 1, 1, 0, 0),
+				mkcard(6001003, "2023-01-01", "2023-12-31", 1, 1, 1, 1),
+			},
+		},
+		303986753: &simulated{
+			doors: []string{"Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+			cards: []*types.Card{
+				mkcard(6001001, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+			},
+		},
+	}
+}
+
+func testWorksheets(acl ...[]any) map[string][][]any {
+	return map[string][][]any{
+		"ACL": append([][]any{
+			[]any{"Card Number", "PIN", "From", "To", "Front Door", "Side Door", "Great Hall", "Kitchen"},
+		}, acl...),
+		"Log": [][]any{
+			[]any{"Timestamp", "Device ID", "Unchanged", "Updated", "Added", "Deleted", "Failed", "Errors"},
+		},
+		"Report": [][]any{
+			[]any{"Timestamp", "Action", "Card Number"},
+		},
+		"Audit": [][]any{
+			[]any{""},
+			[]any{"Device", "Updated", "Added", "Deleted"},
+		},
+	}
+}
+
+func testACL() [][]any {
+	return [][]any{
+		[]any{"6001001", "7531", "2023-01-01", "2023-12-31", "Y", "N", "Y", "N"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"},
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "N", "Y", "N", "Y"},
+	}
+}
+
+func testLoadACL(fake *fakeGoogle, sim *simulator, t *testing.T) *LoadACL {
+	return &LoadACL{
+		command:         fake.command(t, sim),
+		area:            "ACL!A1:H",
+		logRange:        "Log!A1:H",
+		logRetention:    30,
+		reportRange:     "Report!A1:E",
+		reportRetention: 7,
+		force:           true,
+		delay:           15 * time.Minute,
+	}
+}
+
+// Returns the Log worksheet rows without the timestamp.
+func logRows(fake *fakeGoogle) [][]any {
+	rows := [][]any{}
+	for _, row := range fake.values("Log")[1:] {
+		rows = append(rows, row[1:])
+	}
+
+	return rows
+}
+
+// Returns the Report worksheet entries as 'action:card' strings, without the timestamp.
+func reportRows(fake *fakeGoogle) []string {
+	rows := []string{}
+	for _, row := range fake.values("Report")[1:] {
+		if len(row) > 2 {
+			rows = append(rows, fmt.Sprintf("%v:%v", row[1], row[2]))
+		}
+	}
+
+	return rows
+}
+
+func checkCards(t *testing.T, sim *simulator, deviceID uint32, expected ...*types.Card) {
+	t.Helper()
+
+	list := []types.Card{}
+	for _, card := range expected {
+		list = append(list, *card)
+	}
+
+	if cards := sim.cards(deviceID); !reflect.DeepEqual(cards, list) {
+		t.Errorf("%v: incorrect cards\n   expected:%v\n   got:     %v", deviceID, list, cards)
+	}
+}
+
+func TestLoadACL(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	expected := [][]any{
+		[]any{"303986753", "0", "1", "2", "0", "0", "0"},
+		[]any{"405419896", "1", "1", "1", "1", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	report := reportRows(fake)
+	for _, v := range []string{"Updated:6001001", "Updated:6001002", "Added:6001002", "Added:6001004", "Deleted:6001003"} {
+		if !slices.Contains(report, v) {
+			t.Errorf("Missing report entry '%v' in %v", v, report)
+		}
+	}
+}
+
+func TestLoadACLWithDuplicateCards(t *testing.T) {
+	acl := append(testACL(), []any{"6001001", "", "2023-01-01", "2023-12-31", "N", "N", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, testWorksheets(acl...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	// ... duplicate cards are deleted across the system
+	checkCards(t, sim, 405419896,
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	expected := [][]any{
+		[]any{"303986753", "0", "0", "2", "1", "0", "1"},
+		[]any{"405419896", "0", "1", "1", "2", "0", "1"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if report := reportRows(fake); !slices.Contains(report, "Error:6001001") {
+		t.Errorf("Missing report entry 'Error:6001001' in %v", report)
+	}
+}
+
+func TestLoadACLWithDuplicateCardsAndStrict(t *testing.T) {
+	acl := append(testACL(), []any{"6001001", "", "2023-01-01", "2023-12-31", "N", "N", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, testWorksheets(acl...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+	cmd.strict = true
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with duplicate cards and --strict")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+
+	if rows := logRows(fake); len(rows) != 0 {
+		t.Errorf("Unexpected log entries %v", rows)
+	}
+}
+
+func testACLRangeWorksheets(students ...[]any) map[string][][]any {
+	worksheets := testWorksheets()
+	header := worksheets["ACL"][0]
+
+	delete(worksheets, "ACL")
+
+	worksheets["Staff"] = [][]any{
+		header,
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Y", "N", "Y", "N"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"},
+	}
+
+	worksheets["Students"] = append([][]any{header}, students...)
+	worksheets["Report"] = [][]any{
+		[]any{"Timestamp", "Action", "Card Number", "Source"},
+	}
+
+	return worksheets
+}
+
+// Returns the Report worksheet entries as 'action:card:source' strings, without the timestamp.
+func reportSources(fake *fakeGoogle) []string {
+	rows := []string{}
+	for _, row := range fake.values("Report")[1:] {
+		if len(row) > 2 {
+			rows = append(rows, fmt.Sprintf("%v:%v:%v", row[1], row[2], value(row, 3)))
+		}
+	}
+
+	return rows
+}
+
+func TestLoadACLWithMultipleRanges(t *testing.T) {
+	worksheets := testACLRangeWorksheets(
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"},
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "N", "Y", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "Staff!A1:H,Students!A1:H"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	report := reportSources(fake)
+	for _, v := range []string{"Updated:6001001:Staff", "Added:6001002:Staff", "Added:6001004:Students", "Deleted:6001003:"} {
+		if !slices.Contains(report, v) {
+			t.Errorf("Missing report entry '%v' in %v", v, report)
+		}
+	}
+}
+
+func TestLoadACLWithRangePattern(t *testing.T) {
+	worksheets := testACLRangeWorksheets(
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "N", "Y", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "St*!A1:H"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+}
+
+func TestLoadACLWithConflictingRanges(t *testing.T) {
+	worksheets := testACLRangeWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "N", "N", "N", "Y"},
+		[]any{"6001004", "", "2023-01-01", "2023-12-31", "N", "Y", "N", "Y"})
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.area = "Staff!A1:H,Students!A1:H"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	// ... conflicting cards are deleted across the system, as for duplicates on a single worksheet
+	checkCards(t, sim, 405419896,
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	if report := reportSources(fake); !slices.Contains(report, "Error:6001001:Staff, Students") {
+		t.Errorf("Missing report entry 'Error:6001001:Staff, Students' in %v", report)
+	}
+}
+
+func TestLoadACLWithPIN(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.withPIN = true
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	cards := sim.cards(405419896)
+	if len(cards) != 3 || cards[0].CardNumber != 6001001 || cards[0].PIN != 7531 {
+		t.Errorf("Card PIN not updated (%v)", cards)
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "0", "1", "2", "0", "0", "0"},
+		[]any{"405419896", "0", "2", "1", "1", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestLoadACLWithoutPIN(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	for _, card := range sim.cards(405419896) {
+		if card.PIN != 0 {
+			t.Errorf("Card %v PIN unexpectedly updated (%v)", card.CardNumber, card.PIN)
+		}
+	}
+}
+
+func TestLoadACLWithFailures(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	controllers[405419896].readonly = map[uint32]bool{6001004: true}
+	controllers[303986753].errors = map[uint32]bool{6001002: true}
+
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	expected := [][]any{
+		[]any{"303986753", "0", "1", "1", "0", "0", "1"},
+		[]any{"405419896", "1", "1", "0", "1", "1", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	report := reportRows(fake)
+	for _, v := range []string{"Failed:6001004", "Error:6001002"} {
+		if !slices.Contains(report, v) {
+			t.Errorf("Missing report entry '%v' in %v", v, report)
+		}
+	}
+}
+
+func TestLoadACLWithOfflineController(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	controllers[303986753].offline = true
+
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl with offline controller (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0))
+
+	expected := [][]any{
+		[]any{"303986753", "ERROR: controller unavailable (timeout waiting for response from 303986753)"},
+		[]any{"405419896", "1", "1", "1", "1", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestLoadACLWithAllControllersOffline(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	controllers[303986753].offline = true
+	controllers[405419896].offline = true
+
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with all controllers offline")
+	}
+
+	if rows := logRows(fake); len(rows) != 0 {
+		t.Errorf("Unexpected log entries %v", rows)
+	}
+}
+
+func TestLoadACLWithCancel(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := cmd.Execute(&Options{Config: sim.config(t), Context: ctx}); err == nil {
+		t.Fatalf("Expected error executing cancelled load-acl")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+
+	expected := [][]any{
+		[]any{"", "CANCELLED: context canceled"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if _, err := os.Stat(lockFile(cmd.workdir, fakeSpreadsheetID, cmd.area)); !os.IsNotExist(err) {
+		t.Errorf("Lockfile not removed (%v)", err)
+	}
+}
+
+func TestLoadACLWithDryRun(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+	cmd.dryrun = true
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+
+	expected := [][]any{
+		[]any{"303986753", "0", "1", "2", "0", "0", "0"},
+		[]any{"405419896", "1", "1", "1", "1", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestLoadACLWithUnchangedRevision(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	fake.revisions = []*drive.Revision{
+		{Id: "101", ModifiedTime: time.Now().Add(-time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")},
+	}
+
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.force = false
+	config := sim.config(t)
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Fatalf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+
+	// ... 'out of band' change to controller
+	sim.DeleteCard(405419896, 6001004)
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0))
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+}
+
+func TestLoadACLWithServiceAccount(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	fake.revisions = []*drive.Revision{
+		{Id: "101", ModifiedTime: time.Now().Add(-time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")},
+	}
+
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.credentials = fake.serviceAccount(t)
+	cmd.tokens = t.TempDir()
+	cmd.force = false
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+
+	if !slices.Contains(fake.scopes, drive.DriveMetadataReadonlyScope) {
+		t.Errorf("Missing Google Drive scope in service account token requests %v", fake.scopes)
+	}
+}
+
+func TestLoadACLWithMaxDeletes(t *testing.T) {
+	tests := []struct {
+		maxDeletes string
+		aborted    bool
+	}{
+		{"0", true},
+		{"1", false},
+		{"25%", true},
+		{"50%", false},
+	}
+
+	for _, test := range tests {
+		fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+		controllers := testControllers()
+		sim := newSimulator(controllers)
+		cmd := testLoadACL(fake, sim, t)
+		cmd.force = false
+		cmd.maxDeletes = test.maxDeletes
+
+		err := cmd.Execute(&Options{Config: sim.config(t)})
+
+		switch {
+		case test.aborted && err == nil:
+			t.Errorf("--max-deletes %v: expected error", test.maxDeletes)
+
+		case !test.aborted && err != nil:
+			t.Errorf("--max-deletes %v: unexpected error (%v)", test.maxDeletes, err)
+		}
+
+		if test.aborted {
+			checkCards(t, sim, 405419896, controllers[405419896].cards...)
+
+			rows := logRows(fake)
+			if len(rows) != 1 || len(rows[0]) < 2 || rows[0][0] != "405419896" || !strings.HasPrefix(fmt.Sprintf("%v", rows[0][1]), "WARNING: load would delete 1 of 3 cards") {
+				t.Errorf("--max-deletes %v: incorrect log\n   expected:%v\n   got:     %v", test.maxDeletes, "405419896  WARNING: load would delete 1 of 3 cards ...", rows)
+			}
+		} else if card, _ := sim.GetCardByID(405419896, 6001003); card != nil {
+			t.Errorf("--max-deletes %v: card %v not deleted", test.maxDeletes, 6001003)
+		}
+	}
+}
+
+func TestLoadACLWithMaxDeletesAndForce(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.maxDeletes = "0"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if card, _ := sim.GetCardByID(405419896, 6001003); card != nil {
+		t.Errorf("Card %v not deleted with --force", 6001003)
+	}
+}
+
+func TestLoadACLWithInvalidMaxDeletes(t *testing.T) {
+	for _, v := range []string{"-1", "lots", "101%", "x%"} {
+		fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+		sim := newSimulator(testControllers())
+		cmd := testLoadACL(fake, sim, t)
+		cmd.maxDeletes = v
+
+		if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+			t.Errorf("Expected error for invalid --max-deletes '%v'", v)
+		}
+	}
+}
+
+func TestLoadACLWithContentChangeDetection(t *testing.T) {
+	fake, google := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.force = false
+	cmd.changeDetection = "content"
+	cmd.delay = 0
+	config := sim.config(t)
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Fatalf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+
+	// ... unchanged ACL (but revised spreadsheet)
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+
+	// ... updated ACL
+	update := valueRange{
+		area:   "ACL!A4:H4",
+		values: [][]any{{"6001004", "", "2023-01-01", "2023-12-31", "N", "N", "N", "N"}},
+	}
+
+	if err := google.Write(update); err != nil {
+		t.Fatalf("Unexpected error updating ACL worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 0, 0, 0))
+
+	if rows := logRows(fake); len(rows) != 4 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 4, len(rows))
+	}
+
+	if n := fake.count("revisions.list"); n != 0 {
+		t.Errorf("Unexpected Google Drive requests with --change-detection content (%v)", n)
+	}
+}
+
+func TestLoadACLWithContentChangeDetectionAndDelay(t *testing.T) {
+	fake, google := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.force = false
+	cmd.changeDetection = "content"
+	config := sim.config(t)
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	// ... updated ACL
+	update := valueRange{
+		area:   "ACL!A5:H5",
+		values: [][]any{{"6001005", "", "2023-01-01", "2023-12-31", "N", "N", "Y", "N"}},
+	}
+
+	if err := google.Write(update); err != nil {
+		t.Fatalf("Unexpected error updating ACL worksheet (%v)", err)
+	}
+
+	// ... changed less than --delay ago
+	for range 2 {
+		if err := cmd.Execute(&Options{Config: config}); err != nil {
+			t.Fatalf("Unexpected error executing load-acl (%v)", err)
+		}
+
+		if card, _ := sim.GetCardByID(405419896, 6001005); card != nil {
+			t.Fatalf("ACL loaded before content was stable for --delay")
+		}
+	}
+
+	// ... changed more than --delay ago
+	var last revision
+	if err := last.load(cmd.revisions); err != nil {
+		t.Fatalf("Error reading revisions file (%v)", err)
+	} else if last.Pending == nil {
+		t.Fatalf("Changed ACL hash not recorded as pending")
+	} else {
+		last.Pending.Since = last.Pending.Since.Add(-cmd.delay)
+		if err := last.store(cmd.revisions); err != nil {
+			t.Fatalf("Error updating revisions file (%v)", err)
+		}
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0),
+		mkcard(6001005, "2023-01-01", "2023-12-31", 0, 0, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 0, 0, 0),
+		mkcard(6001004, "2023-01-01", "2023-12-31", 0, 1, 0, 0),
+		mkcard(6001005, "2023-01-01", "2023-12-31", 1, 0, 0, 0))
+
+	if err := last.load(cmd.revisions); err != nil {
+		t.Fatalf("Error reading revisions file (%v)", err)
+	} else if last.Pending != nil {
+		t.Errorf("Pending ACL hash not cleared after load (%+v)", *last.Pending)
+	}
+}
+
+func TestLoadACLWithInvalidChangeDetection(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.changeDetection = "checksum"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Errorf("Expected error for invalid --change-detection '%v'", cmd.changeDetection)
+	}
+}
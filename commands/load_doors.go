@@ -0,0 +1,507 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var LoadDoorsCmd = LoadDoors{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config:       config.DefaultConfig,
+	area:         "Doors!A1:E",
+	dryrun:       false,
+	nolog:        false,
+	logRange:     "Log!A1:H",
+	logRetention: 30,
+}
+
+type LoadDoors struct {
+	command
+	config       string
+	area         string
+	dryrun       bool
+	nolog        bool
+	logRange     string
+	logRetention int
+}
+
+// Door settings from the Doors worksheet. Settings left blank on the worksheet are nil and are
+// not changed on the controller.
+type door struct {
+	name       string
+	controller uint32
+	door       uint8
+	mode       *types.ControlState
+	delay      *uint8
+	keypad     *bool
+}
+
+// The keypad settings last applied to each controller. Stored after each update because the
+// keypad settings cannot be read back from the controller.
+type keypads map[uint32]map[uint8]bool
+
+var doorModes = map[string]types.ControlState{
+	"controlled":     types.Controlled,
+	"normallyopen":   types.NormallyOpen,
+	"normallyclosed": types.NormallyClosed,
+}
+
+func (cmd *LoadDoors) Name() string {
+	return "load-doors"
+}
+
+func (cmd *LoadDoors) Description() string {
+	return "Updates the door settings on a set of configured UHPPOTE access controllers from a Google Sheets worksheet"
+}
+
+func (cmd *LoadDoors) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *LoadDoors) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] load-doors [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Updates the door control mode, unlock delay and keypad settings on a set of configured controllers from a Google")
+	fmt.Println("  Sheets worksheet. The worksheet is expected to have the columns 'Door', 'Mode', 'Delay' and 'Keypad', with the")
+	fmt.Println("  doors identified by the door names in the configuration file e.g.")
+	fmt.Println()
+	fmt.Println("    Door        Controller  Mode            Delay  Keypad")
+	fmt.Println("    Front Door  405419896   controlled      5      Y")
+	fmt.Println("    Garage      405419896   normally closed 10     N")
+	fmt.Println()
+	fmt.Println("  The mode is one of 'controlled', 'normally open' or 'normally closed' and the delay is the door unlock duration in")
+	fmt.Println("  seconds. Blank settings are left unchanged and the 'Controller' column is informational only.")
+	fmt.Println()
+	fmt.Println("  The keypad settings cannot be read from a controller, so the keypads on a controller are only updated once the keypad")
+	fmt.Println("  setting for every door on the controller is known, either from the worksheet or as last applied by load-doors.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets load-doors --credentials "credentials.json" \`)
+	fmt.Println(`                                  --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                  --range "Doors!A1:E"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets load-doors --file "site.xlsx" --dry-run`)
+	fmt.Println()
+}
+
+func (cmd *LoadDoors) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("load-doors")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range of the door settings e.g. 'Doors!A1:E'")
+	flagset.BoolVar(&cmd.dryrun, "dry-run", cmd.dryrun, "Reports the door changes without updating the access controllers")
+
+	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing a summary to the 'log' worksheet")
+	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
+	flagset.IntVar(&cmd.logRetention, "log-retention", cmd.logRetention, "Log sheet records older than 'log-retention' days are automatically pruned")
+
+	return flagset
+}
+
+func (cmd *LoadDoors) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	// ... locked?
+	if locks, err := cmd.lockControllers(devices, LOCK_MAX_AGE); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s  log:%s", backend.ID(), cmd.area, cmd.logRange)
+	}
+
+	values, err := backend.Read(cmd.area)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve doors from sheet (%v)", err)
+	}
+
+	doors, err := parseDoors(values, devices)
+	if err != nil {
+		return err
+	}
+
+	file := keypadsFile(cmd.workdir)
+	applied := keypads{}
+	if err := applied.load(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading keypad settings from %s (%v)", file, err)
+	}
+
+	type result struct {
+		rpt     lib.Report
+		keypads map[uint8]bool
+	}
+
+	results, _ := forEach(ctx, devices, func(d uhppote.Device) (result, error) {
+		list := []door{}
+		for _, v := range doors {
+			if v.controller == d.DeviceID {
+				list = append(list, v)
+			}
+		}
+
+		rpt, keypads := cmd.update(u, d.DeviceID, list, applied[d.DeviceID])
+
+		return result{rpt, keypads}, nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, cmd.nolog, cmd.logRange)
+	}
+
+	rpt := map[uint32]lib.Report{}
+	for _, d := range devices {
+		rpt[d.DeviceID] = results[d.DeviceID].rpt
+		if results[d.DeviceID].keypads != nil {
+			applied[d.DeviceID] = results[d.DeviceID].keypads
+		}
+	}
+
+	if !cmd.dryrun {
+		if err := applied.store(file); err != nil {
+			return fmt.Errorf("error storing keypad settings to %s (%v)", file, err)
+		}
+	}
+
+	summary := lib.Summarize(rpt)
+	format := "%v  unchanged:%v  updated:%v  failed:%v  errors:%v"
+	for _, v := range summary {
+		infof(format, v.DeviceID, v.Unchanged, v.Updated, v.Failed, v.Errored)
+	}
+
+	if !cmd.nolog {
+		if err := writeLog(backend, cmd.logRange, rpt); err != nil {
+			return err
+		}
+
+		if err := pruneSheet(backend, cmd.logRange, cmd.logRetention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *LoadDoors) validate() error {
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(cmd.area)); len(match) < 2 {
+		return fmt.Errorf("invalid range '%s' - expected something like 'Doors!A1:E", cmd.area)
+	}
+
+	if !cmd.nolog {
+		if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+[0-9]+):([a-zA-Z]+(?:[0-9]+)?)`).FindStringSubmatch(cmd.logRange); len(match) < 4 {
+			return fmt.Errorf("invalid log-range '%s' - expected something like 'Log!A1:H", cmd.logRange)
+		}
+	}
+
+	return nil
+}
+
+// Compares the door settings on a controller with the worksheet settings and updates any that have
+// changed. The report lists the door numbers. 'current' is the keypad settings last applied to the
+// controller and the new keypad settings are returned if the controller keypads were updated.
+func (cmd *LoadDoors) update(u uhppote.IUHPPOTE, deviceID uint32, doors []door, current map[uint8]bool) (lib.Report, map[uint8]bool) {
+	rpt := lib.Report{
+		Unchanged: []uint32{},
+		Updated:   []uint32{},
+		Added:     []uint32{},
+		Deleted:   []uint32{},
+		Failed:    []uint32{},
+		Errored:   []uint32{},
+		Errors:    []error{},
+	}
+
+	updated := map[uint8]bool{}
+	failed := map[uint8]bool{}
+	errored := map[uint8]bool{}
+
+	fail := func(d uint8, err error) {
+		if err != nil {
+			errorf("%v  door %v: %v", deviceID, d, err)
+			rpt.Errors = append(rpt.Errors, err)
+			errored[d] = true
+		} else {
+			warnf("%v  door %v not updated", deviceID, d)
+			failed[d] = true
+		}
+	}
+
+	// ... mode and delay
+	for _, d := range doors {
+		if d.mode == nil && d.delay == nil {
+			continue
+		}
+
+		state, err := u.GetDoorControlState(deviceID, d.door)
+		if err != nil {
+			fail(d.door, err)
+			continue
+		} else if state == nil {
+			fail(d.door, fmt.Errorf("no response to get-door-control-state"))
+			continue
+		}
+
+		mode := state.ControlState
+		delay := state.Delay
+
+		if d.mode != nil {
+			mode = *d.mode
+		}
+
+		if d.delay != nil {
+			delay = *d.delay
+		}
+
+		if mode == state.ControlState && delay == state.Delay {
+			continue
+		}
+
+		infof("%v  update door %v '%v'  mode:%v  delay:%vs (was %v, %vs)", deviceID, d.door, d.name, mode, delay, state.ControlState, state.Delay)
+
+		if !cmd.dryrun {
+			if result, err := u.SetDoorControlState(deviceID, d.door, mode, delay); err != nil {
+				fail(d.door, err)
+				continue
+			} else if result == nil || result.ControlState != mode || result.Delay != delay {
+				fail(d.door, nil)
+				continue
+			}
+		}
+
+		updated[d.door] = true
+	}
+
+	// ... keypads (the keypad settings cannot be read back from the controller, so the doors that are not on the
+	//     worksheet keep the settings last applied and the keypads are only updated if the setting for every
+	//     door is known)
+	readers := map[uint8]bool{}
+	changed := []uint8{}
+	activated := false
+
+	for k, v := range current {
+		readers[k] = v
+	}
+
+	for _, d := range doors {
+		if d.keypad == nil {
+			continue
+		}
+
+		if v, ok := current[d.door]; !ok || v != *d.keypad {
+			infof("%v  update door %v '%v'  keypad:%v", deviceID, d.door, d.name, *d.keypad)
+			changed = append(changed, d.door)
+		}
+
+		readers[d.door] = *d.keypad
+	}
+
+	unknown := []uint8{}
+	for door := uint8(1); door <= 4; door++ {
+		if _, ok := readers[door]; !ok {
+			unknown = append(unknown, door)
+		}
+	}
+
+	if len(changed) > 0 && len(unknown) > 0 {
+		warnf("%v  keypads not updated - no keypad setting for door(s) %v", deviceID, unknown)
+		for _, d := range changed {
+			fail(d, nil)
+		}
+	} else if len(changed) > 0 && !cmd.dryrun {
+		if ok, err := u.ActivateKeypads(deviceID, readers); err != nil || !ok {
+			for _, d := range changed {
+				fail(d, err)
+			}
+		} else {
+			activated = true
+		}
+	}
+
+	for _, d := range changed {
+		updated[d] = true
+	}
+
+	for _, d := range doors {
+		id := uint32(d.door)
+
+		switch {
+		case errored[d.door]:
+			rpt.Errored = append(rpt.Errored, id)
+		case failed[d.door]:
+			rpt.Failed = append(rpt.Failed, id)
+		case updated[d.door]:
+			rpt.Updated = append(rpt.Updated, id)
+		default:
+			rpt.Unchanged = append(rpt.Unchanged, id)
+		}
+	}
+
+	if activated {
+		return rpt, readers
+	}
+
+	return rpt, nil
+}
+
+// Parses and validates the doors worksheet. Rows without a door name are ignored and door names must
+// match the door names in the configuration.
+func parseDoors(values [][]any, devices []uhppote.Device) ([]door, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no data in doors spreadsheet/range")
+	}
+
+	index, _ := buildIndex(values[:1], []string{"door", "mode", "delay", "keypad"})
+	if _, ok := index["door"]; !ok {
+		return nil, fmt.Errorf("missing 'Door' column in doors worksheet")
+	}
+
+	get := func(record []any, field string) string {
+		if ix, ok := index[field]; ok {
+			return clean(value(record, ix))
+		}
+
+		return ""
+	}
+
+	configured := map[string]door{}
+	for _, d := range devices {
+		for i, name := range d.Doors {
+			if name != "" {
+				configured[normalise(name)] = door{
+					name:       name,
+					controller: d.DeviceID,
+					door:       uint8(i + 1),
+				}
+			}
+		}
+	}
+
+	doors := []door{}
+	rows := map[string]int{}
+
+	for i, record := range values[1:] {
+		row := i + 2
+		name := get(record, "door")
+		if name == "" {
+			continue
+		}
+
+		d, ok := configured[normalise(name)]
+		if !ok {
+			return nil, fmt.Errorf("doors row %v: unknown door '%v'", row, name)
+		} else if r, ok := rows[normalise(name)]; ok {
+			return nil, fmt.Errorf("doors row %v: duplicate door '%v' (row %v)", row, name, r)
+		}
+
+		if v := get(record, "mode"); v != "" {
+			if mode, ok := doorModes[normalise(v)]; !ok {
+				return nil, fmt.Errorf("doors row %v: invalid mode '%v' - expected 'controlled', 'normally open' or 'normally closed'", row, v)
+			} else {
+				d.mode = &mode
+			}
+		}
+
+		if v := get(record, "delay"); v != "" {
+			if delay, err := strconv.ParseUint(v, 10, 8); err != nil {
+				return nil, fmt.Errorf("doors row %v: invalid delay '%v' - expected a value in the interval [0..255]", row, v)
+			} else {
+				seconds := uint8(delay)
+				d.delay = &seconds
+			}
+		}
+
+		switch v := get(record, "keypad"); v {
+		case "":
+		case "Y", "N":
+			keypad := v == "Y"
+			d.keypad = &keypad
+		default:
+			return nil, fmt.Errorf("doors row %v: invalid keypad '%v' - expected Y or N", row, v)
+		}
+
+		rows[normalise(name)] = row
+		doors = append(doors, d)
+	}
+
+	return doors, nil
+}
+
+func keypadsFile(workdir string) string {
+	return filepath.Join(workdir, ".google", "uhppoted-app-sheets.keypads")
+}
+
+func (k *keypads) load(file string) error {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, k)
+}
+
+func (k keypads) store(file string) error {
+	dir := filepath.Dir(file)
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+
+	if bytes, err := json.MarshalIndent(k, "", "  "); err != nil {
+		return err
+	} else if err := os.WriteFile(file, bytes, 0660); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+)
+
+func testDoorsWorksheet() map[string][][]any {
+	worksheets := testWorksheets()
+	worksheets["Doors"] = [][]any{
+		[]any{"Door", "Controller", "Mode", "Delay", "Keypad"},
+		[]any{"Front Door", "405419896", "normally open", "5", "Y"},
+		[]any{"Side Door", "405419896", "controlled", "5", "N"},
+		[]any{"kitchen", "", "", "10", "N"},
+		[]any{"Garage", "", "", "", "N"},
+		[]any{"Workshop", "", "", "", "N"},
+		[]any{"Great Hall", "", "", "", "N"},
+		[]any{"Dungeon", "", "", "", "N"},
+		[]any{"Hogsmeade", "", "", "", "N"},
+	}
+
+	return worksheets
+}
+
+func TestLoadDoors(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testDoorsWorksheet())
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	cmd := LoadDoors{
+		command:      fake.command(t, sim),
+		area:         "Doors!A1:E",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	for range 2 {
+		if err := cmd.Execute(&Options{Config: config}); err != nil {
+			t.Fatalf("Unexpected error executing load-doors (%v)", err)
+		}
+	}
+
+	modes := map[uint32]map[uint8]types.DoorControlState{
+		405419896: map[uint8]types.DoorControlState{
+			1: types.DoorControlState{SerialNumber: 405419896, Door: 1, ControlState: types.NormallyOpen, Delay: 5},
+		},
+		303986753: map[uint8]types.DoorControlState{
+			2: types.DoorControlState{SerialNumber: 303986753, Door: 2, ControlState: types.Controlled, Delay: 10},
+		},
+	}
+
+	keypads := map[uint32]map[uint8]bool{
+		405419896: map[uint8]bool{1: true, 2: false, 3: false, 4: false},
+		303986753: map[uint8]bool{1: false, 2: false, 3: false, 4: false},
+	}
+
+	for _, id := range []uint32{405419896, 303986753} {
+		if c := sim.controllers[id]; !reflect.DeepEqual(c.modes, modes[id]) {
+			t.Errorf("%v: incorrect door modes\n   expected:%v\n   got:     %v", id, modes[id], c.modes)
+		} else if !reflect.DeepEqual(c.keypads, keypads[id]) {
+			t.Errorf("%v: incorrect keypads\n   expected:%v\n   got:     %v", id, keypads[id], c.keypads)
+		}
+	}
+
+	log := [][]any{
+		[]any{"303986753", "0", "4", "0", "0", "0", "0"},
+		[]any{"405419896", "0", "4", "0", "0", "0", "0"},
+		[]any{"303986753", "4", "0", "0", "0", "0", "0"},
+		[]any{"405419896", "4", "0", "0", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestLoadDoorsWithUnlistedKeypads(t *testing.T) {
+	worksheets := testWorksheets()
+	worksheets["Doors"] = [][]any{
+		[]any{"Door", "Keypad"},
+		[]any{"Front Door", "Y"},
+	}
+
+	fake, google := newFakeGoogle(t, worksheets)
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	cmd := LoadDoors{
+		command: fake.command(t, sim),
+		area:    "Doors!A1:B",
+		nolog:   true,
+	}
+
+	// ... keypad settings for the other doors are not known
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-doors (%v)", err)
+	}
+
+	if keypads := sim.controllers[405419896].keypads; keypads != nil {
+		t.Fatalf("Keypads updated without a setting for every door (%v)", keypads)
+	}
+
+	// ... all doors listed
+	all := valueRange{
+		area: "Doors!A2:B5",
+		values: [][]any{
+			[]any{"Front Door", "N"},
+			[]any{"Side Door", "Y"},
+			[]any{"Garage", "N"},
+			[]any{"Workshop", "Y"},
+		},
+	}
+
+	if err := google.Write(all); err != nil {
+		t.Fatalf("Unexpected error updating doors worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-doors (%v)", err)
+	}
+
+	// ... unlisted doors keep the settings last applied
+	partial := valueRange{
+		area: "Doors!A2:B5",
+		values: [][]any{
+			[]any{"Front Door", "Y"},
+			[]any{"", ""},
+			[]any{"", ""},
+			[]any{"", ""},
+		},
+	}
+
+	if err := google.Write(partial); err != nil {
+		t.Fatalf("Unexpected error updating doors worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-doors (%v)", err)
+	}
+
+	expected := map[uint8]bool{1: true, 2: true, 3: false, 4: true}
+	if keypads := sim.controllers[405419896].keypads; !reflect.DeepEqual(keypads, expected) {
+		t.Errorf("Incorrect keypads\n   expected:%v\n   got:     %v", expected, keypads)
+	}
+}
+
+func TestLoadDoorsWithDryRun(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testDoorsWorksheet())
+	sim := newSimulator(testControllers())
+
+	cmd := LoadDoors{
+		command:      fake.command(t, sim),
+		area:         "Doors!A1:E",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+		dryrun:       true,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-doors (%v)", err)
+	}
+
+	for _, id := range []uint32{405419896, 303986753} {
+		if c := sim.controllers[id]; c.modes != nil || c.keypads != nil {
+			t.Errorf("%v: unexpected door settings %v %v", id, c.modes, c.keypads)
+		}
+	}
+}
+
+func TestUploadDoors(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testDoorsWorksheet())
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	load := LoadDoors{
+		command: fake.command(t, sim),
+		area:    "Doors!A1:E",
+		nolog:   true,
+	}
+
+	if err := load.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-doors (%v)", err)
+	}
+
+	cmd := UploadDoors{
+		command: load.command,
+		area:    "Doors!A1:E",
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing upload-doors (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Door", "Controller", "Mode", "Delay", "Keypad"},
+		[]any{"Great Hall", "303986753", "controlled", "5", "N"},
+		[]any{"Kitchen", "303986753", "controlled", "10", "N"},
+		[]any{"Dungeon", "303986753", "controlled", "5", "N"},
+		[]any{"Hogsmeade", "303986753", "controlled", "5", "N"},
+		[]any{"Front Door", "405419896", "normally open", "5", "Y"},
+		[]any{"Side Door", "405419896", "controlled", "5", "N"},
+		[]any{"Garage", "405419896", "controlled", "5", "N"},
+		[]any{"Workshop", "405419896", "controlled", "5", "N"},
+	}
+
+	if rows := fake.values("Doors"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect doors worksheet\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestParseDoorsWithInvalidDoors(t *testing.T) {
+	header := []any{"Door", "Mode", "Delay", "Keypad"}
+	devices := []uhppote.Device{
+		uhppote.Device{DeviceID: 405419896, Doors: []string{"Front Door", "Side Door", "Garage", "Workshop"}},
+	}
+
+	tests := map[string][][]any{
+		"unknown door":   {header, {"Kitchen", "controlled", "5", "Y"}},
+		"invalid mode":   {header, {"Front Door", "open", "5", "Y"}},
+		"invalid delay":  {header, {"Front Door", "controlled", "256", "Y"}},
+		"invalid keypad": {header, {"Front Door", "controlled", "5", "yes"}},
+		"duplicate door": {header, {"Front Door", "controlled", "5", "Y"}, {"front door", "", "", ""}},
+		"missing column": {{"Name", "Mode"}, {"Front Door", "controlled"}},
+	}
+
+	for k, values := range tests {
+		if _, err := parseDoors(values, devices); err == nil {
+			t.Errorf("%v: expected error", k)
+		}
+	}
+	if _, err := parseDoors(tests["invalid delay"], devices); err == nil || !strings.Contains(err.Error(), "'256'") {
+		t.Errorf("Expected invalid delay error to include the worksheet value, got '%v'", err)
+	}
+}
@@ -0,0 +1,257 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Lockfile for a spreadsheet range, so that commands for different spreadsheets (or different ranges of
+// the same spreadsheet) can run concurrently. The lockfile records the process that holds the lock so
+// that a lock left behind by a process that has exited (or, for a process on another host, that has not
+// refreshed the lock within the maximum age) can be identified and reclaimed.
+type lock struct {
+	file string
+	info lockInfo
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Interval at which a held lock is refreshed (reduced for a maximum age of less than 4 minutes).
+const LOCK_REFRESH = time.Minute
+
+// Maximum age of a lockfile from another host for the commands that do not have a --lock-max-age option.
+const LOCK_MAX_AGE = 2 * time.Hour
+
+type lockInfo struct {
+	PID         int       `json:"pid"`
+	Host        string    `json:"host"`
+	Started     time.Time `json:"started"`
+	Refreshed   time.Time `json:"refreshed"`
+	Spreadsheet string    `json:"spreadsheet,omitempty"`
+	Range       string    `json:"range,omitempty"`
+	Controller  uint32    `json:"controller,omitempty"`
+}
+
+// Lockfiles for a set of controllers, acquired in controller ID order.
+type locks []*lock
+
+// Returns the lockfile path for a spreadsheet range e.g. <workdir>/.google/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms-ACL_A1_H.lock
+//
+// A list of ranges is sorted so that the same ranges share a lockfile irrespective of the order in which
+// they are listed.
+func lockFile(workdir, spreadsheet, area string) string {
+	ranges := strings.Split(area, ",")
+	for i, r := range ranges {
+		ranges[i] = strings.TrimSpace(r)
+	}
+
+	slices.Sort(ranges)
+
+	re := regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+	name := fmt.Sprintf("%v-%v.lock", re.ReplaceAllString(spreadsheet, "_"), re.ReplaceAllString(strings.Join(ranges, ","), "_"))
+
+	return filepath.Join(workdir, ".google", name)
+}
+
+// Returns the lockfile path for a controller e.g. <workdir>/.google/controller-405419896.lock
+func controllerLockFile(workdir string, controller uint32) string {
+	return filepath.Join(workdir, ".google", fmt.Sprintf("controller-%v.lock", controller))
+}
+
+// Creates the lockfile for a spreadsheet range, reclaiming an existing lockfile if it is stale. A lockfile
+// is stale if the process that created it is no longer running on this host or, for a lock created on
+// another host (where the process cannot be checked), if the lock has not been refreshed within maxAge
+// (0 to never reclaim a lock from another host).
+func acquireLock(file, spreadsheet, area string, maxAge time.Duration) (*lock, error) {
+	return acquire(file, lockInfo{Spreadsheet: spreadsheet, Range: area}, maxAge)
+}
+
+// Creates the lockfile for a controller, reclaiming an existing lockfile if it is stale (as for acquireLock).
+func acquireControllerLock(workdir string, controller uint32, maxAge time.Duration) (*lock, error) {
+	return acquire(controllerLockFile(workdir, controller), lockInfo{Controller: controller}, maxAge)
+}
+
+func acquire(file string, info lockInfo, maxAge time.Duration) (*lock, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0770); err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now()
+
+	info.PID = os.Getpid()
+	info.Host = host
+	info.Started = now
+	info.Refreshed = now
+
+	l := lock{
+		file: file,
+		info: info,
+	}
+
+	for range 2 {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if err == nil {
+			defer f.Close()
+
+			if err := json.NewEncoder(f).Encode(l.info); err != nil {
+				os.Remove(file)
+				return nil, err
+			}
+
+			return &l, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		existing, err := readLock(file)
+		if err != nil {
+			return nil, fmt.Errorf("lockfile '%v' in use (%v)", file, err)
+		}
+
+		if stale, reason := existing.stale(host, maxAge); !stale {
+			return nil, fmt.Errorf("lockfile '%v' in use by PID %v on %v since %v", file, existing.PID, existing.Host, existing.Started.Format("2006-01-02 15:04:05"))
+		} else {
+			// ... another process may have reclaimed the stale lock in the meantime, in which case the lockfile is
+			//     the other process's fresh lock and must not be removed
+			if current, err := readLock(file); err == nil && !current.same(existing) {
+				continue
+			}
+
+			warnf("Reclaiming stale lockfile '%v' (%v)", file, reason)
+
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("lockfile '%v' in use", file)
+}
+
+// Refreshes the lock in the background at the interval until the lock is released, independently of
+// how long the command (or a 'run' interval) takes.
+func (l *lock) keepalive(interval time.Duration) {
+	if l == nil || interval <= 0 {
+		return
+	}
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-tick.C:
+				if err := l.refresh(); err != nil {
+					warnf("error refreshing lockfile (%v)", err)
+				}
+
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Updates the lockfile 'refreshed' time for a long-lived process, so that the lock is not regarded as stale.
+// The lockfile is not updated if it has been reclaimed by another process.
+func (l *lock) refresh() error {
+	if l == nil {
+		return nil
+	}
+
+	if info, err := readLock(l.file); err != nil {
+		return err
+	} else if !info.same(&l.info) {
+		return fmt.Errorf("lockfile '%v' reclaimed by PID %v on %v", l.file, info.PID, info.Host)
+	}
+
+	l.info.Refreshed = time.Now()
+
+	if bytes, err := json.Marshal(l.info); err != nil {
+		return err
+	} else {
+		return os.WriteFile(l.file, append(bytes, '\n'), 0660)
+	}
+}
+
+// Removes the lockfile, unless it has been reclaimed by another process.
+func (l *lock) release() {
+	if l == nil {
+		return
+	}
+
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+
+	if info, err := readLock(l.file); err == nil && info.same(&l.info) {
+		infof("Removing lockfile '%v'", l.file)
+		os.Remove(l.file)
+	}
+}
+
+// Releases the locks in the reverse order to which they were acquired.
+func (l locks) release() {
+	for _, v := range slices.Backward(l) {
+		v.release()
+	}
+}
+
+func readLock(file string) (*lockInfo, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info := lockInfo{}
+	if err := json.Unmarshal(bytes, &info); err != nil {
+		// ... partially written or unrecognised lockfile - fall back on the file modification time
+		if stat, err := os.Stat(file); err != nil {
+			return nil, err
+		} else {
+			info.Started = stat.ModTime()
+			info.Refreshed = stat.ModTime()
+		}
+	}
+
+	return &info, nil
+}
+
+// Returns true if both lockfiles were created by the same process at the same time.
+func (i *lockInfo) same(other *lockInfo) bool {
+	return i.PID == other.PID && i.Host == other.Host && i.Started.Equal(other.Started)
+}
+
+// Returns true (and the reason) if the lock was created by a process on this host that is no longer running.
+// A lock created on another host (or without a PID e.g. a partially written lockfile) is stale if it has not
+// been refreshed within maxAge - a lock held by a running process on this host is never stale.
+func (i lockInfo) stale(host string, maxAge time.Duration) (bool, string) {
+	if i.PID > 0 && i.Host == host {
+		if i.PID != os.Getpid() && !running(i.PID) {
+			return true, fmt.Sprintf("PID %v is not running", i.PID)
+		}
+
+		return false, ""
+	}
+
+	if maxAge > 0 && time.Since(i.Refreshed) > maxAge {
+		return true, fmt.Sprintf("not refreshed since %v", i.Refreshed.Format("2006-01-02 15:04:05"))
+	}
+
+	return false, ""
+}
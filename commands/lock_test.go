@@ -0,0 +1,277 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLockInfo(t *testing.T, file string, info lockInfo) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0770); err != nil {
+		t.Fatalf("Error creating lockfile directory (%v)", err)
+	}
+
+	if bytes, err := json.Marshal(info); err != nil {
+		t.Fatalf("Error encoding lockfile (%v)", err)
+	} else if err := os.WriteFile(file, bytes, 0660); err != nil {
+		t.Fatalf("Error writing lockfile (%v)", err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	file := lockFile("/var/uhppoted", fakeSpreadsheetID, "ACL!A1:H")
+	expected := filepath.Join("/var/uhppoted", ".google", fakeSpreadsheetID+"-ACL_A1_H.lock")
+
+	if file != expected {
+		t.Errorf("Incorrect lockfile\n   expected:%v\n   got:     %v", expected, file)
+	}
+}
+
+func TestLockFileWithMultipleRanges(t *testing.T) {
+	p := lockFile("/var/uhppoted", fakeSpreadsheetID, "Staff!A1:H,Students!A1:H")
+	q := lockFile("/var/uhppoted", fakeSpreadsheetID, " Students!A1:H, Staff!A1:H")
+
+	if p != q {
+		t.Errorf("Expected the same lockfile for the same ranges\n   %v\n   %v", p, q)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+
+	l, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	if info, err := readLock(file); err != nil {
+		t.Fatalf("Error reading lockfile (%v)", err)
+	} else if info.PID != os.Getpid() || info.Spreadsheet != fakeSpreadsheetID || info.Range != "ACL!A1:H" || info.Started.IsZero() {
+		t.Errorf("Incorrect lockfile contents %+v", info)
+	}
+
+	if _, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", time.Hour); err == nil {
+		t.Errorf("Expected error acquiring lock in use")
+	}
+
+	l.release()
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Lockfile not removed (%v)", err)
+	}
+}
+
+func TestAcquireLockWithDeadProcess(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+	host, _ := os.Hostname()
+
+	writeLockInfo(t, file, lockInfo{
+		PID:       99999999,
+		Host:      host,
+		Started:   time.Now(),
+		Refreshed: time.Now(),
+	})
+
+	l, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected stale lock to be reclaimed (%v)", err)
+	}
+
+	l.release()
+}
+
+func TestAcquireLockWithStaleLock(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+
+	writeLockInfo(t, file, lockInfo{
+		PID:       os.Getppid(),
+		Host:      "elsewhere",
+		Started:   time.Now().Add(-3 * time.Hour),
+		Refreshed: time.Now().Add(-3 * time.Hour),
+	})
+
+	if _, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", 0); err == nil || !strings.Contains(err.Error(), "in use by PID") {
+		t.Errorf("Expected 'in use' error acquiring lock with no maximum age, got %v", err)
+	}
+
+	if _, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", 4*time.Hour); err == nil {
+		t.Errorf("Expected error acquiring lock refreshed within maximum age")
+	}
+
+	l, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected stale lock to be reclaimed (%v)", err)
+	}
+
+	l.release()
+}
+
+func TestAcquireLockWithOldLiveLock(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+	host, _ := os.Hostname()
+
+	// ... a lock held by a running process on this host is never reclaimed, however old
+	writeLockInfo(t, file, lockInfo{
+		PID:       os.Getppid(),
+		Host:      host,
+		Started:   time.Now().Add(-3 * time.Hour),
+		Refreshed: time.Now().Add(-3 * time.Hour),
+	})
+
+	if _, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", 2*time.Hour); err == nil || !strings.Contains(err.Error(), "in use by PID") {
+		t.Errorf("Expected 'in use' error acquiring lock held by a running process, got %v", err)
+	}
+}
+
+func TestLockKeepalive(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+
+	l, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	started := l.info.Refreshed
+
+	l.keepalive(10 * time.Millisecond)
+
+	if !eventually(func() bool { info, err := readLock(file); return err == nil && info.Refreshed.After(started) }) {
+		t.Errorf("Lockfile not refreshed")
+	}
+
+	l.release()
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Lockfile not removed (%v)", err)
+	}
+}
+
+func TestReleaseReclaimedLock(t *testing.T) {
+	file := lockFile(t.TempDir(), fakeSpreadsheetID, "ACL!A1:H")
+
+	l, err := acquireLock(file, fakeSpreadsheetID, "ACL!A1:H", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	// ... reclaimed by another process
+	writeLockInfo(t, file, lockInfo{
+		PID:     os.Getppid(),
+		Started: time.Now(),
+	})
+
+	l.release()
+
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Reclaimed lockfile removed on release (%v)", err)
+	}
+}
+
+func TestLoadACLWithLockedSpreadsheet(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	// ... lock on a different range should not block load-acl
+	other, err := acquireLock(lockFile(cmd.workdir, fakeSpreadsheetID, "Staff!A1:H"), fakeSpreadsheetID, "Staff!A1:H", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	defer other.release()
+
+	l, err := acquireLock(lockFile(cmd.workdir, fakeSpreadsheetID, cmd.area), fakeSpreadsheetID, cmd.area, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with locked spreadsheet range")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+
+	l.release()
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+}
+
+func TestControllerLockFile(t *testing.T) {
+	file := controllerLockFile("/var/uhppoted", 405419896)
+	expected := filepath.Join("/var/uhppoted", ".google", "controller-405419896.lock")
+
+	if file != expected {
+		t.Errorf("Incorrect lockfile\n   expected:%v\n   got:     %v", expected, file)
+	}
+}
+
+func TestLoadACLWithLockedController(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+
+	l, err := acquireControllerLock(cmd.workdir, 303986753, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with locked controller")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+	checkCards(t, sim, 303986753, controllers[303986753].cards...)
+
+	if _, err := os.Stat(controllerLockFile(cmd.workdir, 405419896)); err == nil {
+		t.Errorf("Controller lockfile not released after failing to lock all controllers")
+	}
+
+	l.release()
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+}
+
+func TestRollbackWithLockedController(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	config := sim.config(t)
+
+	load := testLoadACL(fake, sim, t)
+	load.snapshots = 10
+
+	if err := load.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	rollback := Rollback{
+		LoadACL: LoadACL{
+			command: load.command,
+			nolog:   true,
+		},
+	}
+
+	l, err := acquireControllerLock(load.workdir, 405419896, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock (%v)", err)
+	}
+
+	defer l.release()
+
+	if err := rollback.Execute(&Options{Config: config}); err == nil {
+		t.Fatalf("Expected error executing rollback with locked controller")
+	} else if !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Unexpected error executing rollback (%v)", err)
+	}
+}
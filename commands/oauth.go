@@ -2,14 +2,21 @@ package commands
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	lib "github.com/uhppoted/uhppoted-lib/os"
+	"golang.org/x/crypto/scrypt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
@@ -17,12 +24,45 @@ import (
 const SHEETS = "https://www.googleapis.com/auth/spreadsheets"
 const DRIVE = "https://www.googleapis.com/auth/drive"
 
-func authorize(credentials, scope, dir string) (*http.Client, error) {
+// Environment variable for the token encryption key, if not specified with --token-key.
+const TOKEN_KEY = "UHPPOTED_APP_SHEETS_TOKEN_KEY"
+
+// Encrypted token file. The salt, nonce and ciphertext are base64 encoded by the JSON encoder.
+type encryptedToken struct {
+	Encryption string `json:"encryption"`
+	KDF        kdf    `json:"kdf"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Key derivation function (and parameters) used to derive the AES-256 key from the token key text.
+type kdf struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	N         int    `json:"N"`
+	R         int    `json:"r"`
+	P         int    `json:"p"`
+}
+
+// scrypt parameters for deriving the token encryption key (as recommended for interactive logins in the
+// scrypt package documentation).
+const (
+	SCRYPT_N    = 32768
+	SCRYPT_R    = 8
+	SCRYPT_P    = 1
+	SCRYPT_SALT = 16
+)
+
+func authorize(credentials, scope, dir string, key []byte) (*http.Client, error) {
 	b, err := os.ReadFile(credentials)
 	if err != nil {
 		return nil, err
 	}
 
+	if isServiceAccount(b) {
+		return serviceAccountClient(b, scope)
+	}
+
 	config, err := google.ConfigFromJSON(b, scope)
 	if err != nil {
 		return nil, err
@@ -43,13 +83,40 @@ func authorize(credentials, scope, dir string) (*http.Client, error) {
 		file = filepath.Join(dir, fmt.Sprintf("%s.tokens", name))
 	}
 
-	return getClient(file, config)
+	return getClient(file, config, key)
 }
 
-// Extracts a token from the tokens file and returns the configured client.
-func getClient(tokens string, config *oauth2.Config) (*http.Client, error) {
-	token, err := tokenFromFile(tokens)
+// Returns true if the credentials are a Google service account key rather than an OAuth client ID.
+func isServiceAccount(credentials []byte) bool {
+	key := struct {
+		Type string `json:"type"`
+	}{}
+
+	if err := json.Unmarshal(credentials, &key); err != nil {
+		return false
+	}
+
+	return key.Type == "service_account"
+}
+
+// Returns a client that authenticates with the service account key. The access tokens are
+// requested from the key 'token_uri' as required, so no 'authorise' tokens are needed - the
+// spreadsheet just needs to be shared with the service account email address.
+func serviceAccountClient(credentials []byte, scope string) (*http.Client, error) {
+	config, err := google.JWTConfigFromJSON(credentials, scope)
 	if err != nil {
+		return nil, err
+	}
+
+	return config.Client(context.Background()), nil
+}
+
+// Extracts a token from the tokens file and returns the configured client.
+func getClient(tokens string, config *oauth2.Config, key []byte) (*http.Client, error) {
+	token, err := tokenFromFile(tokens, key)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if err != nil {
 		fmt.Println("")
 		fmt.Println("   > NOT AUTHORISED")
 		fmt.Println("   >")
@@ -60,7 +127,78 @@ func getClient(tokens string, config *oauth2.Config) (*http.Client, error) {
 		return nil, fmt.Errorf("not authorised")
 	}
 
-	return config.Client(context.Background(), token), nil
+	source := persistentTokenSource{
+		source: config.TokenSource(context.Background(), token),
+		file:   tokens,
+		key:    key,
+		scope:  scopeName(config.Scopes),
+		token:  token,
+	}
+
+	return oauth2.NewClient(context.Background(), &source), nil
+}
+
+// Token source that saves refreshed tokens to the token file and replaces the opaque OAuth2 errors
+// for an expired or revoked token with an error that identifies the scope to be re-authorised.
+type persistentTokenSource struct {
+	sync.Mutex
+	source oauth2.TokenSource
+	file   string
+	key    []byte
+	scope  string
+	token  *oauth2.Token
+}
+
+func (s *persistentTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	token, err := s.source.Token()
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+
+		if errors.As(err, &rerr) && rerr.ErrorCode != "" {
+			return nil, fmt.Errorf("%v token expired or revoked (%v) - please re-authorise access with the 'authorise' command", s.scope, rerr.ErrorCode)
+		}
+
+		if s.token.RefreshToken == "" {
+			return nil, fmt.Errorf("%v token expired - please re-authorise access with the 'authorise' command", s.scope)
+		}
+
+		return nil, fmt.Errorf("%v token refresh failed (%w)", s.scope, err)
+	}
+
+	if token.AccessToken != s.token.AccessToken {
+		// ... Google only returns a refresh token with the initial authorisation
+		if token.RefreshToken == "" {
+			token.RefreshToken = s.token.RefreshToken
+		}
+
+		if err := writeToken(s.file, token, s.key); err != nil {
+			warnf("unable to save refreshed %v token to %v (%v)", s.scope, s.file, err)
+		} else {
+			debugf("saved refreshed %v token to %v", s.scope, s.file)
+		}
+
+		s.token = token
+	}
+
+	return token, nil
+}
+
+// Returns a descriptive name for the OAuth2 scope, for error messages.
+func scopeName(scopes []string) string {
+	for _, scope := range scopes {
+		switch {
+		case strings.HasPrefix(scope, SHEETS):
+			return "Google Sheets"
+
+		case strings.HasPrefix(scope, DRIVE):
+			return "Google Drive"
+		}
+	}
+
+	return strings.Join(scopes, ",")
 }
 
 // // Request a token from the web, then returns the retrieved token.
@@ -81,33 +219,179 @@ func getClient(tokens string, config *oauth2.Config) (*http.Client, error) {
 // 	return tok
 // }
 
-// Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+// Retrieves a token from a local file, decrypting it if it was saved encrypted.
+func tokenFromFile(file string, key []byte) (*oauth2.Token, error) {
+	bytes, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+
+	envelope := encryptedToken{}
+	if err := json.Unmarshal(bytes, &envelope); err == nil && envelope.Encryption != "" {
+		if key == nil {
+			return nil, fmt.Errorf("%v is encrypted - requires a token key (--token-key or %v)", file, TOKEN_KEY)
+		}
+
+		if bytes, err = decrypt(envelope, key); err != nil {
+			return nil, fmt.Errorf("unable to decrypt %v (%v)", file, err)
+		}
+	}
+
+	token := oauth2.Token{}
+	if err := json.Unmarshal(bytes, &token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
 }
 
 // Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
+func saveToken(path string, token *oauth2.Token, key []byte) {
 	fmt.Printf("Saving credential file to: %s\n", path)
 
-	err := os.MkdirAll(filepath.Dir(path), 0770)
-	if err != nil {
+	if err := writeToken(path, token, key); err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
 	}
+}
 
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+// Writes a token to a file, encrypted if a key is provided.
+func writeToken(path string, token *oauth2.Token, key []byte) error {
+	bytes, err := json.Marshal(token)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return err
 	}
 
-	defer f.Close()
+	if key != nil {
+		if envelope, err := encrypt(bytes, key); err != nil {
+			return err
+		} else if bytes, err = json.Marshal(envelope); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+		return err
+	}
+
+	// ... replace the token file atomically so that an interrupted write never leaves a truncated token
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return lib.Rename(tmp.Name(), path)
+}
+
+// Returns the token encryption key text from the key file or, if no key file is specified, from the
+// UHPPOTED_APP_SHEETS_TOKEN_KEY environment variable. The 256-bit AES key is derived from the key text
+// with scrypt and a random salt when a token is encrypted. Returns nil if neither is set i.e. the tokens
+// are not encrypted.
+func tokenKey(file string) ([]byte, error) {
+	text := os.Getenv(TOKEN_KEY)
+
+	if strings.TrimSpace(file) != "" {
+		if bytes, err := os.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("unable to read token key (%v)", err)
+		} else {
+			text = string(bytes)
+		}
+	}
+
+	if text = strings.TrimSpace(text); text == "" {
+		return nil, nil
+	}
+
+	return []byte(text), nil
+}
+
+func encrypt(plaintext []byte, key []byte) (*encryptedToken, error) {
+	salt := make([]byte, SCRYPT_SALT)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	params := kdf{
+		Algorithm: "scrypt",
+		Salt:      salt,
+		N:         SCRYPT_N,
+		R:         SCRYPT_R,
+		P:         SCRYPT_P,
+	}
+
+	gcm, err := newGCM(key, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &encryptedToken{
+		Encryption: "AES-256-GCM",
+		KDF:        params,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}, nil
+}
+
+func decrypt(envelope encryptedToken, key []byte) ([]byte, error) {
+	if envelope.Encryption != "AES-256-GCM" {
+		return nil, fmt.Errorf("unsupported encryption '%v'", envelope.Encryption)
+	}
+
+	gcm, err := newGCM(key, envelope.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect token key")
+	}
+
+	return plaintext, nil
+}
+
+// Derives the 256-bit AES key from the token key text and returns an AES-GCM cipher.
+func newGCM(key []byte, kdf kdf) (cipher.AEAD, error) {
+	if kdf.Algorithm != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function '%v'", kdf.Algorithm)
+	}
+
+	if len(kdf.Salt) < SCRYPT_SALT {
+		return nil, fmt.Errorf("invalid key derivation salt")
+	}
+
+	// ... reject parameters from a tampered token file that would make the key derivation either trivial
+	//     or too expensive to compute (N must be a power of 2 between 2^14 and 2^20)
+	if kdf.N < 1<<14 || kdf.N > 1<<20 || kdf.N&(kdf.N-1) != 0 || kdf.R < 1 || kdf.R > 32 || kdf.P < 1 || kdf.P > 16 {
+		return nil, fmt.Errorf("invalid key derivation parameters (N:%v r:%v p:%v)", kdf.N, kdf.R, kdf.P)
+	}
+
+	aeskey, err := scrypt.Key(key, kdf.Salt, kdf.N, kdf.R, kdf.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(aeskey)
+	if err != nil {
+		return nil, err
+	}
 
-	json.NewEncoder(f).Encode(token)
+	return cipher.NewGCM(block)
 }
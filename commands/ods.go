@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codec for OpenDocument (.ods) spreadsheets. Modified worksheets are re-encoded by replacing
+// the rows in the table element, leaving the column definitions and everything else intact.
+type ods struct {
+}
+
+type odsTable struct {
+	name  string
+	rows  [][]cell
+	start int64
+	end   int64
+}
+
+const (
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// Caps the number of 'repeated' non-empty rows and columns
+const odsMaxRepeated = 1024
+
+func (o *ods) decode(content map[string][]byte) ([]*worksheet, error) {
+	b, ok := content["content.xml"]
+	if !ok {
+		return nil, fmt.Errorf("missing content.xml")
+	}
+
+	tables, err := o.scan(b)
+	if err != nil {
+		return nil, err
+	}
+
+	sheets := []*worksheet{}
+	for _, t := range tables {
+		sheets = append(sheets, &worksheet{
+			name: t.name,
+			rows: t.rows,
+		})
+	}
+
+	return sheets, nil
+}
+
+func (o *ods) encode(content map[string][]byte, sheets []*worksheet) error {
+	b, ok := content["content.xml"]
+	if !ok {
+		return fmt.Errorf("missing content.xml")
+	}
+
+	tables, err := o.scan(b)
+	if err != nil {
+		return err
+	}
+
+	if len(tables) != len(sheets) {
+		return fmt.Errorf("worksheet mismatch (expected %v, got %v)", len(sheets), len(tables))
+	}
+
+	var buffer bytes.Buffer
+	var offset int64
+
+	for i, t := range tables {
+		sheet := sheets[i]
+		if !sheet.dirty {
+			continue
+		}
+
+		if t.start < 0 {
+			return fmt.Errorf("unable to locate rows for worksheet '%v'", sheet.name)
+		}
+
+		buffer.Write(b[offset:t.start])
+		buffer.Write(o.encodeRows(sheet))
+		offset = t.end
+	}
+
+	buffer.Write(b[offset:])
+
+	content["content.xml"] = buffer.Bytes()
+
+	return nil
+}
+
+// Extracts the tables from the content.xml document, along with the byte offsets of the table rows.
+func (o *ods) scan(b []byte) ([]odsTable, error) {
+	tables := []odsTable{}
+	decoder := xml.NewDecoder(bytes.NewReader(b))
+
+	var table *odsTable
+	var row []cell
+	var value *cell
+	var paragraphs []string
+	var text *strings.Builder
+
+	stack := []xml.Name{}
+	rowRepeat := 1
+	cellRepeat := 1
+	emptyRows := 0
+	emptyCells := 0
+	annotation := 0
+
+	attr := func(e xml.StartElement, space, local string) string {
+		for _, a := range e.Attr {
+			if a.Name.Space == space && a.Name.Local == local {
+				return a.Value
+			}
+		}
+
+		return ""
+	}
+
+	repeated := func(e xml.StartElement, local string) int {
+		if n, err := strconv.Atoi(attr(e, odsTableNS, local)); err == nil && n > 0 {
+			return n
+		}
+
+		return 1
+	}
+
+	isRows := func(name xml.Name) bool {
+		if name.Space == odsTableNS {
+			switch name.Local {
+			case "table-row", "table-rows", "table-header-rows", "table-row-group":
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch e := token.(type) {
+		case xml.StartElement:
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			stack = append(stack, e.Name)
+
+			switch {
+			case e.Name.Space == odsTableNS && e.Name.Local == "table" && table == nil:
+				table = &odsTable{
+					name:  attr(e, odsTableNS, "name"),
+					rows:  [][]cell{},
+					start: -1,
+					end:   -1,
+				}
+				emptyRows = 0
+
+			case table == nil:
+
+			case isRows(e.Name) && parent.Space == odsTableNS && parent.Local == "table":
+				if table.start < 0 {
+					table.start = offset
+				}
+
+				if e.Name.Local == "table-row" {
+					row = []cell{}
+					rowRepeat = repeated(e, "number-rows-repeated")
+					emptyCells = 0
+				}
+
+			case e.Name.Space == odsTableNS && e.Name.Local == "table-row":
+				row = []cell{}
+				rowRepeat = repeated(e, "number-rows-repeated")
+				emptyCells = 0
+
+			case e.Name.Space == odsTableNS && (e.Name.Local == "table-cell" || e.Name.Local == "covered-table-cell"):
+				cellRepeat = repeated(e, "number-columns-repeated")
+				paragraphs = []string{}
+				value = &cell{
+					style: attr(e, odsTableNS, "style-name"),
+				}
+
+				switch attr(e, odsOfficeNS, "value-type") {
+				case "float", "percentage", "currency":
+					value.value = attr(e, odsOfficeNS, "value")
+					value.numeric = value.value != ""
+
+				case "date":
+					v := attr(e, odsOfficeNS, "date-value")
+					if t, err := time.Parse("2006-01-02T15:04:05", v); err == nil {
+						value.value = t.Format("2006-01-02 15:04:05")
+					} else {
+						value.value = strings.TrimSuffix(v, "T00:00:00")
+					}
+
+				case "boolean":
+					value.value = strings.ToUpper(attr(e, odsOfficeNS, "boolean-value"))
+				}
+
+			case e.Name.Space == odsOfficeNS && e.Name.Local == "annotation":
+				annotation++
+
+			case e.Name.Space == odsTextNS && e.Name.Local == "p" && value != nil && annotation == 0:
+				text = &strings.Builder{}
+
+			case e.Name.Space == odsTextNS && e.Name.Local == "s" && text != nil:
+				n := 1
+				if v, err := strconv.Atoi(attr(e, odsTextNS, "c")); err == nil && v > 0 {
+					n = v
+				}
+				text.WriteString(strings.Repeat(" ", n))
+
+			case e.Name.Space == odsTextNS && e.Name.Local == "tab" && text != nil:
+				text.WriteString("\t")
+
+			case e.Name.Space == odsTextNS && e.Name.Local == "line-break" && text != nil:
+				text.WriteString("\n")
+			}
+
+		case xml.CharData:
+			if text != nil {
+				text.Write(e)
+			}
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			switch {
+			case table == nil:
+
+			case e.Name.Space == odsTableNS && e.Name.Local == "table":
+				tables = append(tables, *table)
+				table = nil
+
+			case e.Name.Space == odsTextNS && e.Name.Local == "p" && text != nil:
+				paragraphs = append(paragraphs, text.String())
+				text = nil
+
+			case e.Name.Space == odsOfficeNS && e.Name.Local == "annotation":
+				annotation--
+
+			case e.Name.Space == odsTableNS && (e.Name.Local == "table-cell" || e.Name.Local == "covered-table-cell"):
+				if value != nil {
+					if value.value == "" && len(paragraphs) > 0 {
+						value.value = strings.Join(paragraphs, "\n")
+					}
+
+					if value.value == "" {
+						emptyCells += cellRepeat
+					} else {
+						for range emptyCells {
+							row = append(row, cell{})
+						}
+
+						for range min(cellRepeat, odsMaxRepeated) {
+							row = append(row, *value)
+						}
+
+						emptyCells = 0
+					}
+				}
+
+				value = nil
+
+			case e.Name.Space == odsTableNS && e.Name.Local == "table-row":
+				if len(row) == 0 {
+					emptyRows += rowRepeat
+				} else {
+					for range emptyRows {
+						table.rows = append(table.rows, []cell{})
+					}
+
+					for range min(rowRepeat, odsMaxRepeated) {
+						table.rows = append(table.rows, slices.Clone(row))
+					}
+
+					emptyRows = 0
+				}
+
+				row = nil
+			}
+
+			if table != nil && isRows(e.Name) && parent.Space == odsTableNS && parent.Local == "table" {
+				table.end = decoder.InputOffset()
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+func (o *ods) encodeRows(sheet *worksheet) []byte {
+	var b bytes.Buffer
+
+	for _, row := range sheet.rows {
+		b.WriteString("<table:table-row>")
+		if len(row) == 0 {
+			b.WriteString("<table:table-cell/>")
+		}
+
+		for _, c := range row {
+			style := ""
+			if c.style != "" {
+				style = ` table:style-name="` + o.escape(c.style) + `"`
+			}
+
+			switch {
+			case c.value == "":
+				fmt.Fprintf(&b, `<table:table-cell%v/>`, style)
+
+			case c.numeric:
+				fmt.Fprintf(&b, `<table:table-cell%v office:value-type="float" office:value="%v"><text:p>%v</text:p></table:table-cell>`, style, c.value, c.value)
+
+			default:
+				fmt.Fprintf(&b, `<table:table-cell%v office:value-type="string"><text:p>%v</text:p></table:table-cell>`, style, o.escape(c.value))
+			}
+		}
+
+		b.WriteString("</table:table-row>")
+	}
+
+	// ... ODF requires at least one row
+	if len(sheet.rows) == 0 {
+		b.WriteString("<table:table-row><table:table-cell/></table:table-row>")
+	}
+
+	return b.Bytes()
+}
+
+func (o *ods) escape(s string) string {
+	var b bytes.Buffer
+
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
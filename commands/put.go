@@ -1,17 +1,12 @@
 package commands
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-
-	"google.golang.org/api/option"
-	"google.golang.org/api/sheets/v4"
 )
 
 var PutCmd = Put{
@@ -20,6 +15,8 @@ var PutCmd = Put{
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
 
@@ -101,37 +98,13 @@ func (cmd *Put) Execute(args ...any) error {
 		return fmt.Errorf("--file is a required option")
 	}
 
-	match = regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(cmd.url)
-	if len(match) < 2 {
-		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
-	}
-
-	spreadsheetId := match[1]
-	region := cmd.area
-
-	if cmd.debug {
-		debugf("Spreadsheet - ID:%s  range:%s", spreadsheetId, region)
-	}
-
-	// ... authorise
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
-	}
-
-	client, err := authorize(cmd.credentials, SHEETS, tokens)
+	backend, err := cmd.backend(options.context())
 	if err != nil {
-		return fmt.Errorf("authentication/authorization error (%v)", err)
-	}
-
-	google, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return fmt.Errorf("unable to create new Sheets client (%v)", err)
+		return err
 	}
 
-	spreadsheet, err := getSpreadsheet(google, spreadsheetId)
-	if err != nil {
-		return err
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), cmd.area)
 	}
 
 	f, err := os.Open(cmd.file)
@@ -148,16 +121,11 @@ func (cmd *Put) Execute(args ...any) error {
 		return fmt.Errorf("invalid TSV file (%v)", err)
 	}
 
-	if err := cmd.clear(google, spreadsheet); err != nil {
+	if err := cmd.clear(backend); err != nil {
 		return err
 	}
 
-	rq := sheets.BatchUpdateValuesRequest{
-		ValueInputOption: "USER_ENTERED",
-		Data:             []*sheets.ValueRange{header, data},
-	}
-
-	if _, err := google.Spreadsheets.Values.BatchUpdate(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
+	if err := backend.Write(*header, *data); err != nil {
 		return err
 	}
 
@@ -166,7 +134,7 @@ func (cmd *Put) Execute(args ...any) error {
 	return nil
 }
 
-func (cmd *Put) clear(google *sheets.Service, spreadsheet *sheets.Spreadsheet) error {
+func (cmd *Put) clear(backend Backend) error {
 	match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(cmd.area)
 	if len(match) < 5 {
 		return fmt.Errorf("invalid spreadsheet range '%s'", cmd.area)
@@ -179,5 +147,5 @@ func (cmd *Put) clear(google *sheets.Service, spreadsheet *sheets.Spreadsheet) e
 
 	data := fmt.Sprintf("%s!%s%v:%s", name, left, top+1, right)
 
-	return clear(google, spreadsheet, []string{data})
+	return backend.Clear(data)
 }
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry policy for the Google Sheets and Google Drive API requests.
+type retryPolicy struct {
+	retries  int           // maximum number of retries after a rate-limit or transient error
+	backoff  time.Duration // initial retry delay, doubled after each retry
+	maxDelay time.Duration // upper limit on the (exponential) retry delay
+	budget   int           // maximum number of requests per minute (0 for no limit)
+}
+
+// http.RoundTripper that retries Google API requests that fail with a rate-limit (429) or transient
+// (5xx) error, or a network error, with exponential backoff. A Retry-After header in the response
+// takes precedence over the computed backoff. Requests are also limited to the per-minute budget,
+// shared across all the transports created for the same spreadsheet.
+//
+// Note that the Sheets 'append' request is not idempotent - a retried append that failed after
+// the rows were written may duplicate rows on the log/report worksheets, which is preferable to
+// leaving them half-written.
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    retryPolicy
+	limiter   *rateLimiter
+}
+
+// Sliding window request counter for the per-minute request budget.
+type rateLimiter struct {
+	sync.Mutex
+	limit    int
+	window   time.Duration
+	requests []time.Time
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: time.Minute,
+	}
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	rq := request
+
+	// ... make the request body replayable
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		body, err := io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		rq = request.Clone(ctx)
+		rq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		rq.Body, _ = rq.GetBody()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.wait(request); err != nil {
+			return nil, err
+		}
+
+		if attempt > 0 && rq.GetBody != nil {
+			body, err := rq.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			rq = rq.Clone(ctx)
+			rq.Body = body
+		}
+
+		response, err := t.transport.RoundTrip(rq)
+		if attempt >= t.policy.retries || !retryable(response, err) || ctx.Err() != nil {
+			return response, err
+		}
+
+		delay := t.delay(attempt, response)
+		var status string
+		if err != nil {
+			status = err.Error()
+		} else {
+			status = response.Status
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		warnf("Google API retry  method:%v  path:%v  status:%v  attempt:%v/%v  delay:%v",
+			request.Method, request.URL.Path, status, attempt+1, t.policy.retries, delay)
+
+		if err := sleep(request, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns the delay before the next retry, from the response Retry-After header if present or
+// otherwise the exponential backoff (with jitter) for the attempt. The delay is capped at maxDelay
+// (if set) so that a misbehaving server cannot stall a command indefinitely.
+func (t *retryTransport) delay(attempt int, response *http.Response) time.Duration {
+	capped := func(delay time.Duration) time.Duration {
+		if t.policy.maxDelay > 0 {
+			return min(delay, t.policy.maxDelay)
+		}
+
+		return delay
+	}
+
+	if response != nil {
+		if v := response.Header.Get("Retry-After"); v != "" {
+			if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+				return capped(time.Duration(seconds) * time.Second)
+			} else if at, err := http.ParseTime(v); err == nil {
+				return capped(max(time.Until(at), 0))
+			}
+		}
+	}
+
+	delay := t.policy.backoff << attempt
+	if t.policy.maxDelay > 0 && (delay > t.policy.maxDelay || delay <= 0) {
+		delay = t.policy.maxDelay
+	}
+
+	if delay > 0 {
+		delay += rand.N(delay / 4)
+	}
+
+	return delay
+}
+
+// Returns true for network errors and for the HTTP status codes that Google recommends retrying.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch response.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// Waits until the request is within the request budget.
+func (l *rateLimiter) wait(request *http.Request) error {
+	if l == nil || l.limit <= 0 {
+		return nil
+	}
+
+	for {
+		l.Lock()
+
+		now := time.Now()
+		requests := l.requests[:0]
+		for _, t := range l.requests {
+			if now.Sub(t) < l.window {
+				requests = append(requests, t)
+			}
+		}
+
+		l.requests = requests
+
+		if len(l.requests) < l.limit {
+			l.requests = append(l.requests, now)
+			l.Unlock()
+
+			return nil
+		}
+
+		delay := l.window - now.Sub(l.requests[0])
+		l.Unlock()
+
+		infof("Google API request budget (%v requests per %v) exhausted - waiting %v", l.limit, l.window, delay.Round(time.Millisecond))
+
+		if err := sleep(request, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Waits for the delay, returning early with an error if the request is cancelled.
+func sleep(request *http.Request, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-request.Context().Done():
+		return request.Context().Err()
+	}
+}
@@ -0,0 +1,243 @@
+package commands
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stand-in server that replies with the listed HTTP status codes (in order) and thereafter with 200 OK,
+// recording the request bodies.
+type flakyServer struct {
+	sync.Mutex
+	statuses   []int
+	retryAfter string
+	bodies     []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+
+	if status != http.StatusOK && s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+
+	w.WriteHeader(status)
+}
+
+func newRetryClient(t *testing.T, s *flakyServer, policy retryPolicy) (*http.Client, string) {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return &http.Client{
+		Transport: &retryTransport{
+			transport: http.DefaultTransport,
+			policy:    policy,
+			limiter:   newRateLimiter(policy.budget),
+		},
+	}, srv.URL
+}
+
+func TestRetryTransport(t *testing.T) {
+	s := flakyServer{
+		statuses: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	}
+
+	client, url := newRetryClient(t, &s, retryPolicy{retries: 3, backoff: 5 * time.Millisecond})
+
+	response, err := client.Post(url, "application/json", strings.NewReader(`{"values":[["6001001"]]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Incorrect status - expected:%v, got:%v", http.StatusOK, response.StatusCode)
+	}
+
+	// ... retried requests should resend the request body
+	expected := []string{`{"values":[["6001001"]]}`, `{"values":[["6001001"]]}`, `{"values":[["6001001"]]}`}
+	if !reflect.DeepEqual(s.bodies, expected) {
+		t.Errorf("Incorrect request bodies\n   expected:%v\n   got:     %v", expected, s.bodies)
+	}
+}
+
+func TestRetryTransportWithRetriesExhausted(t *testing.T) {
+	s := flakyServer{
+		statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable},
+	}
+
+	client, url := newRetryClient(t, &s, retryPolicy{retries: 2, backoff: 5 * time.Millisecond})
+
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Incorrect status - expected:%v, got:%v", http.StatusServiceUnavailable, response.StatusCode)
+	}
+
+	if len(s.bodies) != 3 {
+		t.Errorf("Incorrect number of requests - expected:%v, got:%v", 3, len(s.bodies))
+	}
+}
+
+func TestRetryTransportWithNonRetryableError(t *testing.T) {
+	s := flakyServer{
+		statuses: []int{http.StatusBadRequest},
+	}
+
+	client, url := newRetryClient(t, &s, retryPolicy{retries: 2, backoff: 5 * time.Millisecond})
+
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Incorrect status - expected:%v, got:%v", http.StatusBadRequest, response.StatusCode)
+	}
+
+	if len(s.bodies) != 1 {
+		t.Errorf("Incorrect number of requests - expected:%v, got:%v", 1, len(s.bodies))
+	}
+}
+
+func TestRetryTransportWithRetryAfter(t *testing.T) {
+	s := flakyServer{
+		statuses:   []int{http.StatusTooManyRequests},
+		retryAfter: "1",
+	}
+
+	client, url := newRetryClient(t, &s, retryPolicy{retries: 2, backoff: 5 * time.Millisecond})
+
+	start := time.Now()
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	response.Body.Close()
+
+	if dt := time.Since(start); dt < time.Second {
+		t.Errorf("Retry-After not honoured - expected delay of at least %v, got %v", time.Second, dt)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Incorrect status - expected:%v, got:%v", http.StatusOK, response.StatusCode)
+	}
+}
+
+func TestRetryTransportWithRetryAfterMaxDelay(t *testing.T) {
+	s := flakyServer{
+		statuses:   []int{http.StatusTooManyRequests},
+		retryAfter: "3600",
+	}
+
+	client, url := newRetryClient(t, &s, retryPolicy{retries: 2, backoff: 5 * time.Millisecond, maxDelay: 50 * time.Millisecond})
+
+	start := time.Now()
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	}
+
+	response.Body.Close()
+
+	if dt := time.Since(start); dt > time.Second {
+		t.Errorf("Retry-After not capped at max delay - expected delay of at most %v, got %v", 50*time.Millisecond, dt)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Incorrect status - expected:%v, got:%v", http.StatusOK, response.StatusCode)
+	}
+}
+
+func TestRetryTransportWithBudget(t *testing.T) {
+	s := flakyServer{}
+	client, url := newRetryClient(t, &s, retryPolicy{budget: 2})
+
+	client.Transport.(*retryTransport).limiter.window = 250 * time.Millisecond
+
+	start := time.Now()
+	for range 3 {
+		if response, err := client.Get(url); err != nil {
+			t.Fatalf("Unexpected error (%v)", err)
+		} else {
+			response.Body.Close()
+		}
+	}
+
+	if dt := time.Since(start); dt < 250*time.Millisecond {
+		t.Errorf("Request budget not applied - expected delay of at least %v, got %v", 250*time.Millisecond, dt)
+	}
+}
+
+func TestGoogleAppendWithRateLimit(t *testing.T) {
+	fake, google := newFakeGoogle(t, map[string][][]any{
+		"Log": [][]any{
+			[]any{"Timestamp", "Device ID"},
+		},
+	})
+
+	fake.failures = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+	if err := google.Append("Log!A1:B", [][]any{{"2026-10-16 12:34:56", "405419896"}}, false); err != nil {
+		t.Fatalf("Unexpected error appending rows (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Timestamp", "Device ID"},
+		[]any{"2026-10-16 12:34:56", "405419896"},
+	}
+
+	if rows := fake.values("Log"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+
+	if n := fake.count("values.append"); n != 1 {
+		t.Errorf("Incorrect number of appends - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestLoadACLWithRateLimit(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+	cmd := testLoadACL(fake, sim, t)
+	cmd.apiRetries = 2
+
+	fake.failures = []int{http.StatusTooManyRequests, http.StatusTooManyRequests}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Errorf("Incomplete log %v", rows)
+	}
+
+	if n := fake.count("429"); n != 2 {
+		t.Errorf("Incorrect number of rate-limited requests - expected:%v, got:%v", 2, n)
+	}
+}
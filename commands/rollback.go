@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var RollbackCmd = Rollback{
+	LoadACL: LoadACL{
+		command: command{
+			workdir:     DEFAULT_WORKDIR,
+			credentials: DEFAULT_CREDENTIALS,
+			tokens:      "",
+			url:         "",
+			apiRetries:  5,
+			apiBudget:   60,
+			debug:       false,
+		},
+
+		config: config.DefaultConfig,
+
+		nolog:           false,
+		logRange:        "Log!A1:H",
+		reportRetention: 7,
+		logRetention:    30,
+
+		noreport:    false,
+		reportRange: "Report!A1:E",
+
+		dryrun: false,
+
+		workers: workers{
+			concurrency: 4,
+			timeout:     5 * time.Minute,
+			retries:     2,
+		},
+	},
+
+	snapshot: "",
+	list:     false,
+}
+
+type Rollback struct {
+	LoadACL
+	snapshot string
+	list     bool
+}
+
+func (cmd *Rollback) Name() string {
+	return "rollback"
+}
+
+func (cmd *Rollback) Description() string {
+	return "Restores the cards on a set of configured UHPPOTE access controllers from a load-acl snapshot"
+}
+
+func (cmd *Rollback) Usage() string {
+	return "[--list] [--snapshot <file>] [--url <url> | --file <spreadsheet>]"
+}
+
+func (cmd *Rollback) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] rollback [options] [--snapshot <file>]\n", APP)
+	fmt.Println()
+	fmt.Println("  Restores the cards on a set of configured controllers from one of the ACL snapshots saved by load-acl before updating")
+	fmt.Println("  the controllers (in <workdir>/snapshots). Defaults to the most recent snapshot - use --list to list the available snapshots.")
+	fmt.Println()
+	fmt.Println("  The summary is written to the log and report worksheets if a spreadsheet is specified with --url or --file.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets rollback --list`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets rollback --with-pin`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets rollback --snapshot "acl-20260102-123456.789.json" \`)
+	fmt.Println(`                                --credentials "credentials.json" \`)
+	fmt.Println(`                                --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
+	fmt.Println()
+}
+
+func (cmd *Rollback) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("rollback")
+
+	flagset.StringVar(&cmd.snapshot, "snapshot", cmd.snapshot, "ACL snapshot file to restore (defaults to the most recent snapshot)")
+	flagset.BoolVar(&cmd.list, "list", cmd.list, "Lists the available ACL snapshots")
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.BoolVar(&cmd.withPIN, "with-pin", cmd.withPIN, "Restores card keypad PIN codes")
+	flagset.BoolVar(&cmd.dryrun, "dry-run", cmd.dryrun, "Simulates a rollback without making any changes to the access controllers")
+
+	cmd.workers.flags(flagset)
+
+	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing a summary to the 'log' worksheet")
+	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
+	flagset.IntVar(&cmd.logRetention, "log-retention", cmd.logRetention, "Log sheet records older than 'log-retention' days are automatically pruned")
+
+	flagset.BoolVar(&cmd.noreport, "no-report", cmd.noreport, "Disables writing a report to the 'report' worksheet")
+	flagset.StringVar(&cmd.reportRange, "report-range", cmd.reportRange, "Spreadsheet range for rollback report")
+	flagset.IntVar(&cmd.reportRetention, "report-retention", cmd.reportRetention, "Report sheet records older than 'report-retention' days are automatically pruned")
+
+	return flagset
+}
+
+func (cmd *Rollback) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	if cmd.list {
+		return cmd.listSnapshots()
+	}
+
+	// ... check parameters
+	spreadsheet := strings.TrimSpace(cmd.url) != "" || strings.TrimSpace(cmd.workbook) != ""
+	if spreadsheet {
+		if err := cmd.validateSpreadsheet(); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.workers.validate(); err != nil {
+		return err
+	}
+
+	file, err := cmd.snapshotFile()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := loadSnapshot(file)
+	if err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	// ... locked?
+	if locks, err := cmd.lockControllers(devices, LOCK_MAX_AGE); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	ctx := options.context()
+
+	var backend Backend
+	if spreadsheet {
+		if backend, err = cmd.backend(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.rollback(ctx, u, devices, backend, file, snapshot); err != nil {
+		if ctx.Err() != nil && spreadsheet {
+			cmd.logCancelled(ctx)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (cmd *Rollback) rollback(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, backend Backend, file string, s *snapshot) error {
+	infof("Restoring ACL snapshot %v (%v)", file, s.Timestamp.Local().Format("2006-01-02 15:04:05 MST"))
+
+	// ... only restore configured controllers
+	acl := lib.ACL{}
+	for id, cards := range s.acl() {
+		if slices.ContainsFunc(devices, func(d uhppote.Device) bool { return d.DeviceID == id }) {
+			acl[id] = cards
+		} else {
+			warnf("%v  not a configured controller - ignoring snapshot ACL", id)
+		}
+	}
+
+	for _, d := range devices {
+		if _, ok := acl[d.DeviceID]; !ok {
+			warnf("%v  not in snapshot - not restored", d.DeviceID)
+		}
+	}
+
+	if len(acl) == 0 {
+		return fmt.Errorf("no configured controllers in ACL snapshot %v", file)
+	}
+
+	if failed, err := cmd.put(ctx, u, backend, acl, nil, nil); err != nil {
+		return err
+	} else if len(failed) > 0 {
+		return fmt.Errorf("ACL snapshot %v not restored to %v controller(s)", file, len(failed))
+	}
+
+	infof("Restored ACL snapshot %v", file)
+
+	return nil
+}
+
+// Returns the --snapshot file (resolved against the snapshots directory if it is not a path) or the
+// most recent snapshot if --snapshot is not specified.
+func (cmd *Rollback) snapshotFile() (string, error) {
+	if file := strings.TrimSpace(cmd.snapshot); file != "" {
+		if filepath.Base(file) == file {
+			return filepath.Join(cmd.snapshotDir(), file), nil
+		}
+
+		return file, nil
+	}
+
+	snapshots, err := listSnapshots(cmd.snapshotDir())
+	if err != nil {
+		return "", err
+	} else if len(snapshots) == 0 {
+		return "", fmt.Errorf("no ACL snapshots in %v", cmd.snapshotDir())
+	}
+
+	return snapshots[len(snapshots)-1], nil
+}
+
+func (cmd *Rollback) listSnapshots() error {
+	snapshots, err := listSnapshots(cmd.snapshotDir())
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Printf("No ACL snapshots in %v\n", cmd.snapshotDir())
+		return nil
+	}
+
+	for _, file := range snapshots {
+		if s, err := loadSnapshot(file); err != nil {
+			fmt.Printf("  %-32v  %v\n", filepath.Base(file), err)
+		} else {
+			cards := 0
+			for _, list := range s.Controllers {
+				cards += len(list)
+			}
+
+			fmt.Printf("  %-32v  %v  controllers:%v  cards:%v\n", filepath.Base(file), s.Timestamp.Local().Format("2006-01-02 15:04:05"), len(s.Controllers), cards)
+		}
+	}
+
+	return nil
+}
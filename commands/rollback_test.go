@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func TestLoadACLWithSnapshot(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.snapshots = 10
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	snapshots, err := listSnapshots(filepath.Join(cmd.workdir, "snapshots"))
+	if err != nil {
+		t.Fatalf("Unexpected error listing snapshots (%v)", err)
+	} else if len(snapshots) != 1 {
+		t.Fatalf("Incorrect number of snapshots - expected:%v, got:%v", 1, len(snapshots))
+	}
+
+	s, err := loadSnapshot(snapshots[0])
+	if err != nil {
+		t.Fatalf("Unexpected error loading snapshot (%v)", err)
+	}
+
+	controllers := testControllers()
+	for _, id := range []uint32{405419896, 303986753} {
+		expected := []types.Card{}
+		for _, card := range controllers[id].cards {
+			expected = append(expected, *card)
+		}
+
+		if cards := s.Controllers[id]; !reflect.DeepEqual(cards, expected) {
+			t.Errorf("%v: incorrect snapshot\n   expected:%v\n   got:     %v", id, expected, cards)
+		}
+	}
+}
+
+func TestLoadACLSnapshotRetention(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.snapshots = 2
+	config := sim.config(t)
+
+	for range 4 {
+		if err := cmd.Execute(&Options{Config: config}); err != nil {
+			t.Fatalf("Unexpected error executing load-acl (%v)", err)
+		}
+	}
+
+	if snapshots, err := listSnapshots(filepath.Join(cmd.workdir, "snapshots")); err != nil {
+		t.Fatalf("Unexpected error listing snapshots (%v)", err)
+	} else if len(snapshots) != 2 {
+		t.Errorf("Incorrect number of snapshots - expected:%v, got:%v", 2, len(snapshots))
+	}
+}
+
+func TestLoadACLWithDryRunAndSnapshot(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testLoadACL(fake, sim, t)
+	cmd.snapshots = 10
+	cmd.dryrun = true
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	if snapshots, err := listSnapshots(filepath.Join(cmd.workdir, "snapshots")); err != nil {
+		t.Fatalf("Unexpected error listing snapshots (%v)", err)
+	} else if len(snapshots) != 0 {
+		t.Errorf("Unexpected snapshots for --dry-run %v", snapshots)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	controllers := testControllers()
+	controllers[405419896].cards[0].PIN = 1357
+	sim := newSimulator(controllers)
+	config := sim.config(t)
+
+	load := testLoadACL(fake, sim, t)
+	load.snapshots = 10
+	load.withPIN = true
+
+	if err := load.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	rollback := Rollback{
+		LoadACL: LoadACL{
+			command:         load.command,
+			logRange:        "Log!A1:H",
+			logRetention:    30,
+			reportRange:     "Report!A1:E",
+			reportRetention: 7,
+			withPIN:         true,
+		},
+	}
+
+	if err := rollback.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing rollback (%v)", err)
+	}
+
+	original := testControllers()
+	original[405419896].cards[0].PIN = 1357
+
+	checkCards(t, sim, 405419896, original[405419896].cards...)
+	checkCards(t, sim, 303986753, original[303986753].cards...)
+
+	expected := [][]any{
+		[]any{"303986753", "0", "1", "2", "0", "0", "0"},
+		[]any{"405419896", "0", "2", "1", "1", "0", "0"},
+		[]any{"303986753", "0", "1", "0", "2", "0", "0"},
+		[]any{"405419896", "0", "2", "1", "1", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestRollbackWithoutSpreadsheet(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	load := testLoadACL(fake, sim, t)
+	load.snapshots = 10
+
+	if err := load.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	snapshots, _ := listSnapshots(filepath.Join(load.workdir, "snapshots"))
+	if len(snapshots) != 1 {
+		t.Fatalf("Incorrect number of snapshots - expected:%v, got:%v", 1, len(snapshots))
+	}
+
+	rollback := Rollback{
+		LoadACL: LoadACL{
+			command: command{
+				workdir:  load.workdir,
+				iuhppote: sim,
+			},
+		},
+		snapshot: filepath.Base(snapshots[0]),
+	}
+
+	if err := rollback.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing rollback (%v)", err)
+	}
+
+	original := testControllers()
+
+	checkCards(t, sim, 405419896, original[405419896].cards...)
+	checkCards(t, sim, 303986753, original[303986753].cards...)
+
+	if rows := logRows(fake); len(rows) != 2 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 2, len(rows))
+	}
+}
+
+func TestRollbackWithoutSnapshots(t *testing.T) {
+	sim := newSimulator(testControllers())
+
+	rollback := Rollback{
+		LoadACL: LoadACL{
+			command: command{
+				workdir:  t.TempDir(),
+				iuhppote: sim,
+			},
+		},
+	}
+
+	if err := rollback.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Errorf("Expected error executing rollback without any snapshots")
+	}
+}
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	syslog "log"
+	"path/filepath"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var RunCmd = Run{
+	LoadACL: LoadACL{
+		command: command{
+			workdir:     DEFAULT_WORKDIR,
+			credentials: DEFAULT_CREDENTIALS,
+			tokens:      "",
+			url:         "",
+			apiRetries:  5,
+			apiBudget:   60,
+			debug:       false,
+		},
+
+		config: config.DefaultConfig,
+		area:   "",
+
+		nolog:           false,
+		logRange:        "Log!A1:H",
+		reportRetention: 7,
+		logRetention:    30,
+
+		noreport:    false,
+		reportRange: "Report!A1:E",
+
+		strict:     false,
+		dryrun:     false,
+		delay:      15 * time.Minute,
+		snapshots:  10,
+		lockMaxAge: 2 * time.Hour,
+
+		changeDetection: "revision",
+		revisions:       filepath.Join(DEFAULT_WORKDIR, ".google", "uhppoted-app-sheets.revision"),
+
+		workers: workers{
+			concurrency: 4,
+			timeout:     5 * time.Minute,
+			retries:     2,
+		},
+	},
+
+	interval:   5 * time.Minute,
+	foreground: false,
+}
+
+type Run struct {
+	LoadACL
+	interval   time.Duration
+	foreground bool
+}
+
+func (cmd *Run) Name() string {
+	return "run"
+}
+
+func (cmd *Run) Description() string {
+	return "Runs as a long-lived service that updates a set of configured UHPPOTE access controllers whenever a Google Sheets worksheet is revised"
+}
+
+func (cmd *Run) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *Run) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] run [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Runs as a long-lived service that polls the spreadsheet revision at the configured interval and updates the cards on the")
+	fmt.Println("  configured controllers (as for load-acl) once a revised spreadsheet has been stable for the --delay interval. A spreadsheet")
+	fmt.Println("  file is reopened for every check but the Google Sheets connection (and API request budget), the controller interface and the")
+	fmt.Println("  load-acl lockfile are retained for as long as the service is running.")
+	fmt.Println()
+	fmt.Println("  The service exits cleanly on SIGINT or SIGTERM. The --foreground option omits the date and time from the log messages")
+	fmt.Println("  for use as a systemd 'simple' service (the journal timestamps the log messages).")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets run --credentials "credentials.json" \`)
+	fmt.Println(`                           --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                           --range "ACL!A2:E" \`)
+	fmt.Println(`                           --interval 1m`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets run --file "site.xlsx" --range "ACL!A2:E" --foreground`)
+	fmt.Println()
+}
+
+func (cmd *Run) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("run")
+
+	cmd.flags(flagset)
+
+	flagset.DurationVar(&cmd.interval, "interval", cmd.interval, "Interval between checks for a revised spreadsheet")
+	flagset.BoolVar(&cmd.foreground, "foreground", cmd.foreground, "Runs as a systemd foreground service, without timestamps in the log messages")
+
+	return flagset
+}
+
+func (cmd *Run) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	if cmd.interval <= 0 {
+		return fmt.Errorf("invalid --interval (%v)", cmd.interval)
+	}
+
+	if cmd.foreground {
+		syslog.SetFlags(0)
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	ctx := options.context()
+
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	// ... locked?
+	lock, err := cmd.lock(backend, cmd.area, cmd.lockMaxAge)
+	if err != nil {
+		return err
+	}
+
+	defer lock.release()
+
+	cmd.run(ctx, u, devices, backend)
+
+	return nil
+}
+
+// Runs the load-acl pipeline immediately and then at every --interval until the context is cancelled
+// (on SIGINT/SIGTERM or when the --timeout expires). Errors are logged rather than returned so that a
+// transient failure (e.g. the network being down) does not terminate the service.
+//
+// The Google Sheets backend (and with it the OAuth client and the Google API request budget) is retained for
+// the lifetime of the service but a spreadsheet file is reopened for every check (see reopen). Only the
+// lockfile (refreshed in the background) and the backend are held between checks.
+func (cmd *Run) run(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, backend Backend) {
+	infof("Checking for a revised spreadsheet every %v", cmd.interval)
+
+	tick := time.NewTicker(cmd.interval)
+	defer tick.Stop()
+
+	for {
+		if b, err := reopen(backend); err != nil {
+			errorf("%v", err)
+		} else if err := cmd.load(ctx, u, devices, b); err != nil {
+			if ctx.Err() != nil {
+				cmd.logCancelled(ctx)
+			} else {
+				errorf("%v", err)
+			}
+		}
+
+		select {
+		case <-tick.C:
+
+		case <-ctx.Done():
+			infof("%v - exiting", context.Cause(ctx))
+			return
+		}
+	}
+}
+
+// Prepares the backend for the next check. A spreadsheet file is reloaded from disk (rather than loading, and
+// then overwriting, a stale in-memory copy) and the cached Google Sheets metadata is discarded so that added or
+// renamed worksheets are picked up.
+func reopen(backend Backend) (Backend, error) {
+	switch b := backend.(type) {
+	case *workbook:
+		return newWorkbook(b.file)
+
+	case *googleSheets:
+		b.spreadsheet = nil
+		return b, nil
+
+	default:
+		return backend, nil
+	}
+}
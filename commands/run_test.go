@@ -0,0 +1,293 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-lib/config"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+func testRun(fake *fakeGoogle, sim *simulator, t *testing.T) *Run {
+	cmd := Run{
+		LoadACL:  *testLoadACL(fake, sim, t),
+		interval: 10 * time.Millisecond,
+	}
+
+	cmd.force = false
+
+	return &cmd
+}
+
+// Starts the run loop in the background, returning the cancel function and a channel that is
+// closed when the run loop exits.
+func startRun(t *testing.T, cmd *Run, sim *simulator) (context.CancelFunc, chan struct{}) {
+	conf := config.NewConfig()
+	if err := conf.Load(sim.config(t)); err != nil {
+		t.Fatalf("Error loading configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		t.Fatalf("Error opening spreadsheet (%v)", err)
+	}
+
+	go func() {
+		cmd.run(ctx, u, devices, backend)
+		close(done)
+	}()
+
+	return cancel, done
+}
+
+// Waits up to a second for a condition to become true.
+func eventually(f func() bool) bool {
+	for range 100 {
+		if f() {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestRun(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	fake.revisions = []*drive.Revision{
+		{Id: "101", ModifiedTime: time.Now().Add(-time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")},
+	}
+
+	sim := newSimulator(testControllers())
+	cmd := testRun(fake, sim, t)
+	cancel, done := startRun(t, cmd, sim)
+
+	if !eventually(func() bool { card, _ := sim.GetCardByID(405419896, 6001004); return card != nil }) {
+		t.Fatalf("ACL not loaded on startup")
+	}
+
+	// ... 'out of band' change to controller, with a spreadsheet revision still inside the --delay window
+	sim.DeleteCard(405419896, 6001004)
+
+	fake.Lock()
+	fake.revisions = append(fake.revisions, &drive.Revision{Id: "102", ModifiedTime: time.Now().UTC().Format("2006-01-02T15:04:05.000Z")})
+	fake.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if card, _ := sim.GetCardByID(405419896, 6001004); card != nil {
+		t.Fatalf("ACL loaded before revision was stable for --delay")
+	}
+
+	// ... revision now stable
+	fake.Lock()
+	fake.revisions[1].ModifiedTime = time.Now().Add(-time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")
+	fake.Unlock()
+
+	if !eventually(func() bool { card, _ := sim.GetCardByID(405419896, 6001004); return card != nil }) {
+		t.Errorf("ACL not reloaded for revised spreadsheet")
+	}
+
+	// ... ignore any CANCELLED/ERROR entries for a load in progress when the run loop was cancelled
+	loads := func() int {
+		count := 0
+		for _, row := range logRows(fake) {
+			if len(row) > 2 {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	// ... wait for the reload to be logged before cancelling
+	eventually(func() bool { return loads() >= 4 })
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("run loop did not exit on cancel")
+	}
+
+	if n := loads(); n != 4 {
+		t.Errorf("Incorrect number of log entries - expected:%v, got:%v", 4, n)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "site.xlsx")
+	writeACLWorkbook(t, file, testACL())
+
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := fake.command(t, sim)
+
+	backend, err := cmd.backend(context.Background())
+	if err != nil {
+		t.Fatalf("Error opening spreadsheet (%v)", err)
+	}
+
+	google := backend.(*googleSheets)
+	google.spreadsheet = &sheets.Spreadsheet{}
+
+	// ... the Google Sheets backend is retained but the cached spreadsheet metadata is discarded
+	if b, err := reopen(google); err != nil {
+		t.Fatalf("Error reopening spreadsheet (%v)", err)
+	} else if b != google {
+		t.Errorf("Google Sheets backend not retained")
+	} else if google.spreadsheet != nil {
+		t.Errorf("Cached spreadsheet metadata not discarded")
+	}
+
+	// ... the spreadsheet file is reloaded
+	w, err := newWorkbook(file)
+	if err != nil {
+		t.Fatalf("Error opening spreadsheet file (%v)", err)
+	}
+
+	writeACLWorkbook(t, file, append(testACL(), []any{"6001005", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"}))
+
+	if b, err := reopen(w); err != nil {
+		t.Fatalf("Error reopening spreadsheet file (%v)", err)
+	} else if rows, err := b.Read("ACL!A1:H"); err != nil {
+		t.Fatalf("Error reading ACL (%v)", err)
+	} else if len(rows) != 5 {
+		t.Errorf("Spreadsheet file not reloaded - got %v", rows)
+	}
+}
+
+// Writes an XLSX spreadsheet file with an ACL worksheet and an empty Log worksheet. The file is replaced
+// atomically so that a concurrent load never sees a partially written file.
+func writeACLWorkbook(t *testing.T, file string, acl [][]any) {
+	sheet := func(rows [][]any) string {
+		var b strings.Builder
+
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+		b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for i, row := range rows {
+			fmt.Fprintf(&b, `<row r="%v">`, i+1)
+			for j, v := range row {
+				fmt.Fprintf(&b, `<c r="%v%v" t="inlineStr"><is><t>%v</t></is></c>`, columnName(j), i+1, v)
+			}
+			b.WriteString(`</row>`)
+		}
+		b.WriteString(`</sheetData></worksheet>`)
+
+		return b.String()
+	}
+
+	header := []any{"Card Number", "PIN", "From", "To", "Front Door", "Side Door", "Great Hall", "Kitchen"}
+	log := []any{"Timestamp", "Device ID", "Unchanged", "Updated", "Added", "Deleted", "Failed", "Errors"}
+	tmp := file + ".tmp"
+
+	makeSpreadsheet(t, tmp, [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStylesXML},
+		{"xl/sharedStrings.xml", xlsxSharedStringsXML},
+		{"xl/worksheets/sheet1.xml", sheet(append([][]any{header}, acl...))},
+		{"xl/worksheets/sheet2.xml", sheet([][]any{log})},
+	})
+
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatalf("Error replacing spreadsheet file (%v)", err)
+	}
+}
+
+func TestRunWithFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "site.xlsx")
+	writeACLWorkbook(t, file, testACL())
+
+	sim := newSimulator(testControllers())
+	cmd := Run{
+		LoadACL: LoadACL{
+			command: command{
+				workdir:  t.TempDir(),
+				workbook: file,
+				iuhppote: sim,
+			},
+			area:            "ACL!A1:H",
+			logRange:        "Log!A1:H",
+			logRetention:    30,
+			noreport:        true,
+			changeDetection: "revision",
+		},
+		interval: 10 * time.Millisecond,
+	}
+
+	cancel, done := startRun(t, &cmd, sim)
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if !eventually(func() bool { card, _ := sim.GetCardByID(405419896, 6001004); return card != nil }) {
+		t.Fatalf("ACL not loaded on startup")
+	}
+
+	// ... wait for the Log worksheet update (which revises the file) to be loaded
+	stable := func() bool {
+		before, _ := os.ReadFile(file)
+		time.Sleep(50 * time.Millisecond)
+		after, _ := os.ReadFile(file)
+
+		return slices.Equal(before, after)
+	}
+
+	if !eventually(stable) {
+		t.Fatalf("spreadsheet file not stable")
+	}
+
+	// ... edit spreadsheet file between checks
+	writeACLWorkbook(t, file, append(testACL(), []any{"6001005", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"}))
+
+	if !eventually(func() bool { card, _ := sim.GetCardByID(405419896, 6001005); return card != nil }) {
+		t.Fatalf("edited spreadsheet file not loaded")
+	}
+
+	if !eventually(stable) {
+		t.Fatalf("spreadsheet file not stable")
+	}
+
+	// ... and the edit should not have been overwritten by the Log worksheet update
+	w, err := newWorkbook(file)
+	if err != nil {
+		t.Fatalf("Error reading spreadsheet file (%v)", err)
+	}
+
+	if rows, err := w.Read("ACL!A1:H"); err != nil {
+		t.Fatalf("Error reading ACL (%v)", err)
+	} else if len(rows) != 5 || rows[4][0] != "6001005" {
+		t.Errorf("Edited ACL overwritten - got %v", rows)
+	}
+
+	if rows, _ := w.Read("Log!A1:H"); len(rows) < 3 {
+		t.Errorf("Missing Log worksheet entries - got %v", rows)
+	}
+}
+
+func TestRunWithInvalidInterval(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets(testACL()...))
+	sim := newSimulator(testControllers())
+	cmd := testRun(fake, sim, t)
+	cmd.interval = 0
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Errorf("Expected error executing 'run' with invalid --interval")
+	}
+}
@@ -0,0 +1,573 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var SetHolidaysCmd = SetHolidays{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config:       config.DefaultConfig,
+	area:         "Holidays!A1:D",
+	force:        false,
+	replaceTasks: false,
+	dryrun:       false,
+	nolog:        false,
+	logRange:     "Log!A1:H",
+	logRetention: 30,
+}
+
+type SetHolidays struct {
+	command
+	config       string
+	area         string
+	force        bool
+	replaceTasks bool
+	dryrun       bool
+	nolog        bool
+	logRange     string
+	logRetention int
+}
+
+// The holidays programmed on a controller, keyed by date. Stored after each successful update because
+// the controller task list cannot be read back from the controller.
+type holidays map[uint32]map[string]holiday
+
+type holiday struct {
+	Description string `json:"description"`
+	Doors       []int  `json:"doors"`
+}
+
+func (cmd *SetHolidays) Name() string {
+	return "set-holidays"
+}
+
+func (cmd *SetHolidays) Description() string {
+	return "Programs the public holidays from a Google Sheets worksheet on a set of configured UHPPOTE access controllers"
+}
+
+func (cmd *SetHolidays) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *SetHolidays) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] set-holidays [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Programs the holidays from a Google Sheets worksheet on a set of configured controllers. The worksheet is expected")
+	fmt.Println("  to have the columns 'Date' and 'Description' and optionally 'Controller' and 'Door' to restrict a holiday to a")
+	fmt.Println("  controller and/or a comma separated list of doors, e.g.")
+	fmt.Println()
+	fmt.Println("    Date        Description     Controller  Door")
+	fmt.Println("    2026-12-25  Christmas Day")
+	fmt.Println("    2026-12-26  Boxing Day      405419896   Front Door, Side Door")
+	fmt.Println()
+	fmt.Println("  Time profiles are disabled for the door from 00:00 on the holiday and re-enabled at 00:00 on the following day.")
+	fmt.Println("  Holidays before today are ignored.")
+	fmt.Println()
+	fmt.Println("  The holiday tasks are added to the existing task list on a controller, leaving any other tasks unchanged. The task list")
+	fmt.Println("  cannot be read back from a controller, so a change that removes a holiday task (e.g. a deleted holiday) is only applied")
+	fmt.Println("  with --replace-tasks, which replaces the whole task list on the controller with the holiday tasks.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets set-holidays --credentials "credentials.json" \`)
+	fmt.Println(`                                    --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                    --range "Holidays!A1:D"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets set-holidays --file "site.xlsx" --dry-run`)
+	fmt.Println()
+}
+
+func (cmd *SetHolidays) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("set-holidays")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range of the holidays e.g. 'Holidays!A1:D'")
+	flagset.BoolVar(&cmd.force, "force", cmd.force, "Reprograms the holidays on the controllers even if they have not changed (requires --replace-tasks)")
+	flagset.BoolVar(&cmd.replaceTasks, "replace-tasks", cmd.replaceTasks, "Replaces the controller task list with the holiday tasks, deleting any other tasks on the controller")
+	flagset.BoolVar(&cmd.dryrun, "dry-run", cmd.dryrun, "Reports the holiday changes without updating the access controllers")
+
+	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing a summary to the 'log' worksheet")
+	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
+	flagset.IntVar(&cmd.logRetention, "log-retention", cmd.logRetention, "Log sheet records older than 'log-retention' days are automatically pruned")
+
+	return flagset
+}
+
+func (cmd *SetHolidays) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	// ... locked?
+	if locks, err := cmd.lockControllers(devices, LOCK_MAX_AGE); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s  log:%s", backend.ID(), cmd.area, cmd.logRange)
+	}
+
+	values, err := backend.Read(cmd.area)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve holidays from sheet (%v)", err)
+	}
+
+	today := types.Date(time.Now())
+	list, err := parseHolidays(values, devices, today)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(cmd.workdir, ".google", fmt.Sprintf("%s.holidays", backend.ID()))
+	programmed := holidays{}
+	if err := programmed.load(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading programmed holidays from %s (%v)", file, err)
+	}
+
+	type result struct {
+		rpt     lib.Report
+		updated bool
+	}
+
+	results, _ := forEach(ctx, devices, func(d uhppote.Device) (result, error) {
+		rpt, updated := cmd.update(u, d.DeviceID, programmed[d.DeviceID], list[d.DeviceID])
+
+		return result{rpt, updated}, nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, cmd.nolog, cmd.logRange)
+	}
+
+	rpt := map[uint32]lib.Report{}
+	for _, d := range devices {
+		if results[d.DeviceID].updated {
+			programmed[d.DeviceID] = list[d.DeviceID]
+		}
+
+		rpt[d.DeviceID] = results[d.DeviceID].rpt
+	}
+
+	if !cmd.dryrun {
+		if err := programmed.store(file); err != nil {
+			return fmt.Errorf("error storing programmed holidays to %s (%v)", file, err)
+		}
+	}
+
+	summary := lib.Summarize(rpt)
+	format := "%v  unchanged:%v  updated:%v  added:%v  deleted:%v  failed:%v  errors:%v"
+	for _, v := range summary {
+		infof(format, v.DeviceID, v.Unchanged, v.Updated, v.Added, v.Deleted, v.Failed, v.Errored)
+	}
+
+	if !cmd.nolog {
+		if err := writeLog(backend, cmd.logRange, rpt); err != nil {
+			return err
+		}
+
+		if err := pruneSheet(backend, cmd.logRange, cmd.logRetention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *SetHolidays) validate() error {
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(cmd.area)); len(match) < 2 {
+		return fmt.Errorf("invalid range '%s' - expected something like 'Holidays!A1:D", cmd.area)
+	}
+
+	if cmd.force && !cmd.replaceTasks {
+		return fmt.Errorf("--force requires --replace-tasks (the existing holiday tasks cannot be read back from the controllers)")
+	}
+
+	if !cmd.nolog {
+		if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+[0-9]+):([a-zA-Z]+(?:[0-9]+)?)`).FindStringSubmatch(cmd.logRange); len(match) < 4 {
+			return fmt.Errorf("invalid log-range '%s' - expected something like 'Log!A1:H", cmd.logRange)
+		}
+	}
+
+	return nil
+}
+
+// Compares the holidays last programmed on a controller with the worksheet holidays and, if they have
+// changed, adds the new holiday tasks to the controller task list. A change that would remove a holiday
+// task is only applied with --replace-tasks, which replaces the controller task list with the holiday
+// tasks. The report lists the holiday dates as YYYYMMDD and the returned flag is false if the controller
+// was not updated.
+func (cmd *SetHolidays) update(u uhppote.IUHPPOTE, deviceID uint32, previous, current map[string]holiday) (lib.Report, bool) {
+	rpt := lib.Report{
+		Unchanged: []uint32{},
+		Updated:   []uint32{},
+		Added:     []uint32{},
+		Deleted:   []uint32{},
+		Failed:    []uint32{},
+		Errored:   []uint32{},
+		Errors:    []error{},
+	}
+
+	key := func(date string) uint32 {
+		v, _ := strconv.ParseUint(strings.ReplaceAll(date, "-", ""), 10, 32)
+		return uint32(v)
+	}
+
+	for date, h := range current {
+		if p, ok := previous[date]; !ok {
+			infof("%v  add holiday    %v %v (doors %v)", deviceID, date, h.Description, h.Doors)
+			rpt.Added = append(rpt.Added, key(date))
+		} else if !slices.Equal(p.Doors, h.Doors) {
+			infof("%v  update holiday %v %v (doors %v, was %v)", deviceID, date, h.Description, h.Doors, p.Doors)
+			rpt.Updated = append(rpt.Updated, key(date))
+		} else {
+			rpt.Unchanged = append(rpt.Unchanged, key(date))
+		}
+	}
+
+	for date, h := range previous {
+		if _, ok := current[date]; !ok {
+			infof("%v  delete holiday %v %v", deviceID, date, h.Description)
+			rpt.Deleted = append(rpt.Deleted, key(date))
+		}
+	}
+
+	changed := len(rpt.Added)+len(rpt.Updated)+len(rpt.Deleted) > 0
+	if cmd.dryrun || (!changed && !cmd.force) {
+		return rpt, false
+	}
+
+	failed := func(err error) (lib.Report, bool) {
+		keys := slices.Concat(rpt.Unchanged, rpt.Updated, rpt.Added)
+		rpt.Unchanged = []uint32{}
+		rpt.Updated = []uint32{}
+		rpt.Added = []uint32{}
+		rpt.Deleted = []uint32{}
+
+		if err != nil {
+			errorf("%v  %v", deviceID, err)
+			rpt.Errored = keys
+			rpt.Errors = append(rpt.Errors, err)
+		} else {
+			warnf("%v  holiday tasks not set", deviceID)
+			rpt.Failed = keys
+		}
+
+		return rpt, false
+	}
+
+	tasks := holidayTasks(current)
+
+	if cmd.replaceTasks {
+		if ok, err := u.ClearTaskList(deviceID); err != nil || !ok {
+			return failed(err)
+		}
+	} else {
+		added, removed := diffTasks(holidayTasks(previous), tasks)
+		if len(removed) > 0 {
+			warnf("%v  holiday changes remove %v existing task(s) - use --replace-tasks to replace the task list", deviceID, len(removed))
+			return failed(nil)
+		}
+
+		tasks = added
+	}
+
+	for _, task := range tasks {
+		if ok, err := u.AddTask(deviceID, task); err != nil || !ok {
+			return failed(err)
+		}
+	}
+
+	if ok, err := u.RefreshTaskList(deviceID); err != nil || !ok {
+		return failed(err)
+	}
+
+	return rpt, true
+}
+
+// Converts the holidays to controller tasks. Consecutive holidays for a door are merged into a single
+// 'disable time profile' task on the first day and an 'enable time profile' task on the day after the
+// last day.
+func holidayTasks(list map[string]holiday) []types.Task {
+	weekdays := types.Weekdays{
+		time.Monday:    true,
+		time.Tuesday:   true,
+		time.Wednesday: true,
+		time.Thursday:  true,
+		time.Friday:    true,
+		time.Saturday:  true,
+		time.Sunday:    true,
+	}
+
+	task := func(t types.TaskType, door int, date time.Time) types.Task {
+		return types.Task{
+			Task:     t,
+			Door:     uint8(door),
+			From:     types.Date(date),
+			To:       types.Date(date),
+			Weekdays: weekdays,
+			Start:    types.NewHHmm(0, 0),
+		}
+	}
+
+	doors := map[int][]time.Time{}
+	for date, h := range list {
+		if d, err := time.ParseInLocation("2006-01-02", date, time.Local); err == nil {
+			for _, door := range h.Doors {
+				doors[door] = append(doors[door], d)
+			}
+		}
+	}
+
+	tasks := []types.Task{}
+	for door := 1; door <= 4; door++ {
+		dates := doors[door]
+		slices.SortFunc(dates, func(p, q time.Time) int { return p.Compare(q) })
+
+		for i := 0; i < len(dates); {
+			start := dates[i]
+			end := start
+			for i++; i < len(dates) && dates[i].Equal(end.AddDate(0, 0, 1)); i++ {
+				end = dates[i]
+			}
+
+			tasks = append(tasks, task(types.DisableTimeProfile, door, start))
+			tasks = append(tasks, task(types.EnableTimeProfile, door, end.AddDate(0, 0, 1)))
+		}
+	}
+
+	return tasks
+}
+
+// Compares the holiday tasks last programmed on a controller with the tasks for the current holidays,
+// returning the tasks to be added and the existing tasks that are no longer required.
+func diffTasks(previous, current []types.Task) ([]types.Task, []types.Task) {
+	key := func(t types.Task) string {
+		return fmt.Sprintf("%v:%v:%v", t.Task, t.Door, t.From)
+	}
+
+	existing := map[string]int{}
+	for _, t := range previous {
+		existing[key(t)]++
+	}
+
+	added := []types.Task{}
+	for _, t := range current {
+		if k := key(t); existing[k] > 0 {
+			existing[k]--
+		} else {
+			added = append(added, t)
+		}
+	}
+
+	removed := []types.Task{}
+	for _, t := range previous {
+		if k := key(t); existing[k] > 0 {
+			existing[k]--
+			removed = append(removed, t)
+		}
+	}
+
+	return added, removed
+}
+
+// Parses and validates the holidays worksheet, returning the holidays for each controller. Rows without
+// a date and holidays before 'today' are ignored.
+func parseHolidays(values [][]any, devices []uhppote.Device, today types.Date) (holidays, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no data in holidays spreadsheet/range")
+	}
+
+	index, _ := buildIndex(values[:1], []string{"date", "description", "controller", "door"})
+	if _, ok := index["date"]; !ok {
+		return nil, fmt.Errorf("missing 'Date' column in holidays worksheet")
+	}
+
+	get := func(record []any, field string) string {
+		if ix, ok := index[field]; ok {
+			return clean(value(record, ix))
+		}
+
+		return ""
+	}
+
+	list := holidays{}
+	for _, d := range devices {
+		list[d.DeviceID] = map[string]holiday{}
+	}
+
+	for i, record := range values[1:] {
+		row := i + 2
+		if get(record, "date") == "" {
+			continue
+		}
+
+		date, err := types.ParseDate(get(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("holidays row %v: invalid date '%v'", row, get(record, "date"))
+		} else if date.Before(today) {
+			continue
+		}
+
+		scope, err := holidayScope(get(record, "controller"), get(record, "door"), devices)
+		if err != nil {
+			return nil, fmt.Errorf("holidays row %v: %v", row, err)
+		}
+
+		for id, doors := range scope {
+			h := list[id][date.String()]
+			h.Description = get(record, "description")
+			for _, door := range doors {
+				if !slices.Contains(h.Doors, door) {
+					h.Doors = append(h.Doors, door)
+				}
+			}
+
+			slices.Sort(h.Doors)
+			list[id][date.String()] = h
+		}
+	}
+
+	return list, nil
+}
+
+// Resolves the controller and doors for a holiday. A blank controller applies to all controllers and a
+// blank door applies to all doors. Controllers may be specified by ID or name and doors by the door name
+// from the configuration or by door number.
+func holidayScope(controller, doors string, devices []uhppote.Device) (map[uint32][]int, error) {
+	selected := []uhppote.Device{}
+	if controller == "" {
+		selected = devices
+	} else {
+		for _, d := range devices {
+			if controller == fmt.Sprintf("%v", d.DeviceID) || (d.Name != "" && normalise(controller) == normalise(d.Name)) {
+				selected = append(selected, d)
+			}
+		}
+
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("unknown controller '%v'", controller)
+		}
+	}
+
+	scope := map[uint32][]int{}
+	if doors == "" {
+		for _, d := range selected {
+			scope[d.DeviceID] = []int{1, 2, 3, 4}
+		}
+
+		return scope, nil
+	}
+
+	for door := range strings.SplitSeq(doors, ",") {
+		door = clean(door)
+		if door == "" {
+			continue
+		}
+
+		if v, err := strconv.Atoi(door); err == nil {
+			if v < 1 || v > 4 {
+				return nil, fmt.Errorf("invalid door '%v'", door)
+			}
+
+			for _, d := range selected {
+				scope[d.DeviceID] = append(scope[d.DeviceID], v)
+			}
+
+			continue
+		}
+
+		found := false
+		for _, d := range selected {
+			for i, name := range d.Doors {
+				if name != "" && normalise(name) == normalise(door) {
+					scope[d.DeviceID] = append(scope[d.DeviceID], i+1)
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown door '%v'", door)
+		}
+	}
+
+	return scope, nil
+}
+
+func (h *holidays) load(file string) error {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, h)
+}
+
+func (h holidays) store(file string) error {
+	dir := filepath.Dir(file)
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+
+	if bytes, err := json.MarshalIndent(h, "", "  "); err != nil {
+		return err
+	} else if err := os.WriteFile(file, bytes, 0660); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+)
+
+func testHolidaysWorksheet() map[string][][]any {
+	worksheets := testWorksheets()
+	worksheets["Holidays"] = [][]any{
+		[]any{"Date", "Description", "Controller", "Door"},
+		[]any{"2020-01-01", "New Year's Day", "", ""},
+		[]any{"2030-01-01", "New Year's Day", "", "Kitchen"},
+		[]any{"2030-12-25", "Christmas Day", "", ""},
+		[]any{"2030-12-26", "Boxing Day", "405419896", "Front Door, 2"},
+	}
+
+	return worksheets
+}
+
+func mktask(task types.TaskType, door uint8, date string) types.Task {
+	return types.Task{
+		Task:     task,
+		Door:     door,
+		From:     types.MustParseDate(date),
+		To:       types.MustParseDate(date),
+		Weekdays: mkprofile(2, 0, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}).Weekdays,
+		Start:    types.NewHHmm(0, 0),
+	}
+}
+
+func TestSetHolidays(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testHolidaysWorksheet())
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	cmd := SetHolidays{
+		command:      fake.command(t, sim),
+		area:         "Holidays!A1:D",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	for range 2 {
+		if err := cmd.Execute(&Options{Config: config}); err != nil {
+			t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+		}
+	}
+
+	expected := map[uint32][]types.Task{
+		405419896: []types.Task{
+			mktask(types.DisableTimeProfile, 1, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 1, "2030-12-27"),
+			mktask(types.DisableTimeProfile, 2, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 2, "2030-12-27"),
+			mktask(types.DisableTimeProfile, 3, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 3, "2030-12-26"),
+			mktask(types.DisableTimeProfile, 4, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 4, "2030-12-26"),
+		},
+		303986753: []types.Task{
+			mktask(types.DisableTimeProfile, 1, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 1, "2030-12-26"),
+			mktask(types.DisableTimeProfile, 2, "2030-01-01"),
+			mktask(types.EnableTimeProfile, 2, "2030-01-02"),
+			mktask(types.DisableTimeProfile, 2, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 2, "2030-12-26"),
+			mktask(types.DisableTimeProfile, 3, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 3, "2030-12-26"),
+			mktask(types.DisableTimeProfile, 4, "2030-12-25"),
+			mktask(types.EnableTimeProfile, 4, "2030-12-26"),
+		},
+	}
+
+	for id, tasks := range expected {
+		if c := sim.controllers[id]; !reflect.DeepEqual(c.tasks, tasks) {
+			t.Errorf("%v: incorrect task list\n   expected:%v\n   got:     %v", id, tasks, c.tasks)
+		}
+	}
+
+	log := [][]any{
+		[]any{"303986753", "0", "0", "2", "0", "0", "0"},
+		[]any{"405419896", "0", "0", "2", "0", "0", "0"},
+		[]any{"303986753", "2", "0", "0", "0", "0", "0"},
+		[]any{"405419896", "2", "0", "0", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestSetHolidaysWithDeletedHoliday(t *testing.T) {
+	fake, google := newFakeGoogle(t, testHolidaysWorksheet())
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	cmd := SetHolidays{
+		command:      fake.command(t, sim),
+		area:         "Holidays!A1:D",
+		replaceTasks: true,
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	// ... delete New Year's Day and remove door 2 from Boxing Day
+	updated := valueRange{
+		area: "Holidays!A3:D5",
+		values: [][]any{
+			[]any{"", "", "", ""},
+			[]any{"2030-12-25", "Christmas Day", "", ""},
+			[]any{"2030-12-26", "Boxing Day", "405419896", "Front Door"},
+		},
+	}
+
+	if err := google.Write(updated); err != nil {
+		t.Fatalf("Unexpected error updating holidays worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	tasks := []types.Task{
+		mktask(types.DisableTimeProfile, 1, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 1, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 2, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 2, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 3, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 3, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 4, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 4, "2030-12-26"),
+	}
+
+	if c := sim.controllers[303986753]; !reflect.DeepEqual(c.tasks, tasks) {
+		t.Errorf("Incorrect task list\n   expected:%v\n   got:     %v", tasks, c.tasks)
+	}
+
+	log := [][]any{
+		[]any{"303986753", "1", "0", "0", "1", "0", "0"},
+		[]any{"405419896", "1", "1", "0", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); len(rows) != 4 || !reflect.DeepEqual(rows[2:], log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestSetHolidaysWithExistingTasks(t *testing.T) {
+	fake, google := newFakeGoogle(t, testHolidaysWorksheet())
+	sim := newSimulator(testControllers())
+	config := sim.config(t)
+
+	// ... door mode task set by another application
+	other := types.Task{
+		Task:     types.DoorNormallyOpen,
+		Door:     1,
+		From:     types.MustParseDate("2026-01-01"),
+		To:       types.MustParseDate("2030-12-31"),
+		Weekdays: mktask(types.DoorNormallyOpen, 1, "2026-01-01").Weekdays,
+		Start:    types.NewHHmm(8, 30),
+	}
+
+	sim.controllers[303986753].tasks = []types.Task{other}
+
+	cmd := SetHolidays{
+		command:      fake.command(t, sim),
+		area:         "Holidays!A1:D",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	expected := []types.Task{
+		other,
+		mktask(types.DisableTimeProfile, 1, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 1, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 2, "2030-01-01"),
+		mktask(types.EnableTimeProfile, 2, "2030-01-02"),
+		mktask(types.DisableTimeProfile, 2, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 2, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 3, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 3, "2030-12-26"),
+		mktask(types.DisableTimeProfile, 4, "2030-12-25"),
+		mktask(types.EnableTimeProfile, 4, "2030-12-26"),
+	}
+
+	if c := sim.controllers[303986753]; !reflect.DeepEqual(c.tasks, expected) {
+		t.Errorf("Incorrect task list\n   expected:%v\n   got:     %v", expected, c.tasks)
+	}
+
+	// ... added holiday is appended to the task list
+	added := valueRange{
+		area:   "Holidays!A6:D6",
+		values: [][]any{[]any{"2030-06-01", "Founders Day", "303986753", "Kitchen"}},
+	}
+
+	if err := google.Write(added); err != nil {
+		t.Fatalf("Unexpected error updating holidays worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	expected = append(expected,
+		mktask(types.DisableTimeProfile, 2, "2030-06-01"),
+		mktask(types.EnableTimeProfile, 2, "2030-06-02"))
+
+	if c := sim.controllers[303986753]; !reflect.DeepEqual(c.tasks, expected) {
+		t.Errorf("Incorrect task list\n   expected:%v\n   got:     %v", expected, c.tasks)
+	}
+
+	// ... deleted holiday is not applied without --replace-tasks
+	deleted := valueRange{
+		area:   "Holidays!A3:D3",
+		values: [][]any{[]any{"", "", "", ""}},
+	}
+
+	if err := google.Write(deleted); err != nil {
+		t.Fatalf("Unexpected error updating holidays worksheet (%v)", err)
+	}
+
+	if err := cmd.Execute(&Options{Config: config}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	if c := sim.controllers[303986753]; !reflect.DeepEqual(c.tasks, expected) {
+		t.Errorf("Incorrect task list\n   expected:%v\n   got:     %v", expected, c.tasks)
+	}
+
+	if rows := logRows(fake); len(rows) < 2 || !reflect.DeepEqual(rows[len(rows)-2], []any{"303986753", "0", "0", "0", "0", "2", "0"}) {
+		t.Errorf("Incorrect log - expected failed holidays for %v, got %v", 303986753, rows)
+	}
+}
+
+func TestSetHolidaysWithForce(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testHolidaysWorksheet())
+	sim := newSimulator(testControllers())
+
+	cmd := SetHolidays{
+		command:      fake.command(t, sim),
+		area:         "Holidays!A1:D",
+		force:        true,
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Errorf("Expected error executing set-holidays with --force and without --replace-tasks")
+	}
+}
+
+func TestSetHolidaysWithDryRun(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testHolidaysWorksheet())
+	sim := newSimulator(testControllers())
+
+	cmd := SetHolidays{
+		command:      fake.command(t, sim),
+		area:         "Holidays!A1:D",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+		dryrun:       true,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing set-holidays (%v)", err)
+	}
+
+	for _, id := range []uint32{405419896, 303986753} {
+		if tasks := sim.controllers[id].tasks; len(tasks) != 0 {
+			t.Errorf("%v: unexpected tasks %v", id, tasks)
+		}
+	}
+
+	log := [][]any{
+		[]any{"303986753", "0", "0", "2", "0", "0", "0"},
+		[]any{"405419896", "0", "0", "2", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestParseHolidaysWithInvalidHolidays(t *testing.T) {
+	header := []any{"Date", "Description", "Controller", "Door"}
+	devices := []uhppote.Device{
+		uhppote.Device{DeviceID: 405419896, Name: "Alpha", Doors: []string{"Front Door", "Side Door", "Garage", "Workshop"}},
+	}
+
+	tests := map[string][]any{
+		"invalid date":       {"2030-12-32", "Christmas", "", ""},
+		"unknown controller": {"2030-12-25", "Christmas", "303986753", ""},
+		"unknown door":       {"2030-12-25", "Christmas", "", "Kitchen"},
+		"invalid door":       {"2030-12-25", "Christmas", "Alpha", "5"},
+	}
+
+	for k, row := range tests {
+		if _, err := parseHolidays([][]any{header, row}, devices, types.MustParseDate("2026-01-01")); err == nil {
+			t.Errorf("%v: expected error", k)
+		}
+	}
+
+	if _, err := parseHolidays([][]any{{"Description"}, {"Christmas"}}, devices, types.MustParseDate("2026-01-01")); err == nil {
+		t.Errorf("Expected error for missing 'Date' column")
+	}
+}
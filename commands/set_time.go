@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var SetTimeCmd = SetTime{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config:       config.DefaultConfig,
+	threshold:    10 * time.Second,
+	timezone:     "host",
+	nolog:        false,
+	logRange:     "Log!A1:H",
+	logRetention: 30,
+}
+
+type SetTime struct {
+	command
+	config       string
+	threshold    time.Duration
+	timezone     string
+	nolog        bool
+	logRange     string
+	logRetention int
+}
+
+func (cmd *SetTime) Name() string {
+	return "set-time"
+}
+
+func (cmd *SetTime) Description() string {
+	return "Synchronises the clocks of a set of configured UHPPOTE access controllers with the host or spreadsheet time"
+}
+
+func (cmd *SetTime) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *SetTime) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] set-time [options] --url <URL>\n", APP)
+	fmt.Println()
+	fmt.Println("  Compares the date and time of each configured controller with the current time and sets the controller date")
+	fmt.Println("  and time if the difference exceeds the --threshold. The controller time is compared with the host time (in the")
+	fmt.Println("  controller time zone if configured) or, with --time-zone spreadsheet, with the time in the spreadsheet time zone.")
+	fmt.Println()
+	fmt.Println("  The previous and updated controller times are recorded on the 'log' worksheet.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets set-time --credentials "credentials.json" \`)
+	fmt.Println(`                                --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets set-time --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                --threshold 1m --time-zone spreadsheet`)
+	fmt.Println()
+}
+
+func (cmd *SetTime) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("set-time")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.DurationVar(&cmd.threshold, "threshold", cmd.threshold, "Maximum allowed difference between the controller time and the current time e.g. 30s")
+	flagset.StringVar(&cmd.timezone, "time-zone", cmd.timezone, "Time zone for the current time - 'host' or 'spreadsheet'")
+
+	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing the controller time updates to the 'log' worksheet")
+	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
+	flagset.IntVar(&cmd.logRetention, "log-retention", cmd.logRetention, "Log sheet records older than 'log-retention' days are automatically pruned")
+
+	return flagset
+}
+
+func (cmd *SetTime) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	// ... locked?
+	if locks, err := cmd.lockControllers(devices, LOCK_MAX_AGE); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  time-zone:%s  log:%s", backend.ID(), cmd.timezone, cmd.logRange)
+	}
+
+	var tz *time.Location
+	if cmd.timezone == "spreadsheet" {
+		if tz, err = backend.TimeZone(); err != nil {
+			return err
+		}
+
+		infof("Spreadsheet time zone %v", tz)
+	}
+
+	set, _ := forEach(ctx, devices, func(d uhppote.Device) (*logEntry, error) {
+		return cmd.set(u, d, tz), nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, cmd.nolog, cmd.logRange)
+	}
+
+	entries := []logEntry{}
+	for _, d := range devices {
+		if entry := set[d.DeviceID]; entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+
+	if !cmd.nolog && len(entries) > 0 {
+		if err := writeLogEntries(backend, cmd.logRange, entries); err != nil {
+			return err
+		}
+
+		if err := pruneSheet(backend, cmd.logRange, cmd.logRetention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *SetTime) validate() error {
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if cmd.threshold < 0 {
+		return fmt.Errorf("invalid --threshold '%v' - expected a positive duration", cmd.threshold)
+	}
+
+	if cmd.timezone != "host" && cmd.timezone != "spreadsheet" {
+		return fmt.Errorf("invalid --time-zone '%v' - expected 'host' or 'spreadsheet'", cmd.timezone)
+	}
+
+	if !cmd.nolog {
+		if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+[0-9]+):([a-zA-Z]+(?:[0-9]+)?)`).FindStringSubmatch(cmd.logRange); len(match) < 4 {
+			return fmt.Errorf("invalid log-range '%s' - expected something like 'Log!A1:H", cmd.logRange)
+		}
+	}
+
+	return nil
+}
+
+// Sets the controller date and time if the controller clock differs from the current time by more than
+// the threshold. The current time is in the spreadsheet time zone if 'tz' is not nil, otherwise in the
+// controller time zone (defaulting to the host time zone). Returns a log entry if the controller time was
+// set or could not be set.
+func (cmd *SetTime) set(u uhppote.IUHPPOTE, d uhppote.Device, tz *time.Location) *logEntry {
+	if tz == nil {
+		tz = timezone(d)
+	}
+
+	current, err := u.GetTime(d.DeviceID)
+	if err != nil || current == nil {
+		errorf("%v  error retrieving controller time (%v)", d.DeviceID, err)
+		return &logEntry{deviceID: d.DeviceID, message: fmt.Sprintf("ERROR: could not retrieve controller time (%v)", err)}
+	}
+
+	now := time.Now().In(tz)
+	previous := time.Time(current.DateTime)
+	drift := wallClock(previous).Sub(wallClock(now))
+
+	if drift.Abs() <= cmd.threshold {
+		infof("%v  controller time %v  drift:%v (within threshold)", d.DeviceID, previous.Format("2006-01-02 15:04:05"), drift)
+		return nil
+	}
+
+	updated, err := u.SetTime(d.DeviceID, now)
+	if err != nil || updated == nil {
+		errorf("%v  error setting controller time (%v)", d.DeviceID, err)
+		return &logEntry{deviceID: d.DeviceID, message: fmt.Sprintf("ERROR: could not set controller time (%v)", err)}
+	}
+
+	from := previous.Format("2006-01-02 15:04:05")
+	to := time.Time(updated.DateTime).Format("2006-01-02 15:04:05")
+
+	infof("%v  set controller time %v (was %v, drift:%v)", d.DeviceID, to, from, drift)
+
+	return &logEntry{
+		deviceID: d.DeviceID,
+		message:  fmt.Sprintf("set-time  old:%v  new:%v  drift:%v", from, to, drift),
+	}
+}
+
+// Returns the controller time zone, defaulting to the host time zone.
+func timezone(d uhppote.Device) *time.Location {
+	if d.TimeZone != nil {
+		return d.TimeZone
+	}
+
+	return time.Local
+}
+
+// Returns the wall clock time for comparing controller times (the controller has no notion of time zone).
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
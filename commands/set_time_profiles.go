@@ -0,0 +1,495 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var SetTimeProfilesCmd = SetTimeProfiles{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config:       config.DefaultConfig,
+	area:         "TimeProfiles!A1:I",
+	dryrun:       false,
+	nolog:        false,
+	logRange:     "Log!A1:H",
+	logRetention: 30,
+}
+
+type SetTimeProfiles struct {
+	command
+	config       string
+	area         string
+	dryrun       bool
+	nolog        bool
+	logRange     string
+	logRetention int
+}
+
+var daysOfWeek = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+func (cmd *SetTimeProfiles) Name() string {
+	return "set-time-profiles"
+}
+
+func (cmd *SetTimeProfiles) Description() string {
+	return "Updates the time profiles on a set of configured UHPPOTE access controllers from a Google Sheets worksheet"
+}
+
+func (cmd *SetTimeProfiles) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *SetTimeProfiles) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] set-time-profiles [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Updates the time profiles on a set of configured controllers from a Google Sheets worksheet. The worksheet is expected")
+	fmt.Println("  to have the columns 'Profile ID', 'From', 'To', 'Weekdays', 'Segment 1', 'Segment 2', 'Segment 3' and 'Linked Profile'")
+	fmt.Println("  e.g.")
+	fmt.Println()
+	fmt.Println("    Profile ID  Name          From        To          Weekdays         Segment 1    Segment 2    Segment 3  Linked Profile")
+	fmt.Println("    29          Weekdays 8-6  2026-01-01  2026-12-31  Mon,Tue,Wed,Thu  08:00-12:00  13:00-18:00")
+	fmt.Println()
+	fmt.Println("  Only time profiles that differ from the worksheet are updated on the controllers - time profiles that are not defined on")
+	fmt.Println("  the worksheet are not changed.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets set-time-profiles --credentials "credentials.json" \`)
+	fmt.Println(`                                         --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                         --range "TimeProfiles!A1:I"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets set-time-profiles --file "site.xlsx" --dry-run`)
+	fmt.Println()
+}
+
+func (cmd *SetTimeProfiles) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("set-time-profiles")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range of the time profiles e.g. 'TimeProfiles!A1:I'")
+	flagset.BoolVar(&cmd.dryrun, "dry-run", cmd.dryrun, "Reports the time profile changes without updating the access controllers")
+
+	flagset.BoolVar(&cmd.nolog, "no-log", cmd.nolog, "Disables writing a summary to the 'log' worksheet")
+	flagset.StringVar(&cmd.logRange, "log-range", cmd.logRange, "Spreadsheet range for logging result")
+	flagset.IntVar(&cmd.logRetention, "log-retention", cmd.logRetention, "Log sheet records older than 'log-retention' days are automatically pruned")
+
+	return flagset
+}
+
+func (cmd *SetTimeProfiles) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// ... good to go!
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	// ... locked?
+	if locks, err := cmd.lockControllers(devices, LOCK_MAX_AGE); err != nil {
+		return err
+	} else {
+		defer locks.release()
+	}
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s  log:%s", backend.ID(), cmd.area, cmd.logRange)
+	}
+
+	values, err := backend.Read(cmd.area)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve time profiles from sheet (%v)", err)
+	}
+
+	profiles, err := parseTimeProfiles(values)
+	if err != nil {
+		return err
+	}
+
+	infof("Downloaded %v time profiles", len(profiles))
+
+	rpt, _ := forEach(ctx, devices, func(d uhppote.Device) (lib.Report, error) {
+		return cmd.update(u, d.DeviceID, profiles), nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, cmd.nolog, cmd.logRange)
+	}
+
+	summary := lib.Summarize(rpt)
+	format := "%v  unchanged:%v  updated:%v  added:%v  failed:%v  errors:%v"
+	for _, v := range summary {
+		infof(format, v.DeviceID, v.Unchanged, v.Updated, v.Added, v.Failed, v.Errored)
+	}
+
+	if !cmd.nolog {
+		if err := writeLog(backend, cmd.logRange, rpt); err != nil {
+			return err
+		}
+
+		if err := pruneSheet(backend, cmd.logRange, cmd.logRetention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *SetTimeProfiles) validate() error {
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(cmd.area)); len(match) < 2 {
+		return fmt.Errorf("invalid range '%s' - expected something like 'TimeProfiles!A1:I", cmd.area)
+	}
+
+	if !cmd.nolog {
+		if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+[0-9]+):([a-zA-Z]+(?:[0-9]+)?)`).FindStringSubmatch(cmd.logRange); len(match) < 4 {
+			return fmt.Errorf("invalid log-range '%s' - expected something like 'Log!A1:H", cmd.logRange)
+		}
+	}
+
+	return nil
+}
+
+// Compares the time profiles on a controller with the worksheet time profiles and updates any that
+// have changed. The report lists the profile IDs.
+func (cmd *SetTimeProfiles) update(u uhppote.IUHPPOTE, deviceID uint32, profiles []types.TimeProfile) lib.Report {
+	rpt := lib.Report{
+		Unchanged: []uint32{},
+		Updated:   []uint32{},
+		Added:     []uint32{},
+		Deleted:   []uint32{},
+		Failed:    []uint32{},
+		Errored:   []uint32{},
+		Errors:    []error{},
+	}
+
+	for _, p := range profiles {
+		id := uint32(p.ID)
+
+		current, err := u.GetTimeProfile(deviceID, p.ID)
+		if err != nil {
+			errorf("%v  time profile %v: %v", deviceID, p.ID, err)
+			rpt.Errored = append(rpt.Errored, id)
+			rpt.Errors = append(rpt.Errors, err)
+			continue
+		}
+
+		if current != nil && sameTimeProfile(*current, p) {
+			rpt.Unchanged = append(rpt.Unchanged, id)
+			continue
+		}
+
+		if current == nil {
+			infof("%v  add time profile    %v", deviceID, p)
+		} else {
+			infof("%v  update time profile %v (was %v)", deviceID, p, current)
+		}
+
+		if !cmd.dryrun {
+			if ok, err := u.SetTimeProfile(deviceID, p); err != nil {
+				errorf("%v  time profile %v: %v", deviceID, p.ID, err)
+				rpt.Errored = append(rpt.Errored, id)
+				rpt.Errors = append(rpt.Errors, err)
+				continue
+			} else if !ok {
+				warnf("%v  time profile %v not set", deviceID, p.ID)
+				rpt.Failed = append(rpt.Failed, id)
+				continue
+			}
+		}
+
+		if current == nil {
+			rpt.Added = append(rpt.Added, id)
+		} else {
+			rpt.Updated = append(rpt.Updated, id)
+		}
+	}
+
+	return rpt
+}
+
+// Parses and validates the time profiles worksheet. Rows without a profile ID are ignored.
+func parseTimeProfiles(values [][]any) ([]types.TimeProfile, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no data in time profiles spreadsheet/range")
+	}
+
+	fields := []string{"profileid", "from", "to", "weekdays", "segment1", "segment2", "segment3", "linkedprofile"}
+	index, _ := buildIndex(values[:1], fields)
+
+	required := map[string]string{
+		"profileid": "Profile ID",
+		"from":      "From",
+		"to":        "To",
+		"weekdays":  "Weekdays",
+	}
+
+	for f, column := range required {
+		if _, ok := index[f]; !ok {
+			return nil, fmt.Errorf("missing '%v' column in time profiles worksheet", column)
+		}
+	}
+
+	get := func(record []any, field string) string {
+		if ix, ok := index[field]; ok {
+			return clean(value(record, ix))
+		}
+
+		return ""
+	}
+
+	profiles := []types.TimeProfile{}
+	ids := map[uint8]int{}
+
+	for i, record := range values[1:] {
+		row := i + 2
+		if get(record, "profileid") == "" {
+			continue
+		}
+
+		p, err := parseTimeProfile(get, record)
+		if err != nil {
+			return nil, fmt.Errorf("time profiles row %v: %v", row, err)
+		}
+
+		if r, ok := ids[p.ID]; ok {
+			return nil, fmt.Errorf("time profiles row %v: duplicate profile ID %v (row %v)", row, p.ID, r)
+		}
+
+		ids[p.ID] = row
+		profiles = append(profiles, *p)
+	}
+
+	// ... linked profiles must be defined and not circular
+	for _, p := range profiles {
+		visited := map[uint8]bool{p.ID: true}
+		for linked := p.LinkedProfileID; linked != 0; {
+			if _, ok := ids[linked]; !ok {
+				return nil, fmt.Errorf("time profile %v: linked profile %v is not defined", p.ID, linked)
+			} else if visited[linked] {
+				return nil, fmt.Errorf("time profile %v: circular linked profiles", p.ID)
+			}
+
+			visited[linked] = true
+			for _, q := range profiles {
+				if q.ID == linked {
+					linked = q.LinkedProfileID
+					break
+				}
+			}
+		}
+	}
+
+	return profiles, nil
+}
+
+func parseTimeProfile(get func([]any, string) string, record []any) (*types.TimeProfile, error) {
+	id, err := parseProfileID(get(record, "profileid"))
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := types.ParseDate(get(record, "from"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'from' date '%v'", get(record, "from"))
+	}
+
+	to, err := types.ParseDate(get(record, "to"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'to' date '%v'", get(record, "to"))
+	} else if to.Before(from) {
+		return nil, fmt.Errorf("'to' date %v is before 'from' date %v", to, from)
+	}
+
+	days, err := parseWeekdays(get(record, "weekdays"))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := types.Segments{}
+	for i, f := range []string{"segment1", "segment2", "segment3"} {
+		if segment, err := parseSegment(get(record, f)); err != nil {
+			return nil, err
+		} else {
+			segments[uint8(i+1)] = segment
+		}
+	}
+
+	var linked uint8
+	if v := get(record, "linkedprofile"); v != "" {
+		if linked, err = parseProfileID(v); err != nil {
+			return nil, fmt.Errorf("invalid linked profile (%v)", err)
+		} else if linked == id {
+			return nil, fmt.Errorf("time profile %v is linked to itself", id)
+		}
+	}
+
+	return &types.TimeProfile{
+		ID:              id,
+		LinkedProfileID: linked,
+		From:            from,
+		To:              to,
+		Weekdays:        days,
+		Segments:        segments,
+	}, nil
+}
+
+func parseProfileID(s string) (uint8, error) {
+	if v, err := strconv.ParseUint(s, 10, 8); err != nil || v < 2 || v > 254 {
+		return 0, fmt.Errorf("invalid profile ID '%v' (valid profiles are in the interval [2..254])", s)
+	} else {
+		return uint8(v), nil
+	}
+}
+
+// Parses a list of weekdays e.g. 'Mon,Tue,Wed' or 'Mon-Fri'. Days may be abbreviated to three letters.
+func parseWeekdays(s string) (types.Weekdays, error) {
+	days := types.Weekdays{
+		time.Monday:    false,
+		time.Tuesday:   false,
+		time.Wednesday: false,
+		time.Thursday:  false,
+		time.Friday:    false,
+		time.Saturday:  false,
+		time.Sunday:    false,
+	}
+
+	day := func(s string) (time.Weekday, error) {
+		v := strings.ToLower(strings.TrimSpace(s))
+		if len(v) >= 3 {
+			if d, ok := daysOfWeek[v[:3]]; ok && strings.HasPrefix(strings.ToLower(d.String()), v) {
+				return d, nil
+			}
+		}
+
+		return time.Sunday, fmt.Errorf("invalid weekday '%v'", s)
+	}
+
+	for token := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+
+		if start, end, ok := strings.Cut(token, "-"); ok {
+			from, err := day(start)
+			if err != nil {
+				return nil, err
+			}
+
+			to, err := day(end)
+			if err != nil {
+				return nil, err
+			}
+
+			for d := from; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == to {
+					break
+				}
+			}
+		} else if d, err := day(token); err != nil {
+			return nil, err
+		} else {
+			days[d] = true
+		}
+	}
+
+	return days, nil
+}
+
+// Parses a time segment e.g. '08:30-17:00'. A blank segment is returned as 00:00-00:00.
+func parseSegment(s string) (types.Segment, error) {
+	if s == "" {
+		return types.Segment{Start: types.NewHHmm(0, 0), End: types.NewHHmm(0, 0)}, nil
+	}
+
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return types.Segment{}, fmt.Errorf("invalid time segment '%v' - expected something like 08:30-17:00", s)
+	}
+
+	from, err := types.HHmmFromString(strings.TrimSpace(start))
+	if err != nil {
+		return types.Segment{}, fmt.Errorf("invalid time segment '%v' (%v)", s, err)
+	}
+
+	to, err := types.HHmmFromString(strings.TrimSpace(end))
+	if err != nil {
+		return types.Segment{}, fmt.Errorf("invalid time segment '%v' (%v)", s, err)
+	}
+
+	if to.Before(*from) {
+		return types.Segment{}, fmt.Errorf("invalid time segment '%v' - end is before start", s)
+	}
+
+	return types.Segment{Start: *from, End: *to}, nil
+}
+
+func sameTimeProfile(p, q types.TimeProfile) bool {
+	if p.ID != q.ID || p.LinkedProfileID != q.LinkedProfileID || !p.From.Equals(q.From) || !p.To.Equals(q.To) {
+		return false
+	}
+
+	for _, d := range daysOfWeek {
+		if p.Weekdays[d] != q.Weekdays[d] {
+			return false
+		}
+	}
+
+	for _, ix := range []uint8{1, 2, 3} {
+		if !p.Segments[ix].Start.Equals(q.Segments[ix].Start) || !p.Segments[ix].End.Equals(q.Segments[ix].End) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func testTimeProfilesWorksheet() map[string][][]any {
+	worksheets := testWorksheets()
+	worksheets["TimeProfiles"] = [][]any{
+		[]any{"Profile ID", "Name", "From", "To", "Weekdays", "Segment 1", "Segment 2", "Segment 3", "Linked Profile"},
+		[]any{"29", "Weekdays 8-6", "2026-01-01", "2026-12-31", "Mon-Fri", "08:00-12:00", "13:00-18:00", "", "30"},
+		[]any{"30", "Weekends", "2026-01-01", "2026-12-31", "Sat,Sun", "09:00-13:00", "", "", ""},
+	}
+
+	return worksheets
+}
+
+func mkprofile(id uint8, linked uint8, days []time.Weekday, segments ...string) types.TimeProfile {
+	profile := types.TimeProfile{
+		ID:              id,
+		LinkedProfileID: linked,
+		From:            types.MustParseDate("2026-01-01"),
+		To:              types.MustParseDate("2026-12-31"),
+		Weekdays:        types.Weekdays{},
+		Segments:        types.Segments{},
+	}
+
+	for _, d := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		profile.Weekdays[d] = false
+	}
+
+	for _, d := range days {
+		profile.Weekdays[d] = true
+	}
+
+	for i := range 3 {
+		segment := types.Segment{Start: types.NewHHmm(0, 0), End: types.NewHHmm(0, 0)}
+		if i < len(segments) {
+			segment, _ = parseSegment(segments[i])
+		}
+
+		profile.Segments[uint8(i+1)] = segment
+	}
+
+	return profile
+}
+
+func TestSetTimeProfiles(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testTimeProfilesWorksheet())
+	controllers := testControllers()
+	weekends := []time.Weekday{time.Saturday, time.Sunday}
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+	controllers[405419896].profiles = map[uint8]types.TimeProfile{
+		30: mkprofile(30, 0, weekends, "09:00-13:00"),
+		31: mkprofile(31, 0, weekends, "10:00-11:00"),
+	}
+
+	controllers[303986753].profiles = map[uint8]types.TimeProfile{
+		30: mkprofile(30, 0, weekends, "09:00-12:00"),
+	}
+
+	sim := newSimulator(controllers)
+
+	cmd := SetTimeProfiles{
+		command:      fake.command(t, sim),
+		area:         "TimeProfiles!A1:I",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing set-time-profiles (%v)", err)
+	}
+
+	expected := map[uint8]types.TimeProfile{
+		29: mkprofile(29, 30, weekdays, "08:00-12:00", "13:00-18:00"),
+		30: mkprofile(30, 0, weekends, "09:00-13:00"),
+		31: mkprofile(31, 0, weekends, "10:00-11:00"),
+	}
+
+	if profiles := sim.controllers[405419896].profiles; !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("Incorrect time profiles\n   expected:%v\n   got:     %v", expected, profiles)
+	}
+
+	delete(expected, 31)
+	if profiles := sim.controllers[303986753].profiles; !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("Incorrect time profiles\n   expected:%v\n   got:     %v", expected, profiles)
+	}
+
+	log := [][]any{
+		[]any{"303986753", "0", "1", "1", "0", "0", "0"},
+		[]any{"405419896", "1", "0", "1", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestSetTimeProfilesWithDryRun(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testTimeProfilesWorksheet())
+	sim := newSimulator(testControllers())
+
+	cmd := SetTimeProfiles{
+		command:      fake.command(t, sim),
+		area:         "TimeProfiles!A1:I",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+		dryrun:       true,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing set-time-profiles (%v)", err)
+	}
+
+	for _, id := range []uint32{405419896, 303986753} {
+		if profiles := sim.controllers[id].profiles; len(profiles) != 0 {
+			t.Errorf("%v: unexpected time profiles %v", id, profiles)
+		}
+	}
+
+	log := [][]any{
+		[]any{"303986753", "0", "0", "2", "0", "0", "0"},
+		[]any{"405419896", "0", "0", "2", "0", "0", "0"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, log) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", log, rows)
+	}
+}
+
+func TestParseTimeProfilesWithInvalidProfiles(t *testing.T) {
+	header := []any{"Profile ID", "From", "To", "Weekdays", "Segment 1", "Segment 2", "Segment 3", "Linked Profile"}
+
+	tests := map[string][]any{
+		"invalid ID":        {"1", "2026-01-01", "2026-12-31", "Mon", "", "", "", ""},
+		"invalid from date": {"29", "2026-01-32", "2026-12-31", "Mon", "", "", "", ""},
+		"to before from":    {"29", "2026-12-31", "2026-01-01", "Mon", "", "", "", ""},
+		"invalid weekday":   {"29", "2026-01-01", "2026-12-31", "Mon,Funday", "", "", "", ""},
+		"invalid segment":   {"29", "2026-01-01", "2026-12-31", "Mon", "08:00", "", "", ""},
+		"reversed segment":  {"29", "2026-01-01", "2026-12-31", "Mon", "", "17:00-08:00", "", ""},
+		"self linked":       {"29", "2026-01-01", "2026-12-31", "Mon", "", "", "", "29"},
+		"undefined linked":  {"29", "2026-01-01", "2026-12-31", "Mon", "", "", "", "31"},
+	}
+
+	for k, row := range tests {
+		if _, err := parseTimeProfiles([][]any{header, row}); err == nil {
+			t.Errorf("%v: expected error", k)
+		}
+	}
+
+	circular := [][]any{
+		header,
+		[]any{"29", "2026-01-01", "2026-12-31", "Mon", "", "", "", "30"},
+		[]any{"30", "2026-01-01", "2026-12-31", "Mon", "", "", "", "29"},
+	}
+
+	if _, err := parseTimeProfiles(circular); err == nil {
+		t.Errorf("Expected error for circular linked profiles")
+	}
+
+	duplicate := [][]any{
+		header,
+		[]any{"29", "2026-01-01", "2026-12-31", "Mon", "", "", "", ""},
+		[]any{"29", "2026-01-01", "2026-12-31", "Tue", "", "", "", ""},
+	}
+
+	if _, err := parseTimeProfiles(duplicate); err == nil {
+		t.Errorf("Expected error for duplicate profile ID")
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := map[string][]time.Weekday{
+		"":                   {},
+		"Mon":                {time.Monday},
+		"monday, Tues,wed":   {time.Monday, time.Tuesday, time.Wednesday},
+		"Mon-Fri":            {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		"Sat-Mon":            {time.Saturday, time.Sunday, time.Monday},
+		"Mon,Wed-Thu,Sunday": {time.Monday, time.Wednesday, time.Thursday, time.Sunday},
+	}
+
+	for s, days := range tests {
+		weekdays, err := parseWeekdays(s)
+		if err != nil {
+			t.Errorf("Unexpected error parsing weekdays '%v' (%v)", s, err)
+			continue
+		}
+
+		expected := mkprofile(2, 0, days).Weekdays
+		if !reflect.DeepEqual(weekdays, expected) {
+			t.Errorf("Incorrect weekdays for '%v'\n   expected:%v\n   got:     %v", s, expected, weekdays)
+		}
+	}
+}
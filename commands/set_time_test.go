@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetTime(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets())
+	controllers := testControllers()
+	controllers[405419896].drift = 90 * time.Second
+	controllers[303986753].drift = -3 * time.Second
+	sim := newSimulator(controllers)
+
+	cmd := SetTime{
+		command:      fake.command(t, sim),
+		threshold:    10 * time.Second,
+		timezone:     "host",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing set-time (%v)", err)
+	}
+
+	if drift := sim.controllers[405419896].drift; drift.Abs() > time.Second {
+		t.Errorf("Incorrect controller time - expected drift:%v, got:%v", 0, drift)
+	}
+
+	if drift := sim.controllers[303986753].drift; drift != -3*time.Second {
+		t.Errorf("Unexpected update to controller time - expected drift:%v, got:%v", -3*time.Second, drift)
+	}
+
+	rows := logRows(fake)
+	if len(rows) != 1 {
+		t.Fatalf("Incorrect number of log entries - expected:%v, got:%v (%v)", 1, len(rows), rows)
+	}
+
+	if rows[0][0] != "405419896" {
+		t.Errorf("Incorrect log entry controller - expected:%v, got:%v", 405419896, rows[0][0])
+	}
+
+	if message := rows[0][1].(string); !strings.HasPrefix(message, "set-time  old:") || !strings.Contains(message, "drift:1m30s") {
+		t.Errorf("Incorrect log entry message %v", message)
+	}
+}
+
+func TestSetTimeWithCancel(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets())
+	controllers := testControllers()
+	controllers[405419896].drift = 90 * time.Second
+	sim := newSimulator(controllers)
+
+	cmd := SetTime{
+		command:      fake.command(t, sim),
+		threshold:    10 * time.Second,
+		timezone:     "host",
+		logRange:     "Log!A1:H",
+		logRetention: 30,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := cmd.Execute(&Options{Config: sim.config(t), Context: ctx}); err != context.Canceled {
+		t.Fatalf("Incorrect error executing cancelled set-time - expected:%v, got:%v", context.Canceled, err)
+	}
+
+	if drift := sim.controllers[405419896].drift; drift != 90*time.Second {
+		t.Errorf("Unexpected update to controller time - expected drift:%v, got:%v", 90*time.Second, drift)
+	}
+
+	expected := [][]any{
+		[]any{"", "CANCELLED: context canceled"},
+	}
+
+	if rows := logRows(fake); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect log\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestSetTimeWithSpreadsheetTimeZone(t *testing.T) {
+	fake, _ := newFakeGoogle(t, testWorksheets())
+	fake.timezone = "Asia/Tokyo"
+	sim := newSimulator(testControllers())
+
+	cmd := SetTime{
+		command:   fake.command(t, sim),
+		threshold: 10 * time.Second,
+		timezone:  "spreadsheet",
+		nolog:     true,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing set-time (%v)", err)
+	}
+
+	tz, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Now()
+	_, offset := now.In(tz).Zone()
+	_, local := now.Zone()
+	expected := time.Duration(offset-local) * time.Second
+
+	for _, id := range []uint32{405419896, 303986753} {
+		if drift := sim.controllers[id].drift; (drift - expected).Abs() > time.Second {
+			t.Errorf("%v: incorrect controller time - expected drift:%v, got:%v", id, expected, drift)
+		}
+	}
+
+	if rows := logRows(fake); len(rows) != 0 {
+		t.Errorf("Unexpected log entries %v", rows)
+	}
+}
+
+func TestSetTimeWithInvalidTimeZone(t *testing.T) {
+	cmd := SetTime{
+		command: command{
+			url: fakeSpreadsheetURL,
+		},
+		timezone: "UTC",
+		logRange: "Log!A1:H",
+	}
+
+	if err := cmd.validate(); err == nil {
+		t.Errorf("Expected error for invalid --time-zone")
+	}
+}
@@ -0,0 +1,507 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+)
+
+// In-memory stand-in for a fleet of UHPPOTE controllers. Only the functions used by the
+// commands are implemented - anything else panics on the embedded nil IUHPPOTE.
+type simulator struct {
+	uhppote.IUHPPOTE
+	sync.Mutex
+	controllers map[uint32]*simulated
+}
+
+type simulated struct {
+	doors    []string
+	cards    []*types.Card // nil entries are deleted card records
+	profiles map[uint8]types.TimeProfile
+	events   []types.Event // events stored on the controller, in index order
+	tasks    []types.Task  // active task list
+	pending  []types.Task  // tasks added since the last refresh
+	modes    map[uint8]types.DoorControlState
+	drift    time.Duration // controller clock offset from the host
+	timezone string        // configured controller time zone (defaults to the host time zone)
+	keypads  map[uint8]bool
+	offline  bool
+	readonly map[uint32]bool // cards the controller 'refuses' to store
+	errors   map[uint32]bool // cards for which the controller returns an error
+}
+
+func newSimulator(controllers map[uint32]*simulated) *simulator {
+	for _, c := range controllers {
+		if c.profiles == nil {
+			c.profiles = map[uint8]types.TimeProfile{}
+		}
+
+		if c.readonly == nil {
+			c.readonly = map[uint32]bool{}
+		}
+
+		if c.errors == nil {
+			c.errors = map[uint32]bool{}
+		}
+	}
+
+	return &simulator{
+		controllers: controllers,
+	}
+}
+
+// Creates a card record with the door permissions for doors 1 to 4.
+func mkcard(number uint32, from, to string, doors ...uint8) *types.Card {
+	card := types.Card{
+		CardNumber: number,
+		From:       types.MustParseDate(from),
+		To:         types.MustParseDate(to),
+		Doors:      map[uint8]uint8{1: 0, 2: 0, 3: 0, 4: 0},
+	}
+
+	for i, d := range doors {
+		card.Doors[uint8(i+1)] = d
+	}
+
+	return &card
+}
+
+// Writes a uhppoted.conf file for the simulated controllers.
+func (s *simulator) config(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "uhppoted.conf")
+
+	var b strings.Builder
+	for id, c := range s.controllers {
+		fmt.Fprintf(&b, "UT0311-L0x.%v.name = D%v\n", id, id)
+		fmt.Fprintf(&b, "UT0311-L0x.%v.address = 192.168.1.100:60000\n", id)
+		if c.timezone != "" {
+			fmt.Fprintf(&b, "UT0311-L0x.%v.timezone = %v\n", id, c.timezone)
+		}
+		for i, door := range c.doors {
+			if door != "" {
+				fmt.Fprintf(&b, "UT0311-L0x.%v.door.%v = %v\n", id, i+1, door)
+			}
+		}
+		fmt.Fprintln(&b)
+	}
+
+	if err := os.WriteFile(file, []byte(b.String()), 0600); err != nil {
+		t.Fatalf("Error creating configuration file (%v)", err)
+	}
+
+	return file
+}
+
+// Returns the cards stored on a simulated controller, sorted by card number.
+func (s *simulator) cards(deviceID uint32) []types.Card {
+	s.Lock()
+	defer s.Unlock()
+
+	cards := []types.Card{}
+	if c, ok := s.controllers[deviceID]; ok {
+		for _, card := range c.cards {
+			if card != nil {
+				cards = append(cards, card.Clone())
+			}
+		}
+	}
+
+	slices.SortFunc(cards, func(p, q types.Card) int {
+		return int(p.CardNumber) - int(q.CardNumber)
+	})
+
+	return cards
+}
+
+func (s *simulator) controller(deviceID uint32) (*simulated, error) {
+	if c, ok := s.controllers[deviceID]; !ok {
+		return nil, fmt.Errorf("no response from %v", deviceID)
+	} else if c.offline {
+		return nil, fmt.Errorf("timeout waiting for response from %v", deviceID)
+	} else {
+		return c, nil
+	}
+}
+
+func (s *simulator) GetDevice(deviceID uint32) (*types.Device, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := s.controller(deviceID); err != nil {
+		return nil, err
+	}
+
+	return &types.Device{
+		SerialNumber: types.SerialNumber(deviceID),
+		IpAddress:    net.IPv4(192, 168, 1, 100),
+		SubnetMask:   net.IPv4(255, 255, 255, 0),
+		Gateway:      net.IPv4(192, 168, 1, 1),
+		Version:      0x0892,
+		Date:         types.MustParseDate("2018-11-05"),
+	}, nil
+}
+
+// Returns the controller status, with the door states, relay state and last event index
+// derived from the simulated controller.
+func (s *simulator) GetStatus(deviceID uint32) (*types.Status, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := types.Status{
+		SerialNumber:   types.SerialNumber(deviceID),
+		DoorState:      map[uint8]bool{1: false, 2: false, 3: false, 4: false},
+		DoorButton:     map[uint8]bool{1: false, 2: false, 3: false, 4: false},
+		SystemDateTime: types.DateTime(time.Now().Add(c.drift)),
+	}
+
+	for door, state := range c.modes {
+		if state.ControlState == types.NormallyOpen {
+			status.DoorState[door] = true
+			status.RelayState |= 1 << (door - 1)
+		}
+	}
+
+	if len(c.events) > 0 {
+		status.Event.Index = c.events[len(c.events)-1].Index
+	}
+
+	return &status, nil
+}
+
+func (s *simulator) GetCards(deviceID uint32) (uint32, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := uint32(0)
+	for _, card := range c.cards {
+		if card != nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *simulator) GetCardByIndex(deviceID, index uint32) (*types.Card, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 1 || int(index) > len(c.cards) || c.cards[index-1] == nil {
+		return nil, nil
+	}
+
+	card := c.cards[index-1].Clone()
+
+	return &card, nil
+}
+
+func (s *simulator) GetCardByID(deviceID, cardNumber uint32) (*types.Card, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, card := range c.cards {
+		if card != nil && card.CardNumber == cardNumber {
+			v := card.Clone()
+			return &v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *simulator) PutCard(deviceID uint32, card types.Card, formats ...types.CardFormat) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	if c.errors[card.CardNumber] {
+		return false, fmt.Errorf("error storing card %v on %v", card.CardNumber, deviceID)
+	}
+
+	if c.readonly[card.CardNumber] {
+		return false, nil
+	}
+
+	v := card.Clone()
+	for i, p := range c.cards {
+		if p != nil && p.CardNumber == card.CardNumber {
+			c.cards[i] = &v
+			return true, nil
+		}
+	}
+
+	c.cards = append(c.cards, &v)
+
+	return true, nil
+}
+
+func (s *simulator) DeleteCard(deviceID uint32, cardNumber uint32) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	if c.errors[cardNumber] {
+		return false, fmt.Errorf("error deleting card %v from %v", cardNumber, deviceID)
+	}
+
+	for i, p := range c.cards {
+		if p != nil && p.CardNumber == cardNumber {
+			c.cards[i] = nil
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *simulator) GetTime(deviceID uint32) (*types.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Time{
+		SerialNumber: types.SerialNumber(deviceID),
+		DateTime:     types.DateTime(time.Now().Add(c.drift).Truncate(time.Second)),
+	}, nil
+}
+
+// Sets the controller clock to the wall clock time of 'datetime' i.e. ignoring the time zone.
+func (s *simulator) SetTime(deviceID uint32, datetime time.Time) (*types.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	t := datetime
+	local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+
+	c.drift = time.Until(local).Round(time.Second)
+
+	return &types.Time{
+		SerialNumber: types.SerialNumber(deviceID),
+		DateTime:     types.DateTime(local),
+	}, nil
+}
+
+func (s *simulator) GetTimeProfile(deviceID uint32, profileID uint8) (*types.TimeProfile, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile, ok := c.profiles[profileID]; ok {
+		return &profile, nil
+	}
+
+	return nil, nil
+}
+
+func (s *simulator) SetTimeProfile(deviceID uint32, profile types.TimeProfile) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	if c.profiles == nil {
+		c.profiles = map[uint8]types.TimeProfile{}
+	}
+
+	c.profiles[profile.ID] = profile
+
+	return true, nil
+}
+
+// Returns the door control state, defaulting to 'controlled' with a 5 second delay.
+func (s *simulator) GetDoorControlState(deviceID uint32, door byte) (*types.DoorControlState, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if state, ok := c.modes[door]; ok {
+		return &state, nil
+	}
+
+	return &types.DoorControlState{
+		SerialNumber: types.SerialNumber(deviceID),
+		Door:         door,
+		ControlState: types.Controlled,
+		Delay:        5,
+	}, nil
+}
+
+func (s *simulator) SetDoorControlState(deviceID uint32, door uint8, state types.ControlState, delay uint8) (*types.DoorControlState, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.modes == nil {
+		c.modes = map[uint8]types.DoorControlState{}
+	}
+
+	c.modes[door] = types.DoorControlState{
+		SerialNumber: types.SerialNumber(deviceID),
+		Door:         door,
+		ControlState: state,
+		Delay:        delay,
+	}
+
+	v := c.modes[door]
+
+	return &v, nil
+}
+
+func (s *simulator) ActivateKeypads(deviceID uint32, readers map[uint8]bool) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	c.keypads = map[uint8]bool{}
+	for k, v := range readers {
+		c.keypads[k] = v
+	}
+
+	return true, nil
+}
+
+func (s *simulator) ClearTaskList(deviceID uint32) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	c.tasks = nil
+	c.pending = nil
+
+	return true, nil
+}
+
+func (s *simulator) AddTask(deviceID uint32, task types.Task) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	c.pending = append(c.pending, task)
+
+	return true, nil
+}
+
+func (s *simulator) RefreshTaskList(deviceID uint32) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	c.tasks = append(c.tasks, c.pending...)
+	c.pending = nil
+
+	return true, nil
+}
+
+func (s *simulator) GetEvent(deviceID, index uint32) (*types.Event, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.controller(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.events) == 0 {
+		return nil, nil
+	}
+
+	switch index {
+	case 0:
+		event := c.events[0]
+		return &event, nil
+
+	case 0xffffffff:
+		event := c.events[len(c.events)-1]
+		return &event, nil
+	}
+
+	for _, e := range c.events {
+		if e.Index == index {
+			event := e
+			return &event, nil
+		}
+	}
+
+	if index < c.events[0].Index {
+		return nil, fmt.Errorf("event %v overwritten", index)
+	}
+
+	return nil, nil
+}
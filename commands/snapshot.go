@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// Snapshot of the cards on the controllers, saved by load-acl before updating the controllers so that
+// the update can be reverted with the 'rollback' command. Saved as JSON rather than TSV because the
+// TSV format masks the card PINs.
+type snapshot struct {
+	Timestamp   time.Time               `json:"timestamp"`
+	Controllers map[uint32][]types.Card `json:"controllers"`
+}
+
+const SNAPSHOT_PREFIX = "acl-"
+const SNAPSHOT_SUFFIX = ".json"
+
+// Returns the directory for the load-acl ACL snapshots.
+func (cmd *LoadACL) snapshotDir() string {
+	return filepath.Join(cmd.workdir, "snapshots")
+}
+
+// Saves the ACL as a timestamped snapshot in dir and deletes all but the most recent 'keep' snapshots.
+func saveSnapshot(dir string, acl lib.ACL, keep int) (string, error) {
+	now := time.Now()
+	s := snapshot{
+		Timestamp:   now,
+		Controllers: map[uint32][]types.Card{},
+	}
+
+	for id, cards := range acl {
+		list := slices.Collect(maps.Values(cards))
+		sort.Slice(list, func(i, j int) bool { return list[i].CardNumber < list[j].CardNumber })
+
+		s.Controllers[id] = list
+	}
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, SNAPSHOT_PREFIX+now.Format("20060102-150405.000")+SNAPSHOT_SUFFIX)
+
+	if bytes, err := json.MarshalIndent(s, "", "  "); err != nil {
+		return "", err
+	} else if err := os.WriteFile(file, bytes, 0660); err != nil {
+		return "", err
+	}
+
+	if snapshots, err := listSnapshots(dir); err != nil {
+		return file, err
+	} else if len(snapshots) > keep {
+		for _, f := range snapshots[:len(snapshots)-keep] {
+			if err := os.Remove(f); err != nil {
+				warnf("Error deleting ACL snapshot %v (%v)", f, err)
+			}
+		}
+	}
+
+	return file, nil
+}
+
+// Returns the ACL snapshots in dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshots := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, SNAPSHOT_PREFIX) && strings.HasSuffix(name, SNAPSHOT_SUFFIX) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+
+	sort.Strings(snapshots)
+
+	return snapshots, nil
+}
+
+func loadSnapshot(file string) (*snapshot, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := snapshot{}
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		return nil, fmt.Errorf("invalid ACL snapshot %v (%v)", file, err)
+	}
+
+	if s.Controllers == nil {
+		return nil, fmt.Errorf("invalid ACL snapshot %v (no controllers)", file)
+	}
+
+	return &s, nil
+}
+
+func (s snapshot) acl() lib.ACL {
+	acl := lib.ACL{}
+	for id, cards := range s.Controllers {
+		acl[id] = map[uint32]types.Card{}
+		for _, card := range cards {
+			acl[id][card.CardNumber] = card
+		}
+	}
+
+	return acl
+}
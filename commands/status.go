@@ -0,0 +1,289 @@
+package commands
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var StatusCmd = Status{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config: config.DefaultConfig,
+	area:   "Status!A1:M",
+}
+
+type Status struct {
+	command
+	config string
+	area   string
+}
+
+var statusHeader = []any{
+	"Controller",
+	"Name",
+	"Status",
+	"IP Address",
+	"Firmware",
+	"Date/Time",
+	"Drift",
+	"Doors",
+	"Buttons",
+	"Relays",
+	"Inputs",
+	"Last Event",
+	"Cards",
+}
+
+func (cmd *Status) Name() string {
+	return "status"
+}
+
+func (cmd *Status) Description() string {
+	return "Writes the status of a set of configured UHPPOTE access controllers to a Google Sheets worksheet"
+}
+
+func (cmd *Status) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *Status) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration file>] status [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Retrieves the IP address, firmware version, clock drift, door, relay and input states, last event index and number of")
+	fmt.Println("  cards from each configured controller and writes a one row per controller dashboard to a Google Sheets worksheet.")
+	fmt.Println("  Controllers that do not respond are flagged as UNREACHABLE.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets status --credentials "credentials.json" \`)
+	fmt.Println(`                              --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                              --range "Status!A1:M"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets status --file "site.ods"`)
+	fmt.Println()
+}
+
+func (cmd *Status) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("status")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range for the status dashboard e.g. 'Status!A1:M'")
+
+	return flagset
+}
+
+func (cmd *Status) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	if match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(cmd.area); len(match) < 5 {
+		return fmt.Errorf("invalid range '%s' - expected something like 'Status!A1:M", cmd.area)
+	}
+
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), cmd.area)
+	}
+
+	devices = slices.Clone(devices)
+	slices.SortFunc(devices, func(p, q uhppote.Device) int {
+		return cmp.Compare(p.DeviceID, q.DeviceID)
+	})
+
+	status, _ := forEach(ctx, devices, func(d uhppote.Device) ([]any, error) {
+		return cmd.status(u, d), nil
+	})
+
+	if ctx.Err() != nil {
+		return cmd.cancelled(ctx, true, "")
+	}
+
+	rows := [][]any{}
+	for _, d := range devices {
+		rows = append(rows, status[d.DeviceID])
+	}
+
+	return cmd.write(backend, rows)
+}
+
+// Retrieves the controller status as a dashboard row. A controller that does not respond to
+// get-device is flagged as UNREACHABLE and a controller that responds to get-device but fails
+// any subsequent request is flagged as ERROR. The clock drift is the difference between the controller
+// wall clock time and the current time in the controller time zone (as for set-time).
+func (cmd *Status) status(u uhppote.IUHPPOTE, d uhppote.Device) []any {
+	row := make([]any, len(statusHeader))
+	for i := range row {
+		row[i] = ""
+	}
+
+	row[0] = fmt.Sprintf("%v", d.DeviceID)
+	row[1] = d.Name
+
+	device, err := u.GetDevice(d.DeviceID)
+	if err != nil || device == nil {
+		warnf("%v  unreachable (%v)", d.DeviceID, err)
+		row[2] = "UNREACHABLE"
+		return row
+	}
+
+	row[2] = "OK"
+	row[3] = fmt.Sprintf("%v", device.IpAddress)
+	row[4] = fmt.Sprintf("%v", device.Version)
+
+	if status, err := u.GetStatus(d.DeviceID); err != nil || status == nil {
+		warnf("%v  error retrieving controller status (%v)", d.DeviceID, err)
+		row[2] = "ERROR"
+	} else {
+		datetime := time.Time(status.SystemDateTime)
+		drift := wallClock(datetime).Sub(wallClock(time.Now().In(timezone(d))))
+
+		row[5] = datetime.Format("2006-01-02 15:04:05")
+		row[6] = fmt.Sprintf("%+ds", int(drift.Seconds()))
+		row[7] = states(status.DoorState, "open", "closed")
+		row[8] = states(status.DoorButton, "pressed", "released")
+		row[9] = states(bits(status.RelayState), "unlocked", "locked")
+		row[10] = inputs(status.InputState)
+		row[11] = fmt.Sprintf("%v", status.Event.Index)
+	}
+
+	if cards, err := u.GetCards(d.DeviceID); err != nil {
+		warnf("%v  error retrieving number of cards (%v)", d.DeviceID, err)
+		row[2] = "ERROR"
+	} else {
+		row[12] = fmt.Sprintf("%v", cards)
+	}
+
+	return row
+}
+
+func (cmd *Status) write(backend Backend, rows [][]any) error {
+	match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(cmd.area)
+	name := match[1]
+	left := match[2]
+	top, _ := strconv.Atoi(match[3])
+	right := match[4]
+
+	format := report{
+		top:     int64(top),
+		left:    left,
+		title:   fmt.Sprintf("%v!%v%v:%v%v", name, left, top, left, top),
+		headers: fmt.Sprintf("%v!%v%v:%v%v", name, left, top+1, right, top+1),
+		data:    fmt.Sprintf("%v!%v%v:%v", name, left, top+2, right),
+	}
+
+	// ... clear existing dashboard
+	infof("Clearing existing status from worksheet")
+	if err := backend.Clear(format.title, format.headers, format.data); err != nil {
+		return err
+	}
+
+	// ... write dashboard
+	infof("Writing status to worksheet")
+
+	var timestamp = valueRange{
+		area: format.title,
+		values: [][]any{
+			[]any{
+				time.Now().Format("2006-01-02 15:04:05"),
+			},
+		},
+	}
+
+	var headers = valueRange{
+		area:   format.headers,
+		values: [][]any{statusHeader},
+	}
+
+	var values = valueRange{
+		area:   format.data,
+		values: rows,
+	}
+
+	if err := backend.Write(timestamp, headers, values); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Formats a set of door states as e.g. '1:closed 2:open 3:closed 4:closed'.
+func states(m map[uint8]bool, on, off string) string {
+	list := []string{}
+	for _, door := range []uint8{1, 2, 3, 4} {
+		if v, ok := m[door]; ok && v {
+			list = append(list, fmt.Sprintf("%v:%v", door, on))
+		} else if ok {
+			list = append(list, fmt.Sprintf("%v:%v", door, off))
+		}
+	}
+
+	return strings.Join(list, " ")
+}
+
+// Unpacks the relay state bitmask into per-door relay states.
+func bits(v uint8) map[uint8]bool {
+	return map[uint8]bool{
+		1: v&0x01 != 0,
+		2: v&0x02 != 0,
+		3: v&0x04 != 0,
+		4: v&0x08 != 0,
+	}
+}
+
+// Formats the controller input state (force lock and fire alarm).
+func inputs(v uint8) string {
+	list := []string{}
+	if v&0x01 != 0 {
+		list = append(list, "force-lock")
+	}
+
+	if v&0x02 != 0 {
+		list = append(list, "fire-alarm")
+	}
+
+	if len(list) == 0 {
+		return "-"
+	}
+
+	return strings.Join(list, " ")
+}
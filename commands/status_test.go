@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func TestStatus(t *testing.T) {
+	worksheets := testWorksheets()
+	worksheets["Status"] = [][]any{
+		[]any{"2020-01-01 00:00:00"},
+		[]any{"Old", "Header"},
+		[]any{"12345", "old row"},
+		[]any{"67890", "old row"},
+		[]any{"24680", "old row"},
+	}
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].drift = 90 * time.Second
+	controllers[405419896].modes = map[uint8]types.DoorControlState{
+		2: types.DoorControlState{Door: 2, ControlState: types.NormallyOpen, Delay: 5},
+	}
+	controllers[405419896].events = []types.Event{
+		types.Event{SerialNumber: 405419896, Index: 1},
+		types.Event{SerialNumber: 405419896, Index: 2},
+	}
+	controllers[303986753].offline = true
+
+	sim := newSimulator(controllers)
+
+	cmd := Status{
+		command: fake.command(t, sim),
+		area:    "Status!A1:M",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing status (%v)", err)
+	}
+
+	rows := fake.values("Status")
+	if len(rows) != 4 {
+		t.Fatalf("Incorrect number of status rows - expected:%v, got:%v (%v)", 4, len(rows), rows)
+	}
+
+	if timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", rows[0][0].(string), time.Local); err != nil {
+		t.Errorf("Invalid status timestamp %v (%v)", rows[0], err)
+	} else if time.Since(timestamp) > time.Minute {
+		t.Errorf("Incorrect status timestamp %v", timestamp)
+	}
+
+	if !reflect.DeepEqual(rows[1], statusHeader) {
+		t.Errorf("Incorrect status header\n   expected:%v\n   got:     %v", statusHeader, rows[1])
+	}
+
+	expected := [][]any{
+		[]any{"303986753", "D303986753", "UNREACHABLE"},
+		[]any{"405419896", "D405419896", "OK", "192.168.1.100", "v8.92", "", "+90s", "1:closed 2:open 3:closed 4:closed", "1:released 2:released 3:released 4:released", "1:locked 2:unlocked 3:locked 4:locked", "-", "2", "3"},
+	}
+
+	// ... controller date/time is not deterministic
+	if len(rows[3]) > 5 {
+		rows[3][5] = ""
+	}
+
+	if !reflect.DeepEqual(rows[2:], expected) {
+		t.Errorf("Incorrect status\n   expected:%v\n   got:     %v", expected, rows[2:])
+	}
+}
+
+// The controller clock is set to the wall clock time in the controller time zone, so the drift is
+// compared in the controller time zone rather than the host time zone.
+func TestStatusWithControllerTimeZone(t *testing.T) {
+	tz, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("Error loading time zone (%v)", err)
+	}
+
+	now := time.Now()
+	_, offset := now.In(tz).Zone()
+	_, local := now.Zone()
+
+	worksheets := testWorksheets()
+	worksheets["Status"] = [][]any{}
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].timezone = "Asia/Tokyo"
+	controllers[405419896].drift = time.Duration(offset-local)*time.Second + 30*time.Second
+
+	sim := newSimulator(controllers)
+
+	cmd := Status{
+		command: fake.command(t, sim),
+		area:    "Status!A1:M",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing status (%v)", err)
+	}
+
+	rows := fake.values("Status")
+	if len(rows) != 4 || len(rows[3]) < 7 {
+		t.Fatalf("Incorrect status rows %v", rows)
+	}
+
+	if drift := rows[3][6]; drift != "+30s" && drift != "+29s" && drift != "+31s" {
+		t.Errorf("Incorrect drift - expected:%v, got:%v", "+30s", drift)
+	}
+}
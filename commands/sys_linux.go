@@ -0,0 +1,13 @@
+package commands
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Returns true if the process exists (signal 0 checks for the process without signalling it).
+func running(pid int) bool {
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -1,8 +1,10 @@
 package commands
 
 import (
-	"golang.org/x/sys/windows"
+	"errors"
 	"path/filepath"
+
+	"golang.org/x/sys/windows"
 )
 
 func workdir() string {
@@ -13,3 +15,24 @@ func workdir() string {
 
 	return filepath.Join(programData, "uhppoted")
 }
+
+// Returns true if the process exists and has not exited. A process that cannot be opened is only regarded
+// as not running if the PID does not exist (ERROR_INVALID_PARAMETER) - any other error (in particular
+// ERROR_ACCESS_DENIED for a process owned by another user or a service) is assumed to be a live process.
+func running(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+		return false
+	} else if err != nil {
+		return true
+	}
+
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+
+	return code == 259 // STILL_ACTIVE
+}
@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"path"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	api "github.com/uhppoted/uhppoted-lib/acl"
@@ -89,8 +94,8 @@ func makeTable(rows [][]any) (*api.Table, error) {
 		for _, h := range header {
 			k := normalise(h)
 			v := ""
-			if ix, ok := index[k]; ok {
-				v = row[ix].(string)
+			if ix, ok := index[k]; ok && ix < len(row) {
+				v, _ = row[ix].(string)
 			}
 
 			record = append(record, clean(v))
@@ -104,3 +109,298 @@ func makeTable(rows [][]any) (*api.Table, error) {
 		Records: records,
 	}, nil
 }
+
+// Worksheet range of an ACL, either specified explicitly or matched by a worksheet name pattern.
+type aclRange struct {
+	area    string
+	sheet   string
+	matched bool
+}
+
+// Expands an ACL --range option into the worksheet ranges. The option is a comma separated list of ranges
+// (e.g. 'Staff!A2:K,Students!A2:K') in which the worksheet name may be a pattern (e.g. '*!A2:K' or 'ACL*!A2:K')
+// that matches the worksheet names. A worksheet is only included once, even if it matches more than one range.
+func aclRanges(backend Backend, spec string) ([]aclRange, error) {
+	ranges := []aclRange{}
+	seen := map[string]bool{}
+
+	var sheets []string
+	var err error
+
+	for _, a := range strings.Split(spec, ",") {
+		a = strings.TrimSpace(a)
+		match := regexp.MustCompile(`^(.+?)!(.*)$`).FindStringSubmatch(a)
+		if len(match) < 3 {
+			return nil, fmt.Errorf("invalid range '%s' - expected something like 'ACL!A2:K", a)
+		}
+
+		name := strings.TrimSpace(match[1])
+		cells := match[2]
+
+		if !strings.ContainsAny(name, "*?[") {
+			if !seen[normalise(name)] {
+				seen[normalise(name)] = true
+				ranges = append(ranges, aclRange{area: a, sheet: name})
+			}
+
+			continue
+		}
+
+		if sheets == nil {
+			if sheets, err = backend.Sheets(); err != nil {
+				return nil, fmt.Errorf("unable to retrieve worksheets (%v)", err)
+			}
+		}
+
+		matched := false
+		for _, sheet := range sheets {
+			if ok, err := path.Match(strings.ToLower(name), strings.ToLower(sheet)); err != nil {
+				return nil, fmt.Errorf("invalid range '%s' (%v)", a, err)
+			} else if ok {
+				matched = true
+
+				if !seen[normalise(sheet)] {
+					seen[normalise(sheet)] = true
+					ranges = append(ranges, aclRange{area: fmt.Sprintf("%v!%v", sheet, cells), sheet: sheet, matched: true})
+				}
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("no worksheets match range '%s'", a)
+		}
+	}
+
+	return ranges, nil
+}
+
+// Reads the ACL ranges (expanding the groups, if any) and resolves the time profile names, returning the
+// ACL table and the worksheet(s) from which each card was taken. The groups and time profiles ranges are
+// optional.
+func getACLTable(backend Backend, area, groupsRange, profilesRange string) (*api.Table, map[uint32]string, error) {
+	var list groups
+
+	if groupsRange != "" {
+		if g, err := getGroups(backend, groupsRange); err != nil {
+			return nil, nil, err
+		} else {
+			list = g
+		}
+	}
+
+	table, sources, err := readACL(backend, area, list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if profilesRange != "" {
+		if profiles, err := getTimeProfiles(backend, profilesRange); err != nil {
+			return nil, nil, err
+		} else if err := profiles.resolve(table); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return table, sources, nil
+}
+
+// Reads the ACL ranges and merges the worksheets into a single table (via makeTable) with the union of the
+// worksheet columns. The groups (if not nil) are expanded on each worksheet with the merged columns, so that
+// a group permission also applies to a door that is only on another worksheet, and any door that is still
+// blank and not on the worksheet is then 'N' (no access). A card that is listed on more than one worksheet
+// with the same record is only included once, but conflicting records are retained (and so handled as
+// duplicate card numbers when the ACL is parsed) with a warning that identifies the worksheets.
+// Worksheets matched by a pattern that do not contain an ACL (e.g. the Log worksheet) are ignored.
+//
+// Returns the merged table and the worksheet(s) from which each card was taken.
+func readACL(backend Backend, spec string, list groups) (*api.Table, map[uint32]string, error) {
+	ranges, err := aclRanges(backend, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type worksheet struct {
+		name  string
+		table *api.Table
+	}
+
+	worksheets := []worksheet{}
+
+	for _, r := range ranges {
+		values, err := backend.Read(r.area)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to retrieve data from sheet '%v' (%v)", r.sheet, err)
+		}
+
+		if len(values) == 0 && r.matched {
+			debugf("Ignoring worksheet '%v' (no data)", r.sheet)
+			continue
+		} else if len(values) == 0 {
+			return nil, nil, fmt.Errorf("no data in spreadsheet/range '%v'", r.area)
+		}
+
+		table, err := makeTable(values)
+		if err != nil && r.matched {
+			debugf("Ignoring worksheet '%v' (%v)", r.sheet, err)
+			continue
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("error creating table from worksheet '%v' (%v)", r.sheet, err)
+		}
+
+		worksheets = append(worksheets, worksheet{r.sheet, table})
+	}
+
+	if len(worksheets) == 0 {
+		return nil, nil, fmt.Errorf("no ACL worksheets match range '%v'", spec)
+	}
+
+	// ... merge headers
+	header := []string{}
+	columns := map[string]int{}
+
+	for _, w := range worksheets {
+		for _, h := range w.table.Header {
+			if k := normalise(h); k == "" {
+				continue
+			} else if _, ok := columns[k]; !ok {
+				columns[k] = len(header)
+				header = append(header, h)
+			}
+		}
+	}
+
+	doors := []int{}
+	for _, ix := range doorColumns(header) {
+		if normalise(header[ix]) != "group" {
+			doors = append(doors, ix)
+		}
+	}
+
+	// ... merge records
+	type first struct {
+		sheet string
+		row   []any
+	}
+
+	rows := [][]any{}
+	titles := []any{}
+	cards := map[string]first{}
+	sources := map[uint32]string{}
+
+	for _, w := range worksheets {
+		aligned := api.Table{
+			Header:  slices.Clone(header),
+			Records: [][]string{},
+		}
+
+		absent := []map[string]bool{}
+
+		for _, record := range w.table.Records {
+			row := make([]string, len(header))
+			present := map[int]bool{}
+
+			for i, h := range w.table.Header {
+				if ix, ok := columns[normalise(h)]; ok && i < len(record) {
+					row[ix] = record[i]
+					present[ix] = true
+				}
+			}
+
+			missing := map[string]bool{}
+			for _, ix := range doors {
+				if !present[ix] {
+					missing[normalise(header[ix])] = true
+				}
+			}
+
+			aligned.Records = append(aligned.Records, row)
+			absent = append(absent, missing)
+		}
+
+		// ... expand the groups before defaulting the doors that are not on the worksheet to 'N' (no access), so
+		//     that a group permission applies to a door that is only on another worksheet
+		if list != nil {
+			if err := list.expand(&aligned); err != nil {
+				return nil, nil, fmt.Errorf("worksheet '%v' %v", w.name, err)
+			}
+		}
+
+		for i, record := range aligned.Records {
+			row := []any{}
+			for ix, v := range record {
+				if v == "" && absent[i][normalise(aligned.Header[ix])] {
+					row = append(row, "N")
+				} else {
+					row = append(row, v)
+				}
+			}
+
+			cardnumber := record[0]
+			card, _ := strconv.ParseUint(cardnumber, 10, 32)
+
+			if f, ok := cards[cardnumber]; !ok {
+				cards[cardnumber] = first{w.name, row}
+				sources[uint32(card)] = w.name
+			} else if f.sheet != w.name {
+				if sameRecord(f.row, row) {
+					debugf("card %v: ignoring duplicate record on worksheet '%v' (same as '%v')", cardnumber, w.name, f.sheet)
+					continue
+				}
+
+				warnf("card %v: conflicting records on worksheets '%v' and '%v'", cardnumber, f.sheet, w.name)
+
+				if source := sources[uint32(card)]; !slices.Contains(strings.Split(source, ", "), w.name) {
+					sources[uint32(card)] = source + ", " + w.name
+				}
+			}
+
+			rows = append(rows, row)
+		}
+
+		// ... the same for every worksheet (less the Group column, if expanded)
+		titles = titles[:0]
+		for _, h := range aligned.Header {
+			titles = append(titles, h)
+		}
+	}
+
+	rows = append([][]any{titles}, rows...)
+
+	table, err := makeTable(rows)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating table from worksheets (%v)", err)
+	}
+
+	return table, sources, nil
+}
+
+// Returns true if two merged ACL rows are the same, treating a blank cell as 'N' (i.e. no access).
+func sameRecord(p, q []any) bool {
+	f := func(v any) string {
+		if s := normalise(fmt.Sprintf("%v", v)); s != "" {
+			return s
+		}
+
+		return "n"
+	}
+
+	for i := range p {
+		if f(p[i]) != f(q[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns a hash of the normalised ACL table, for detecting changes to the ACL independently of changes
+// to the rest of the spreadsheet.
+func hashTable(table *api.Table) (string, error) {
+	hash := sha256.New()
+
+	if err := table.ToTSV(hash); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
 	api "github.com/uhppoted/uhppoted-lib/acl"
 )
 
@@ -220,3 +222,172 @@ func TestMakeTableWithInvalidToDate(t *testing.T) {
 		t.Errorf("Incorrect table\n   expected: %v\n   got:      %v\n", expected, *table)
 	}
 }
+
+func testACLWorksheets() *memory {
+	return &memory{
+		sheets: map[string][][]any{
+			"Staff": [][]any{
+				[]any{"Card Number", "From", "To", "Gate", "Tower"},
+				[]any{"6001001", "2020-01-01", "2020-12-31", "Y", "N"},
+				[]any{"6001002", "2020-01-01", "2020-12-31", "Y", "N"},
+			},
+			"Students": [][]any{
+				[]any{"Card Number", "From", "To", "Gate", "Dungeon"},
+				[]any{"6001002", "2020-01-01", "2020-12-31", "Y", "N"},
+				[]any{"6001003", "2020-01-01", "2020-12-31", "N", "Y"},
+			},
+			"Contractors": [][]any{
+				[]any{"Card Number", "From", "To", "Tower"},
+				[]any{"6001001", "2020-01-01", "2020-12-31", "Y"},
+			},
+			"Log": [][]any{
+				[]any{"Timestamp", "Device ID", "Unchanged"},
+			},
+		},
+	}
+}
+
+func TestACLRanges(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []aclRange
+	}{
+		{"Staff!A1:E", []aclRange{{"Staff!A1:E", "Staff", false}}},
+		{"Staff!A1:E, Students!A1:E", []aclRange{{"Staff!A1:E", "Staff", false}, {"Students!A1:E", "Students", false}}},
+		{"S*!A1:E", []aclRange{{"Staff!A1:E", "Staff", true}, {"Students!A1:E", "Students", true}}},
+		{"Staff!A1:E,s*!A1:E", []aclRange{{"Staff!A1:E", "Staff", false}, {"Students!A1:E", "Students", true}}},
+	}
+
+	for _, test := range tests {
+		ranges, err := aclRanges(testACLWorksheets(), test.spec)
+		if err != nil {
+			t.Fatalf("%v: unexpected error (%v)", test.spec, err)
+		}
+
+		if !reflect.DeepEqual(ranges, test.expected) {
+			t.Errorf("%v: incorrect ranges\n   expected:%v\n   got:     %v", test.spec, test.expected, ranges)
+		}
+	}
+
+	if _, err := aclRanges(testACLWorksheets(), "Visitors*!A1:E"); err == nil {
+		t.Errorf("Expected error for range pattern that does not match any worksheets")
+	}
+}
+
+func TestReadACL(t *testing.T) {
+	expected := api.Table{
+		Header: []string{"Card Number", "From", "To", "Gate", "Tower", "Dungeon"},
+		Records: [][]string{
+			{"6001001", "2020-01-01", "2020-12-31", "Y", "N", "N"},
+			{"6001002", "2020-01-01", "2020-12-31", "Y", "N", "N"},
+			{"6001003", "2020-01-01", "2020-12-31", "N", "N", "Y"},
+			{"6001001", "2020-01-01", "2020-12-31", "N", "Y", "N"},
+		},
+	}
+
+	table, sources, err := readACL(testACLWorksheets(), "Staff!A1:E,Students!A1:E,Contractors!A1:D", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error reading ACL (%v)", err)
+	}
+
+	// ... 6001002 is the same on Staff and Students but 6001001 conflicts on Staff and Contractors
+	if !reflect.DeepEqual(*table, expected) {
+		t.Errorf("Incorrect table\n   expected:%v\n   got:     %v", expected, *table)
+	}
+
+	sourced := map[uint32]string{
+		6001001: "Staff, Contractors",
+		6001002: "Staff",
+		6001003: "Students",
+	}
+
+	if !reflect.DeepEqual(sources, sourced) {
+		t.Errorf("Incorrect sources\n   expected:%v\n   got:     %v", sourced, sources)
+	}
+}
+
+func TestReadACLWithDifferentDoors(t *testing.T) {
+	devices := []uhppote.Device{
+		uhppote.Device{DeviceID: 405419896, Doors: []string{"Gate", "Tower", "Dungeon", ""}},
+	}
+
+	// ... Staff has no Dungeon column and Students has no Tower column
+	table, _, err := readACL(testACLWorksheets(), "Staff!A1:E,Students!A1:E", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error reading ACL (%v)", err)
+	}
+
+	cmd := LoadACL{}
+	list, warnings, err := cmd.parseTable(table, devices)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing merged ACL (%v)", err)
+	} else if len(warnings) > 0 {
+		t.Errorf("Unexpected warnings parsing merged ACL (%v)", warnings)
+	}
+
+	expected := api.ACL{
+		405419896: map[uint32]types.Card{
+			6001001: *mkcard(6001001, "2020-01-01", "2020-12-31", 1, 0, 0, 0),
+			6001002: *mkcard(6001002, "2020-01-01", "2020-12-31", 1, 0, 0, 0),
+			6001003: *mkcard(6001003, "2020-01-01", "2020-12-31", 0, 0, 1, 0),
+		},
+	}
+
+	if !reflect.DeepEqual(*list, expected) {
+		t.Errorf("Incorrect ACL\n   expected:%v\n   got:     %v", expected, *list)
+	}
+}
+
+func TestReadACLWithGroups(t *testing.T) {
+	backend := testACLWorksheets()
+	backend.sheets["Students"] = [][]any{
+		[]any{"Card Number", "From", "To", "Group", "Gate", "Dungeon"},
+		[]any{"6001003", "2020-01-01", "2020-12-31", "Students", "", "N"},
+		[]any{"6001004", "2020-01-01", "2020-12-31", "", "Y", "Y"},
+	}
+
+	backend.sheets["Groups"] = [][]any{
+		[]any{"Group", "Gate", "Tower", "Dungeon"},
+		[]any{"Students", "N", "Y", "Y"},
+	}
+
+	// ... Tower is only on the Staff worksheet but is granted by the Students group
+	expected := api.Table{
+		Header: []string{"Card Number", "From", "To", "Gate", "Tower", "Dungeon"},
+		Records: [][]string{
+			{"6001001", "2020-01-01", "2020-12-31", "Y", "N", "N"},
+			{"6001002", "2020-01-01", "2020-12-31", "Y", "N", "N"},
+			{"6001003", "2020-01-01", "2020-12-31", "N", "Y", "N"},
+			{"6001004", "2020-01-01", "2020-12-31", "Y", "N", "Y"},
+		},
+	}
+
+	table, _, err := getACLTable(backend, "Staff!A1:E,Students!A1:F", "Groups!A1:D", "")
+	if err != nil {
+		t.Fatalf("Unexpected error reading ACL (%v)", err)
+	}
+
+	if !reflect.DeepEqual(*table, expected) {
+		t.Errorf("Incorrect table\n   expected:%v\n   got:     %v", expected, *table)
+	}
+}
+
+func TestReadACLWithPattern(t *testing.T) {
+	table, sources, err := readACL(testACLWorksheets(), "*!A1:E", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error reading ACL (%v)", err)
+	}
+
+	// ... Log worksheet is not an ACL and should be ignored
+	if len(table.Records) != 4 {
+		t.Errorf("Incorrect number of records - expected:%v, got:%v", 4, len(table.Records))
+	}
+
+	if len(sources) != 3 {
+		t.Errorf("Incorrect sources %v", sources)
+	}
+
+	if _, _, err := readACL(testACLWorksheets(), "Log!A1:C", nil); err == nil {
+		t.Errorf("Expected error reading ACL from explicit non-ACL range")
+	}
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// Time profile names defined on the TimeProfiles worksheet, used to resolve ACL door cells that
+// specify a time profile by name rather than by ID.
+type timeProfiles struct {
+	ids   map[string]uint8
+	names map[uint8]string
+}
+
+// Reads the time profile IDs and names from the 'Profile ID' and 'Name' columns of the time profiles
+// worksheet.
+func getTimeProfiles(backend Backend, area string) (*timeProfiles, error) {
+	values, err := backend.Read(area)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve time profiles from sheet (%v)", err)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no data in time profiles spreadsheet/range")
+	}
+
+	index, _ := buildIndex(values[:1], []string{"profileid", "name"})
+	if _, ok := index["profileid"]; !ok {
+		return nil, fmt.Errorf("missing 'Profile ID' column in time profiles worksheet")
+	}
+
+	if _, ok := index["name"]; !ok {
+		return nil, fmt.Errorf("missing 'Name' column in time profiles worksheet")
+	}
+
+	profiles := timeProfiles{
+		ids:   map[string]uint8{},
+		names: map[uint8]string{},
+	}
+
+	for row, record := range values[1:] {
+		id := clean(value(record, index["profileid"]))
+		name := clean(value(record, index["name"]))
+
+		if id == "" {
+			continue
+		}
+
+		v, err := strconv.ParseUint(id, 10, 8)
+		if err != nil || v < 2 || v > 254 {
+			return nil, fmt.Errorf("time profiles row %v: invalid profile ID '%v' (valid profiles are in the interval [2..254])", row+2, id)
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if isPermission(name) {
+			return nil, fmt.Errorf("time profiles row %v: invalid profile name '%v'", row+2, name)
+		}
+
+		if other, ok := profiles.ids[normalise(name)]; ok && other != uint8(v) {
+			return nil, fmt.Errorf("time profiles row %v: duplicate profile name '%v'", row+2, name)
+		}
+
+		profiles.ids[normalise(name)] = uint8(v)
+		profiles.names[uint8(v)] = name
+	}
+
+	return &profiles, nil
+}
+
+// Replaces time profile names in the table door columns with the profile ID.
+func (p *timeProfiles) resolve(table *lib.Table) error {
+	for _, ix := range doorColumns(table.Header) {
+		for row, record := range table.Records {
+			if ix >= len(record) {
+				continue
+			}
+
+			if v := clean(record[ix]); v != "" && !isPermission(v) {
+				if id, ok := p.ids[normalise(v)]; !ok {
+					return fmt.Errorf("row %v: unknown time profile '%v' for door %v", row+1, v, table.Header[ix])
+				} else {
+					record[ix] = fmt.Sprintf("%v", id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Replaces time profile IDs in the table door columns with the profile name (if the profile has a name).
+func (p *timeProfiles) rename(table *lib.Table) {
+	for _, ix := range doorColumns(table.Header) {
+		for _, record := range table.Records {
+			if ix >= len(record) {
+				continue
+			}
+
+			if id, err := strconv.ParseUint(clean(record[ix]), 10, 8); err == nil {
+				if name, ok := p.names[uint8(id)]; ok {
+					record[ix] = name
+				}
+			}
+		}
+	}
+}
+
+// Returns the indices of the door columns i.e. every column other than the card number, from, to and PIN.
+func doorColumns(header []string) []int {
+	columns := []int{}
+	for i, h := range header {
+		switch normalise(h) {
+		case "cardnumber", "from", "to", "pin":
+		default:
+			columns = append(columns, i)
+		}
+	}
+
+	return columns
+}
+
+// Returns true if the door cell is a Y/N permission or a numeric time profile ID.
+func isPermission(v string) bool {
+	return v == "Y" || v == "N" || regexp.MustCompile(`^[0-9]+$`).MatchString(v)
+}
+
+func value(record []any, ix int) string {
+	if ix < len(record) {
+		return fmt.Sprintf("%v", record[ix])
+	}
+
+	return ""
+}
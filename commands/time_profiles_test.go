@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func testTimeProfiles() [][]any {
+	return [][]any{
+		[]any{"Profile ID", "Name"},
+		[]any{"29", "Weekdays 8-6"},
+		[]any{"30", "Weekends"},
+		[]any{"31", ""},
+	}
+}
+
+func TestLoadACLWithTimeProfiles(t *testing.T) {
+	worksheets := testWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "weekdays 8-6", "N", "Y", "N"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "29", "N", "Weekends"},
+	)
+	worksheets["TimeProfiles"] = testTimeProfiles()
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].profiles = map[uint8]types.TimeProfile{29: types.TimeProfile{ID: 29}}
+	controllers[303986753].profiles = map[uint8]types.TimeProfile{30: types.TimeProfile{ID: 30}}
+	sim := newSimulator(controllers)
+
+	cmd := testLoadACL(fake, sim, t)
+	cmd.timeProfiles = "TimeProfiles!A1:B"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing load-acl (%v)", err)
+	}
+
+	checkCards(t, sim, 405419896,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 29, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 1, 29, 0, 0))
+
+	checkCards(t, sim, 303986753,
+		mkcard(6001001, "2023-01-01", "2023-12-31", 1, 0, 0, 0),
+		mkcard(6001002, "2023-01-01", "2023-12-31", 0, 30, 0, 0))
+}
+
+func TestLoadACLWithUnknownTimeProfile(t *testing.T) {
+	worksheets := testWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Weekdays 9-5", "N", "Y", "N"},
+	)
+	worksheets["TimeProfiles"] = testTimeProfiles()
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	sim := newSimulator(controllers)
+
+	cmd := testLoadACL(fake, sim, t)
+	cmd.timeProfiles = "TimeProfiles!A1:B"
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing load-acl with unknown time profile")
+	}
+
+	checkCards(t, sim, 405419896, controllers[405419896].cards...)
+}
+
+func TestUploadACLWithTimeProfiles(t *testing.T) {
+	worksheets := testWorksheets()
+	worksheets["TimeProfiles"] = testTimeProfiles()
+	worksheets["Uploaded"] = [][]any{
+		[]any{"2020-01-01 00:00:00"},
+		[]any{"Card Number", "From", "To", "Front Door", "Side Door", "Garage", "Workshop", "Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+	}
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].cards[1].Doors[2] = 29
+	controllers[405419896].cards[2].Doors[4] = 31
+	sim := newSimulator(controllers)
+
+	cmd := UploadACL{
+		command:      fake.command(t, sim),
+		acl:          "Uploaded!A1:K",
+		timeProfiles: "TimeProfiles!A1:B",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing upload-acl (%v)", err)
+	}
+
+	expected := [][]any{
+		[]any{"Card Number", "From", "To", "Front Door", "Side Door", "Garage", "Workshop", "Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+		[]any{"6001001", "2023-01-01", "2023-12-31", "Y", "N", "N", "N", "N", "N", "N", "N"},
+		[]any{"6001002", "2023-01-01", "2023-12-31", "Y", "Weekdays 8-6", "N", "N", "N", "N", "N", "N"},
+		[]any{"6001003", "2023-01-01", "2023-12-31", "Y", "Y", "Y", "31", "N", "N", "N", "N"},
+	}
+
+	rows := fake.values("Uploaded")
+	if len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect uploaded ACL\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestCompareACLWithTimeProfiles(t *testing.T) {
+	worksheets := testWorksheets(
+		[]any{"6001001", "", "2023-01-01", "2023-12-31", "Y", "N", "N", "N"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "Weekdays 8-6", "N", "N"},
+		[]any{"6001003", "", "2023-01-01", "2023-12-31", "Y", "Y", "N", "N"},
+	)
+	worksheets["TimeProfiles"] = testTimeProfiles()
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].cards[1].Doors[2] = 29
+	controllers[405419896].cards[2].Doors = map[uint8]uint8{1: 1, 2: 1, 3: 0, 4: 0}
+	sim := newSimulator(controllers)
+
+	cmd := CompareACL{
+		command:      fake.command(t, sim),
+		acl:          "ACL!A1:H",
+		report:       "Audit!A1:D",
+		timeProfiles: "TimeProfiles!A1:B",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing compare-acl (%v)", err)
+	}
+
+	// ... 405419896 is unchanged (profile 29 resolved from 'Weekdays 8-6')
+	expected := [][]any{
+		[]any{"Device", "Updated", "Added", "Deleted"},
+		[]any{"303986753", "-", "6001002", "-"},
+		[]any{"", "", "6001003"},
+		[]any{},
+		[]any{"405419896", "-", "-", "-"},
+	}
+
+	if rows := fake.values("Audit"); len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect compare report\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestGetTimeProfilesWithInvalidProfiles(t *testing.T) {
+	tests := [][][]any{
+		{{"ID", "Name"}, {"29", "Weekdays"}},
+		{{"Profile ID", "Name"}, {"1", "Weekdays"}},
+		{{"Profile ID", "Name"}, {"255", "Weekdays"}},
+		{{"Profile ID", "Name"}, {"29", "Weekdays"}, {"30", "weekdays"}},
+		{{"Profile ID", "Name"}, {"29", "Y"}},
+		{{"Profile ID", "Name"}, {"29", "100"}},
+	}
+
+	for _, test := range tests {
+		_, google := newFakeGoogle(t, map[string][][]any{"TimeProfiles": test})
+
+		if _, err := getTimeProfiles(google, "TimeProfiles!A1:B"); err == nil {
+			t.Errorf("Expected error for invalid time profiles %v", test)
+		}
+	}
+}
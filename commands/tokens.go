@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+var TokensCmd = Tokens{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	newKey: "",
+}
+
+type Tokens struct {
+	command
+	subcommand string
+	newKey     string
+}
+
+func (cmd *Tokens) Name() string {
+	return "tokens"
+}
+
+func (cmd *Tokens) Description() string {
+	return "Manages the stored Google Sheets and Google Drive authorisation tokens"
+}
+
+func (cmd *Tokens) Usage() string {
+	return "rotate --new-key <file>"
+}
+
+func (cmd *Tokens) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] tokens rotate [options] --new-key <file>\n", APP)
+	fmt.Println()
+	fmt.Println("  Re-encrypts the authorisation token files in the tokens directory with a new key. The current key is the --token-key")
+	fmt.Println("  file (or the " + TOKEN_KEY + " environment variable) - unencrypted token files are encrypted with the")
+	fmt.Println("  new key. The token files are only rewritten if all of them can be decrypted with the current key.")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets tokens rotate --token-key "/etc/uhppoted/sheets/token.key" --new-key "/etc/uhppoted/sheets/token.key.new"`)
+	fmt.Println()
+}
+
+func (cmd *Tokens) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("tokens")
+
+	flagset.StringVar(&cmd.newKey, "new-key", cmd.newKey, "File containing the new key for the authorisation tokens")
+
+	return flagset
+}
+
+func (cmd *Tokens) ParseCmd(args ...string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("missing 'tokens' subcommand - expected 'rotate'")
+	}
+
+	cmd.subcommand = args[0]
+
+	return cmd.FlagSet().Parse(args[1:])
+}
+
+func (cmd *Tokens) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.debug = options.Debug
+
+	switch cmd.subcommand {
+	case "rotate":
+		return cmd.rotate()
+
+	default:
+		return fmt.Errorf("invalid 'tokens' subcommand '%v' - expected 'rotate'", cmd.subcommand)
+	}
+}
+
+func (cmd *Tokens) rotate() error {
+	if strings.TrimSpace(cmd.newKey) == "" {
+		return fmt.Errorf("--new-key is a required option")
+	}
+
+	key, err := tokenKey(cmd.tokenKey)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := tokenKey(cmd.newKey)
+	if err != nil {
+		return err
+	} else if newKey == nil {
+		return fmt.Errorf("new token key %v is empty", cmd.newKey)
+	}
+
+	dir := cmd.tokenDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read tokens directory %v (%v)", dir, err)
+	}
+
+	// ... decrypt everything before rewriting anything
+	tokens := map[string]*oauth2.Token{}
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && slices.Contains([]string{".sheets", ".drive", ".tokens"}, ext) {
+			file := filepath.Join(dir, entry.Name())
+			if token, err := tokenFromFile(file, key); err != nil {
+				return err
+			} else {
+				tokens[file] = token
+			}
+		}
+	}
+
+	if len(tokens) == 0 {
+		return fmt.Errorf("no token files in %v", dir)
+	}
+
+	rotated := []string{}
+	for _, file := range slices.Sorted(maps.Keys(tokens)) {
+		if err := writeToken(file, tokens[file], newKey); err != nil {
+			if len(rotated) > 0 {
+				warnf("Re-encrypted %v with the new token key - the remaining token files are unchanged", strings.Join(rotated, ", "))
+			}
+
+			return fmt.Errorf("error writing %v (%v)", file, err)
+		}
+
+		infof("Re-encrypted %v", file)
+		rotated = append(rotated, file)
+	}
+
+	infof("Re-encrypted %v token files - update the token key to %v", len(tokens), cmd.newKey)
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Writes a token key file.
+func mkkey(t *testing.T, key string) string {
+	file := filepath.Join(t.TempDir(), "token.key")
+
+	if err := os.WriteFile(file, []byte(key+"\n"), 0600); err != nil {
+		t.Fatalf("Error creating token key file (%v)", err)
+	}
+
+	return file
+}
+
+func TestEncryptedToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials.sheets")
+	key, _ := tokenKey(mkkey(t, "qwerty-uiop"))
+	other, _ := tokenKey(mkkey(t, "asdf-ghjkl"))
+
+	token := oauth2.Token{
+		AccessToken:  fakeAccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: "fake-refresh-token",
+		Expiry:       time.Date(2026, time.January, 2, 12, 34, 56, 0, time.UTC),
+	}
+
+	if err := writeToken(file, &token, key); err != nil {
+		t.Fatalf("Unexpected error writing encrypted token (%v)", err)
+	}
+
+	if bytes, err := os.ReadFile(file); err != nil {
+		t.Fatalf("Unexpected error reading encrypted token file (%v)", err)
+	} else if strings.Contains(string(bytes), "fake-refresh-token") {
+		t.Errorf("Token file is not encrypted\n%s", string(bytes))
+	}
+
+	if v, err := tokenFromFile(file, key); err != nil {
+		t.Errorf("Unexpected error reading encrypted token (%v)", err)
+	} else if !reflect.DeepEqual(*v, token) {
+		t.Errorf("Incorrect token\n   expected:%v\n   got:     %v", token, *v)
+	}
+
+	if _, err := tokenFromFile(file, nil); err == nil {
+		t.Errorf("Expected error reading encrypted token without key")
+	}
+
+	if _, err := tokenFromFile(file, other); err == nil {
+		t.Errorf("Expected error reading encrypted token with incorrect key")
+	}
+}
+
+func TestEncryptedTokenSalt(t *testing.T) {
+	key, _ := tokenKey(mkkey(t, "qwerty-uiop"))
+
+	p, err := encrypt([]byte(fakeAccessToken), key)
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting token (%v)", err)
+	}
+
+	q, err := encrypt([]byte(fakeAccessToken), key)
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting token (%v)", err)
+	}
+
+	if p.KDF.Algorithm != "scrypt" || len(p.KDF.Salt) != SCRYPT_SALT {
+		t.Errorf("Incorrect key derivation function %+v", p.KDF)
+	}
+
+	if reflect.DeepEqual(p.KDF.Salt, q.KDF.Salt) {
+		t.Errorf("Expected a random salt for each encrypted token")
+	}
+
+	if v, err := decrypt(*q, key); err != nil {
+		t.Errorf("Unexpected error decrypting token (%v)", err)
+	} else if string(v) != fakeAccessToken {
+		t.Errorf("Incorrect decrypted token - expected:%v, got:%v", fakeAccessToken, string(v))
+	}
+
+	q.KDF.Salt = p.KDF.Salt
+	if _, err := decrypt(*q, key); err == nil {
+		t.Errorf("Expected error decrypting token with incorrect salt")
+	}
+}
+
+func TestEncryptedTokenWithInvalidKDF(t *testing.T) {
+	key, _ := tokenKey(mkkey(t, "qwerty-uiop"))
+
+	token, err := encrypt([]byte(fakeAccessToken), key)
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting token (%v)", err)
+	}
+
+	tests := map[string]kdf{
+		"N too small": {N: 2, R: SCRYPT_R, P: SCRYPT_P},
+		"N too large": {N: 1 << 30, R: SCRYPT_R, P: SCRYPT_P},
+		"N not 2^n":   {N: 32767, R: SCRYPT_R, P: SCRYPT_P},
+		"r too large": {N: SCRYPT_N, R: 1 << 20, P: SCRYPT_P},
+		"p too large": {N: SCRYPT_N, R: SCRYPT_R, P: 1 << 20},
+		"r zero":      {N: SCRYPT_N, R: 0, P: SCRYPT_P},
+		"p negative":  {N: SCRYPT_N, R: SCRYPT_R, P: -1},
+	}
+
+	for k, v := range tests {
+		envelope := *token
+		envelope.KDF.N = v.N
+		envelope.KDF.R = v.R
+		envelope.KDF.P = v.P
+
+		if _, err := decrypt(envelope, key); err == nil || !strings.Contains(err.Error(), "invalid key derivation parameters") {
+			t.Errorf("%v: expected invalid key derivation parameters error, got %v", k, err)
+		}
+	}
+}
+
+func TestTokenKeyFromEnvironment(t *testing.T) {
+	t.Setenv(TOKEN_KEY, "qwerty-uiop")
+
+	expected, _ := tokenKey(mkkey(t, "qwerty-uiop"))
+
+	if key, err := tokenKey(""); err != nil {
+		t.Fatalf("Unexpected error (%v)", err)
+	} else if !reflect.DeepEqual(key, expected) {
+		t.Errorf("Incorrect token key from environment\n   expected:%v\n   got:     %v", expected, key)
+	}
+}
+
+func TestGetCommandWithEncryptedTokens(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{
+		"ACL": [][]any{
+			[]any{"Card Number", "From", "To", "Great Hall"},
+		},
+	})
+
+	credentials, tokens := fake.authorise(t)
+	keyfile := mkkey(t, "qwerty-uiop")
+
+	rotate := Tokens{
+		command: command{
+			tokens: tokens,
+		},
+		subcommand: "rotate",
+		newKey:     keyfile,
+	}
+
+	if err := rotate.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error encrypting tokens (%v)", err)
+	}
+
+	cmd := Get{
+		command: command{
+			workdir:     t.TempDir(),
+			credentials: credentials,
+			tokens:      tokens,
+			url:         fakeSpreadsheetURL,
+			endpoint:    fake.url,
+		},
+		area: "ACL!A1:D",
+		file: filepath.Join(t.TempDir(), "acl.tsv"),
+	}
+
+	if err := cmd.Execute(&Options{}); err == nil {
+		t.Errorf("Expected error executing 'get' command with encrypted tokens and no token key")
+	}
+
+	cmd.tokenKey = keyfile
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Errorf("Unexpected error executing 'get' command with encrypted tokens (%v)", err)
+	}
+}
+
+func TestTokensRotate(t *testing.T) {
+	fake, _ := newFakeGoogle(t, map[string][][]any{})
+	_, tokens := fake.authorise(t)
+
+	key1 := mkkey(t, "qwerty-uiop")
+	key2 := mkkey(t, "asdf-ghjkl")
+
+	cmd := Tokens{
+		command: command{
+			tokens:   tokens,
+			tokenKey: key1,
+		},
+		subcommand: "rotate",
+		newKey:     key2,
+	}
+
+	// ... tokens are not encrypted with key1
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error rotating unencrypted tokens (%v)", err)
+	}
+
+	// ... tokens are now encrypted with key2
+	if err := cmd.Execute(&Options{}); err == nil {
+		t.Errorf("Expected error rotating tokens with incorrect key")
+	}
+
+	cmd.tokenKey = key2
+	cmd.newKey = key1
+
+	if err := cmd.Execute(&Options{}); err != nil {
+		t.Fatalf("Unexpected error rotating tokens (%v)", err)
+	}
+
+	key, _ := tokenKey(key1)
+	for _, file := range []string{"credentials.sheets", "credentials.drive"} {
+		if token, err := tokenFromFile(filepath.Join(tokens, file), key); err != nil {
+			t.Errorf("Error reading %v (%v)", file, err)
+		} else if token.AccessToken != fakeAccessToken {
+			t.Errorf("Incorrect %v token\n   expected:%v\n   got:     %v", file, fakeAccessToken, token.AccessToken)
+		}
+	}
+
+	// ... token files are replaced atomically, without leaving any temporary files
+	if files, err := filepath.Glob(filepath.Join(tokens, "*.tmp")); err != nil || len(files) > 0 {
+		t.Errorf("Unexpected temporary files %v (%v)", files, err)
+	}
+}
+
+func TestTokensParseCmd(t *testing.T) {
+	cmd := Tokens{}
+
+	if err := cmd.ParseCmd("rotate", "--new-key", "token.key"); err != nil {
+		t.Fatalf("Unexpected error parsing 'tokens' command (%v)", err)
+	} else if cmd.subcommand != "rotate" || cmd.newKey != "token.key" {
+		t.Errorf("Incorrectly parsed 'tokens' command - subcommand:%v  new-key:%v", cmd.subcommand, cmd.newKey)
+	}
+
+	if err := (&Tokens{}).ParseCmd("--new-key", "token.key"); err == nil {
+		t.Errorf("Expected error parsing 'tokens' command without subcommand")
+	}
+}
@@ -142,7 +142,7 @@ func sheetToTSV(f io.Writer, data *sheets.ValueRange, withPIN bool) error {
 	return nil
 }
 
-func tsvToSheet(f io.Reader, area string) (*sheets.ValueRange, *sheets.ValueRange, error) {
+func tsvToSheet(f io.Reader, area string) (*valueRange, *valueRange, error) {
 	match := regexp.MustCompile(`(.+?)!([a-zA-Z]+)([0-9]+):([a-zA-Z]+)([0-9]+)?`).FindStringSubmatch(area)
 	if len(match) < 5 {
 		return nil, nil, fmt.Errorf("invalid spreadsheet range '%s'", area)
@@ -176,9 +176,9 @@ func tsvToSheet(f io.Reader, area string) (*sheets.ValueRange, *sheets.ValueRang
 		h[i] = fmt.Sprintf("%v", v)
 	}
 
-	header := sheets.ValueRange{
-		Range:  fmt.Sprintf("%s!%s%v:%s%v", name, left, top, right, top),
-		Values: [][]any{h},
+	header := valueRange{
+		area:   fmt.Sprintf("%s!%s%v:%s%v", name, left, top, right, top),
+		values: [][]any{h},
 	}
 
 	// data
@@ -194,9 +194,9 @@ func tsvToSheet(f io.Reader, area string) (*sheets.ValueRange, *sheets.ValueRang
 		rows = append(rows, row)
 	}
 
-	data := sheets.ValueRange{
-		Range:  fmt.Sprintf("%s!%s%v:%s", name, left, top+1, right),
-		Values: rows,
+	data := valueRange{
+		area:   fmt.Sprintf("%s!%s%v:%s", name, left, top+1, right),
+		values: rows,
 	}
 
 	return &header, &data, nil
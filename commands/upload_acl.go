@@ -4,15 +4,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"google.golang.org/api/option"
-	"google.golang.org/api/sheets/v4"
-
 	"github.com/uhppoted/uhppote-core/uhppote"
 	api "github.com/uhppoted/uhppoted-lib/acl"
 	"github.com/uhppoted/uhppoted-lib/config"
@@ -24,18 +20,24 @@ var UploadACLCmd = UploadACL{
 		credentials: DEFAULT_CREDENTIALS,
 		tokens:      "",
 		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
 		debug:       false,
 	},
 
 	config: config.DefaultConfig,
 	acl:    "",
+
+	lockMaxAge: 2 * time.Hour,
 }
 
 type UploadACL struct {
 	command
-	config  string
-	acl     string
-	withPIN bool
+	config       string
+	acl          string
+	timeProfiles string
+	withPIN      bool
+	lockMaxAge   time.Duration
 }
 
 func (cmd *UploadACL) Name() string {
@@ -47,7 +49,7 @@ func (cmd *UploadACL) Description() string {
 }
 
 func (cmd *UploadACL) Usage() string {
-	return "--credentials <file> --url <url>"
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
 }
 
 func (cmd *UploadACL) Help() {
@@ -69,13 +71,18 @@ func (cmd *UploadACL) Help() {
 	fmt.Println(`                                                               --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
 	fmt.Println(`                                                               --range "Uploaded!A2:E" \`)
 	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets upload-acl --file "site.xlsx" --range "Uploaded!A2:E"`)
+	fmt.Println()
 }
 
 func (cmd *UploadACL) FlagSet() *flag.FlagSet {
 	flagset := cmd.flagset("upload-acl")
 
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
 	flagset.StringVar(&cmd.acl, "range", cmd.acl, "Spreadsheet range e.g. 'Uploaded!A2:E'")
+	flagset.StringVar(&cmd.timeProfiles, "time-profiles", cmd.timeProfiles, "Spreadsheet range of the time profiles worksheet for uploading door time profiles by name e.g. 'TimeProfiles!A1:B'")
 	flagset.BoolVar(&cmd.withPIN, "with-pin", cmd.withPIN, "Includes the card keypad PIN codes in the uploaded ACL file")
+	flagset.DurationVar(&cmd.lockMaxAge, "lock-max-age", cmd.lockMaxAge, "Age after which a lockfile from another host that has not been refreshed is regarded as stale and reclaimed (0 to never reclaim)")
 
 	return flagset
 }
@@ -96,42 +103,26 @@ func (cmd *UploadACL) Execute(args ...any) error {
 		return fmt.Errorf("WARN  Could not load configuration (%v)", err)
 	}
 
-	u, devices := getDevices(conf, cmd.debug)
-
-	match := regexp.MustCompile(`^https://docs.google.com/spreadsheets/d/(.*?)(?:/.*)?$`).FindStringSubmatch(strings.TrimSpace(cmd.url))
-	if len(match) < 2 {
-		return fmt.Errorf("invalid spreadsheet URL - expected something like 'https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms'")
-	}
-
-	spreadsheetId := match[1]
-
-	if cmd.debug {
-		debugf("Spreadsheet - ID:%s  range:%s", spreadsheetId, cmd.acl)
-	}
-
-	// ... authorise
-	tokens := cmd.tokens
-	if tokens == "" {
-		tokens = filepath.Join(cmd.workdir, ".google")
-	}
+	u, devices := cmd.controllers(conf)
 
-	client, err := authorize(cmd.credentials, SHEETS, tokens)
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
 	if err != nil {
-		//lint:ignore ST1005 Google should be capitalized
-		return fmt.Errorf("Google Sheets authentication/authorization error (%w)", err)
+		return err
 	}
 
-	google, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return fmt.Errorf("unable to create new Google Sheets client (%w)", err)
+	// ... locked?
+	if lock, err := cmd.lock(backend, cmd.acl, cmd.lockMaxAge); err != nil {
+		return err
+	} else {
+		defer lock.release()
 	}
 
-	spreadsheet, err := getSpreadsheet(google, spreadsheetId)
-	if err != nil {
-		return err
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), cmd.acl)
 	}
 
-	acl, err := cmd.get(u, devices)
+	acl, err := cmd.get(ctx, u, devices)
 	if err != nil {
 		return err
 	}
@@ -144,9 +135,20 @@ func (cmd *UploadACL) Execute(args ...any) error {
 		}
 	}
 
-	if table, err := f(acl, devices); err != nil {
+	table, err := f(acl, devices)
+	if err != nil {
 		return err
-	} else if err := cmd.upload(google, spreadsheet, table); err != nil {
+	}
+
+	if cmd.timeProfiles != "" {
+		if profiles, err := getTimeProfiles(backend, cmd.timeProfiles); err != nil {
+			return err
+		} else {
+			profiles.rename(table)
+		}
+	}
+
+	if err := cmd.upload(backend, table); err != nil {
 		return err
 	}
 
@@ -154,12 +156,8 @@ func (cmd *UploadACL) Execute(args ...any) error {
 }
 
 func (c *UploadACL) validate() error {
-	if strings.TrimSpace(c.credentials) == "" {
-		return fmt.Errorf("--credentials is a required option")
-	}
-
-	if strings.TrimSpace(c.url) == "" {
-		return fmt.Errorf("--url is a required option")
+	if err := c.validateSpreadsheet(); err != nil {
+		return err
 	}
 
 	if strings.TrimSpace(c.acl) == "" {
@@ -170,51 +168,46 @@ func (c *UploadACL) validate() error {
 		return fmt.Errorf("invalid range '%s' - expected something like 'Current!A2:K", c.acl)
 	}
 
+	if c.timeProfiles != "" {
+		if match := regexp.MustCompile(`(.+?)!.*`).FindStringSubmatch(strings.TrimSpace(c.timeProfiles)); len(match) < 2 {
+			return fmt.Errorf("invalid time-profiles range '%s' - expected something like 'TimeProfiles!A1:B", c.timeProfiles)
+		}
+	}
+
+	if c.lockMaxAge < 0 {
+		return fmt.Errorf("invalid --lock-max-age '%v' - expected a positive duration", c.lockMaxAge)
+	}
+
 	return nil
 }
 
-func (c *UploadACL) get(u uhppote.IUHPPOTE, devices []uhppote.Device) (api.ACL, error) {
-	current, errors := api.GetACL(u, devices)
-	if len(errors) > 0 {
-		return nil, fmt.Errorf("%v", errors)
+func (c *UploadACL) get(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device) (api.ACL, error) {
+	current, errors := workers{}.getACL(ctx, u, devices)
+	if ctx.Err() != nil {
+		return nil, c.cancelled(ctx, true, "")
+	} else if len(errors) > 0 {
+		return nil, fmt.Errorf("%v", joinErrors(errors))
 	}
 
 	return current, nil
 }
 
-func (c *UploadACL) upload(google *sheets.Service, spreadsheet *sheets.Spreadsheet, table *api.Table) error {
-	sheet, err := getSheet(spreadsheet, c.acl)
-	if err != nil {
-		return err
-	}
-
-	format, err := c.buildFormat(google, spreadsheet, table)
+func (c *UploadACL) upload(backend Backend, table *api.Table) error {
+	format, err := c.buildFormat(backend, table)
 	if err != nil {
 		return err
 	}
 
 	// ... clear existing ACL
 	infof("Clearing existing ACL from worksheet")
-	if err := clear(google, spreadsheet, []string{format.title, format.data}); err != nil {
+	if err := backend.Clear(format.title, format.data); err != nil {
 		return err
 	}
 
-	if sheet.Properties.GridProperties.RowCount > format.top+24 {
-		prune := sheets.BatchUpdateSpreadsheetRequest{
-			Requests: []*sheets.Request{
-				&sheets.Request{
-					DeleteDimension: &sheets.DeleteDimensionRequest{
-						Range: &sheets.DimensionRange{
-							SheetId:    sheet.Properties.SheetId,
-							Dimension:  "ROWS",
-							StartIndex: int64(format.top + 24),
-						},
-					},
-				},
-			},
-		}
-
-		if _, err := google.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &prune).Do(); err != nil {
+	if rows, err := backend.RowCount(c.acl); err != nil {
+		return err
+	} else if rows > format.top+24 {
+		if err := backend.DeleteRows(c.acl, rowRange{start: format.top + 24}); err != nil {
 			return fmt.Errorf("error pruning report worksheet (%w)", err)
 		}
 	}
@@ -222,18 +215,18 @@ func (c *UploadACL) upload(google *sheets.Service, spreadsheet *sheets.Spreadshe
 	// ... upload ACL
 	infof("Uploading ACL to worksheet")
 
-	var timestamp = sheets.ValueRange{
-		Range: format.title,
-		Values: [][]any{
+	var timestamp = valueRange{
+		area: format.title,
+		values: [][]any{
 			[]any{
 				time.Now().Format("2006-01-02 15:04:05"),
 			},
 		},
 	}
 
-	var values = sheets.ValueRange{
-		Range:  format.data,
-		Values: [][]any{},
+	var values = valueRange{
+		area:   format.data,
+		values: [][]any{},
 	}
 
 	cols := 0
@@ -255,42 +248,31 @@ func (c *UploadACL) upload(google *sheets.Service, spreadsheet *sheets.Spreadshe
 			}
 		}
 
-		values.Values = append(values.Values, row)
+		values.values = append(values.values, row)
 	}
 
-	rq := sheets.BatchUpdateValuesRequest{
-		ValueInputOption: "USER_ENTERED",
-		Data:             []*sheets.ValueRange{&timestamp, &values},
-	}
-
-	if _, err := google.Spreadsheets.Values.BatchUpdate(spreadsheet.SpreadsheetId, &rq).Do(); err != nil {
+	if err := backend.Write(timestamp, values); err != nil {
 		return err
 	}
 
 	// ... pad
 
-	var pad = sheets.ValueRange{
-		Values: [][]any{[]any{""}},
-	}
+	var pad = [][]any{[]any{""}}
 
-	if _, err := google.Spreadsheets.Values.Append(spreadsheet.SpreadsheetId, c.acl, &pad).
-		ValueInputOption("USER_ENTERED").
-		InsertDataOption("OVERWRITE").
-		Do(); err != nil {
+	if err := backend.Append(c.acl, pad, true); err != nil {
 		return fmt.Errorf("error padding report worksheet (%w)", err)
 	}
 
 	return nil
 }
 
-func (c *UploadACL) buildFormat(google *sheets.Service, spreadsheet *sheets.Spreadsheet, table *api.Table) (*report, error) {
-	response, err := google.Spreadsheets.Values.Get(spreadsheet.SpreadsheetId, c.acl).Do()
+func (c *UploadACL) buildFormat(backend Backend, table *api.Table) (*report, error) {
+	rows, err := backend.Read(c.acl)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve data from upload sheet (%v)", err)
 	}
 
 	columns := map[int]int{}
-	rows := response.Values
 	if len(rows) > 1 {
 		header := rows[1]
 		for i, col := range table.Header {
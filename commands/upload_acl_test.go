@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/uhppoted/uhppote-core/types"
+)
+
+func TestUploadACL(t *testing.T) {
+	worksheets := testWorksheets()
+	worksheets["Uploaded"] = [][]any{
+		[]any{"2020-01-01 00:00:00"},
+		[]any{"Card Number", "PIN", "From", "To", "Front Door", "Side Door", "Garage", "Workshop", "Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+		[]any{"6001009", "", "2020-01-01", "2020-12-31", "Y", "Y", "Y", "Y", "Y", "Y", "Y", "Y"},
+	}
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[405419896].cards[0].PIN = types.PIN(7531)
+	sim := newSimulator(controllers)
+
+	cmd := UploadACL{
+		command: fake.command(t, sim),
+		acl:     "Uploaded!A1:L",
+		withPIN: true,
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err != nil {
+		t.Fatalf("Unexpected error executing upload-acl (%v)", err)
+	}
+
+	// ... PINs are masked in the uploaded ACL
+	expected := [][]any{
+		[]any{"Card Number", "PIN", "From", "To", "Front Door", "Side Door", "Garage", "Workshop", "Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+		[]any{"6001001", "****", "2023-01-01", "2023-12-31", "Y", "N", "N", "N", "N", "N", "N", "N"},
+		[]any{"6001002", "", "2023-01-01", "2023-12-31", "Y", "Y", "N", "N", "N", "N", "N", "N"},
+		[]any{"6001003", "", "2023-01-01", "2023-12-31", "Y", "Y", "Y", "Y", "N", "N", "N", "N"},
+	}
+
+	rows := fake.values("Uploaded")
+	if len(rows) == 0 || !reflect.DeepEqual(rows[1:], expected) {
+		t.Errorf("Incorrect uploaded ACL\n   expected:%v\n   got:     %v", expected, rows)
+	}
+}
+
+func TestUploadACLWithOfflineController(t *testing.T) {
+	worksheets := testWorksheets()
+	worksheets["Uploaded"] = [][]any{
+		[]any{"2020-01-01 00:00:00"},
+		[]any{"Card Number", "From", "To", "Front Door", "Side Door", "Garage", "Workshop", "Great Hall", "Kitchen", "Dungeon", "Hogsmeade"},
+	}
+
+	fake, _ := newFakeGoogle(t, worksheets)
+	controllers := testControllers()
+	controllers[303986753].offline = true
+	sim := newSimulator(controllers)
+
+	cmd := UploadACL{
+		command: fake.command(t, sim),
+		acl:     "Uploaded!A1:K",
+	}
+
+	if err := cmd.Execute(&Options{Config: sim.config(t)}); err == nil {
+		t.Fatalf("Expected error executing upload-acl with offline controller")
+	}
+
+	if rows := fake.values("Uploaded"); rows[0][0] != "2020-01-01 00:00:00" {
+		t.Errorf("Unexpected update to 'Uploaded' worksheet %v", rows)
+	}
+}
@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+	"github.com/uhppoted/uhppoted-lib/config"
+)
+
+var UploadDoorsCmd = UploadDoors{
+	command: command{
+		workdir:     DEFAULT_WORKDIR,
+		credentials: DEFAULT_CREDENTIALS,
+		tokens:      "",
+		url:         "",
+		apiRetries:  5,
+		apiBudget:   60,
+		debug:       false,
+	},
+
+	config: config.DefaultConfig,
+	area:   "Doors!A1:E",
+}
+
+type UploadDoors struct {
+	command
+	config string
+	area   string
+}
+
+func (cmd *UploadDoors) Name() string {
+	return "upload-doors"
+}
+
+func (cmd *UploadDoors) Description() string {
+	return "Uploads the door settings from a set of configured UHPPOTE access controllers to a Google Sheets worksheet"
+}
+
+func (cmd *UploadDoors) Usage() string {
+	return "--credentials <file> --url <url> | --file <spreadsheet>"
+}
+
+func (cmd *UploadDoors) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s [--debug] [--config <configuration>] upload-doors [options] --url <URL> --range <range>\n", APP)
+	fmt.Println()
+	fmt.Println("  Uploads the door control mode, unlock delay and keypad settings for the doors in the configuration file to a Google")
+	fmt.Println("  Sheets worksheet, replacing the existing contents of the range. The keypad settings cannot be retrieved from the")
+	fmt.Println("  controllers and are the settings last applied by load-doors (blank if unknown).")
+	fmt.Println()
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println()
+	fmt.Println("  Examples:")
+	fmt.Println(`    uhppote-app-sheets upload-doors --credentials "credentials.json" \`)
+	fmt.Println(`                                    --url "https://docs.google.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms" \`)
+	fmt.Println(`                                    --range "Doors!A1:E"`)
+	fmt.Println()
+	fmt.Println(`    uhppote-app-sheets upload-doors --file "site.xlsx"`)
+	fmt.Println()
+}
+
+func (cmd *UploadDoors) FlagSet() *flag.FlagSet {
+	flagset := cmd.flagset("upload-doors")
+
+	flagset.StringVar(&cmd.workbook, "file", cmd.workbook, "Local XLSX or ODS spreadsheet file (alternative to --url)")
+	flagset.StringVar(&cmd.area, "range", cmd.area, "Spreadsheet range for the door settings e.g. 'Doors!A1:E'")
+
+	return flagset
+}
+
+func (cmd *UploadDoors) Execute(args ...any) error {
+	options := args[0].(*Options)
+
+	cmd.config = options.Config
+	cmd.debug = options.Debug
+
+	// ... check parameters
+	if err := cmd.validateSpreadsheet(); err != nil {
+		return err
+	}
+
+	r, err := parseArea(cmd.area)
+	if err != nil {
+		return fmt.Errorf("invalid range '%s' - expected something like 'Doors!A1:E", cmd.area)
+	}
+
+	conf := config.NewConfig()
+	if err := conf.Load(cmd.config); err != nil {
+		return fmt.Errorf("could not load configuration (%v)", err)
+	}
+
+	u, devices := cmd.controllers(conf)
+
+	ctx := options.context()
+	backend, err := cmd.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.debug {
+		debugf("Spreadsheet - ID:%s  range:%s", backend.ID(), cmd.area)
+	}
+
+	file := keypadsFile(cmd.workdir)
+	applied := keypads{}
+	if err := applied.load(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading keypad settings from %s (%v)", file, err)
+	}
+
+	rows := [][]any{
+		[]any{"Door", "Controller", "Mode", "Delay", "Keypad"},
+	}
+
+	if list, err := cmd.get(ctx, u, devices, applied); err != nil {
+		return err
+	} else {
+		rows = append(rows, list...)
+	}
+
+	infof("Clearing existing doors from worksheet")
+	if err := backend.Clear(cmd.area); err != nil {
+		return err
+	}
+
+	infof("Uploading %v doors to worksheet", len(rows)-1)
+
+	values := valueRange{
+		area:   fmt.Sprintf("%s!%s%v:%s%v", r.sheet, columnName(r.left), r.top+1, columnName(r.left+4), r.top+len(rows)),
+		values: rows,
+	}
+
+	if err := backend.Write(values); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the door settings for the configured doors. The mode and delay are left blank for doors
+// on controllers that could not be retrieved.
+func (cmd *UploadDoors) get(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device, applied keypads) ([][]any, error) {
+	devices = slices.Clone(devices)
+	slices.SortFunc(devices, func(p, q uhppote.Device) int {
+		return cmp.Compare(p.DeviceID, q.DeviceID)
+	})
+
+	doors, _ := forEach(ctx, devices, func(d uhppote.Device) ([][]any, error) {
+		return cmd.doors(u, d, applied[d.DeviceID]), nil
+	})
+
+	if ctx.Err() != nil {
+		return nil, cmd.cancelled(ctx, true, "")
+	}
+
+	rows := [][]any{}
+	for _, d := range devices {
+		rows = append(rows, doors[d.DeviceID]...)
+	}
+
+	return rows, nil
+}
+
+// Retrieves the door settings for a controller as worksheet rows. Doors without a name are skipped.
+func (cmd *UploadDoors) doors(u uhppote.IUHPPOTE, d uhppote.Device, keypads map[uint8]bool) [][]any {
+	rows := [][]any{}
+
+	for i, name := range d.Doors {
+		if name == "" {
+			continue
+		}
+
+		door := uint8(i + 1)
+		row := []any{name, fmt.Sprintf("%v", d.DeviceID), "", "", ""}
+
+		if state, err := u.GetDoorControlState(d.DeviceID, door); err != nil {
+			warnf("%v  door %v: %v", d.DeviceID, door, err)
+		} else if state != nil {
+			row[2] = fmt.Sprintf("%v", state.ControlState)
+			row[3] = fmt.Sprintf("%v", state.Delay)
+		}
+
+		if v, ok := keypads[door]; ok && v {
+			row[4] = "Y"
+		} else if ok {
+			row[4] = "N"
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,490 @@
+package commands
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	lib "github.com/uhppoted/uhppoted-lib/os"
+)
+
+// Backend implementation for a local XLSX or ODS spreadsheet file. The workbook is loaded in
+// its entirety and rewritten after every update. Only the worksheets that have been modified
+// are re-encoded - everything else in the file is preserved as is.
+type workbook struct {
+	file    string
+	codec   codec
+	entries []*zip.FileHeader
+	content map[string][]byte
+	sheets  []*worksheet
+}
+
+// Decodes/encodes the worksheets for a spreadsheet file format.
+type codec interface {
+	decode(content map[string][]byte) ([]*worksheet, error)
+	encode(content map[string][]byte, sheets []*worksheet) error
+}
+
+type worksheet struct {
+	name  string
+	rows  [][]cell
+	dirty bool
+}
+
+type cell struct {
+	value   string
+	numeric bool
+	style   string
+}
+
+type area struct {
+	sheet  string
+	top    int
+	left   int
+	bottom int
+	right  int
+}
+
+// Numeric string values (which Google Sheets stores as numbers for USER_ENTERED input) and spreadsheet
+// ranges in A1 notation, compiled once since they are matched for every cell/range.
+var (
+	numericValue = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	a1Notation   = regexp.MustCompile(`^\s*(.+?)!\$?([a-zA-Z]+)\$?([0-9]+)(?::\$?([a-zA-Z]+)\$?([0-9]+)?)?\s*$`)
+)
+
+func newWorkbook(file string) (*workbook, error) {
+	var c codec
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".xlsx":
+		c = &xlsx{}
+
+	case ".ods":
+		c = &ods{}
+
+	default:
+		return nil, fmt.Errorf("unsupported spreadsheet file '%v' - expected an .xlsx or .ods file", file)
+	}
+
+	w := workbook{
+		file:  file,
+		codec: c,
+	}
+
+	if err := w.load(); err != nil {
+		return nil, fmt.Errorf("error reading spreadsheet file %v (%w)", file, err)
+	}
+
+	return &w, nil
+}
+
+func (w *workbook) ID() string {
+	_, file := filepath.Split(w.file)
+
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+func (w *workbook) Read(area string) ([][]any, error) {
+	r, sheet, err := w.lookup(area)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]any{}
+	for i := r.top; i <= r.bottom && i < len(sheet.rows); i++ {
+		row := []any{}
+		for j := r.left; j <= r.right && j < len(sheet.rows[i]); j++ {
+			row = append(row, sheet.rows[i][j].value)
+		}
+
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+
+		rows = append(rows, row)
+	}
+
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	return rows, nil
+}
+
+func (w *workbook) Write(data ...valueRange) error {
+	for _, v := range data {
+		r, sheet, err := w.lookup(v.area)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range v.values {
+			for j, value := range row {
+				sheet.set(r.top+i, r.left+j, value)
+			}
+		}
+	}
+
+	return w.save()
+}
+
+func (w *workbook) Append(area string, rows [][]any, overwrite bool) error {
+	r, sheet, err := w.lookup(area)
+	if err != nil {
+		return err
+	}
+
+	values, err := w.Read(area)
+	if err != nil {
+		return err
+	}
+
+	top := r.top + len(values)
+
+	if !overwrite && top < len(sheet.rows) {
+		inserted := make([][]cell, len(rows))
+		sheet.rows = append(sheet.rows[:top], append(inserted, sheet.rows[top:]...)...)
+	}
+
+	for i, row := range rows {
+		for j, value := range row {
+			sheet.set(top+i, r.left+j, value)
+		}
+	}
+
+	return w.save()
+}
+
+func (w *workbook) Clear(areas ...string) error {
+	for _, a := range areas {
+		r, sheet, err := w.lookup(a)
+		if err != nil {
+			return err
+		}
+
+		for i := r.top; i <= r.bottom && i < len(sheet.rows); i++ {
+			for j := r.left; j <= r.right && j < len(sheet.rows[i]); j++ {
+				sheet.rows[i][j].value = ""
+				sheet.rows[i][j].numeric = false
+			}
+		}
+
+		sheet.dirty = true
+	}
+
+	return w.save()
+}
+
+func (w *workbook) DeleteRows(area string, rows ...rowRange) error {
+	_, sheet, err := w.lookup(area)
+	if err != nil {
+		return err
+	}
+
+	deleted := map[int]bool{}
+	for _, r := range rows {
+		end := int(r.end)
+		if end == 0 {
+			end = len(sheet.rows)
+		}
+
+		for i := int(r.start); i < end; i++ {
+			deleted[i] = true
+		}
+	}
+
+	list := [][]cell{}
+	for i, row := range sheet.rows {
+		if !deleted[i] {
+			list = append(list, row)
+		}
+	}
+
+	sheet.rows = list
+	sheet.dirty = true
+
+	return w.save()
+}
+
+func (w *workbook) RowCount(area string) (int64, error) {
+	_, sheet, err := w.lookup(area)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(sheet.rows)), nil
+}
+
+// Returns a pseudo-revision for the file, derived from the file contents and modification time.
+func (w *workbook) Revision() (*revision, error) {
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := os.ReadFile(w.file)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(bytes)
+
+	return &revision{
+		FileID:   w.ID(),
+		ID:       fmt.Sprintf("%x", hash[:8]),
+		Modified: info.ModTime().UTC(),
+	}, nil
+}
+
+// Local spreadsheet files don't have a time zone so the workbook time zone is the host time zone.
+func (w *workbook) TimeZone() (*time.Location, error) {
+	return time.Local, nil
+}
+
+func (w *workbook) Sheets() ([]string, error) {
+	names := []string{}
+	for _, sheet := range w.sheets {
+		names = append(names, sheet.name)
+	}
+
+	return names, nil
+}
+
+func (w *workbook) lookup(a string) (*area, *worksheet, error) {
+	r, err := parseArea(a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, sheet := range w.sheets {
+		if strings.EqualFold(strings.TrimSpace(sheet.name), strings.TrimSpace(r.sheet)) {
+			return r, sheet, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("unable to identify worksheet for '%s'", a)
+}
+
+func (w *workbook) load() error {
+	bytes, err := os.ReadFile(w.file)
+	if err != nil {
+		return err
+	}
+
+	return w.unzip(bytes)
+}
+
+func (w *workbook) unzip(b []byte) error {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	w.entries = []*zip.FileHeader{}
+	w.content = map[string][]byte{}
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+
+		header := f.FileHeader
+		w.entries = append(w.entries, &header)
+		w.content[f.Name] = b
+	}
+
+	if sheets, err := w.codec.decode(w.content); err != nil {
+		return err
+	} else {
+		w.sheets = sheets
+	}
+
+	return nil
+}
+
+func (w *workbook) save() error {
+	b, err := w.zip()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.file), "*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(b); err != nil {
+		return err
+	}
+
+	tmp.Close()
+
+	if err := lib.Rename(tmp.Name(), w.file); err != nil {
+		return err
+	}
+
+	for _, sheet := range w.sheets {
+		sheet.dirty = false
+	}
+
+	return nil
+}
+
+func (w *workbook) zip() ([]byte, error) {
+	if err := w.codec.encode(w.content, w.sheets); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	z := zip.NewWriter(&b)
+	for _, entry := range w.entries {
+		content, ok := w.content[entry.Name]
+		if !ok {
+			continue
+		}
+
+		header := zip.FileHeader{
+			Name:     entry.Name,
+			Method:   entry.Method,
+			Modified: entry.Modified,
+		}
+
+		if f, err := z.CreateHeader(&header); err != nil {
+			return nil, err
+		} else if _, err := f.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (s *worksheet) set(row, col int, value any) {
+	for len(s.rows) <= row {
+		s.rows = append(s.rows, []cell{})
+	}
+
+	for len(s.rows[row]) <= col {
+		s.rows[row] = append(s.rows[row], cell{})
+	}
+
+	c := s.rows[row][col]
+
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		c.value = fmt.Sprintf("%v", v)
+		c.numeric = true
+
+	case float32:
+		c.value = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		c.numeric = true
+
+	case float64:
+		c.value = strconv.FormatFloat(v, 'f', -1, 64)
+		c.numeric = true
+
+	case string:
+		// ... emulates the Google Sheets USER_ENTERED value input option
+		if strings.HasPrefix(v, "'") {
+			c.value = v[1:]
+			c.numeric = false
+		} else if numericValue.MatchString(v) {
+			c.value = v
+			c.numeric = true
+		} else {
+			c.value = v
+			c.numeric = false
+		}
+
+	default:
+		c.value = fmt.Sprintf("%v", v)
+		c.numeric = false
+	}
+
+	s.rows[row][col] = c
+	s.dirty = true
+}
+
+// Parses a spreadsheet range in A1 notation e.g. 'ACL!A2:K', 'Audit!A1:A1' or 'Log!A1:H100'. The
+// bottom row is unbounded if not specified.
+func parseArea(a string) (*area, error) {
+	match := a1Notation.FindStringSubmatch(a)
+	if len(match) < 6 {
+		return nil, fmt.Errorf("invalid spreadsheet range '%s'", a)
+	}
+
+	name := match[1]
+	if len(name) > 1 && strings.HasPrefix(name, "'") && strings.HasSuffix(name, "'") {
+		name = strings.ReplaceAll(name[1:len(name)-1], "''", "'")
+	}
+
+	top, _ := strconv.Atoi(match[3])
+	r := area{
+		sheet:  name,
+		top:    top - 1,
+		left:   column(match[2]),
+		bottom: top - 1,
+		right:  column(match[2]),
+	}
+
+	if match[4] != "" {
+		r.right = column(match[4])
+		r.bottom = 1<<31 - 1
+	}
+
+	if match[5] != "" {
+		bottom, _ := strconv.Atoi(match[5])
+		r.bottom = bottom - 1
+	}
+
+	if r.top < 0 || r.right < r.left || r.bottom < r.top {
+		return nil, fmt.Errorf("invalid spreadsheet range '%s'", a)
+	}
+
+	return &r, nil
+}
+
+// Converts a column letter to a zero-based index e.g. 'A' to 0, 'AB' to 27.
+func column(s string) int {
+	v := 0
+	for _, ch := range strings.ToUpper(s) {
+		v = 26*v + int(ch-'A'+1)
+	}
+
+	return v - 1
+}
+
+// Converts a zero-based column index to the column letters e.g. 0 to 'A', 27 to 'AB'.
+func columnName(ix int) string {
+	s := ""
+	for ix++; ix > 0; ix = (ix - 1) / 26 {
+		s = string(rune('A'+(ix-1)%26)) + s
+	}
+
+	return s
+}
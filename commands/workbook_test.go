@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="ACL" sheetId="1" r:id="rId1"/><sheet name="Log" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxStylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/></numFmts>
+<cellXfs count="2"><xf numFmtId="0"/><xf numFmtId="164" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`
+
+const xlsxSharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="6" uniqueCount="6">
+<si><t>Card Number</t></si><si><t>From</t></si><si><t>To</t></si><si><t>Great Hall</t></si><si><t>Y</t></si><si><r><t>Time</t></r><r><t>stamp</t></r></si>
+</sst>`
+
+const xlsxSheet1 = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><dimension ref="A1:D3"/><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>
+<row r="2"><c r="A2"><v>6001001</v></c><c r="B2" s="1"><v>43831</v></c><c r="C2" s="1"><v>44196</v></c><c r="D2" t="s"><v>4</v></c></row>
+<row r="3"><c r="A3"><v>6001002</v></c><c r="B3" s="1"><v>43864</v></c><c r="C3" s="1"><v>44165</v></c><c r="D3" t="inlineStr"><is><t>N</t></is></c></row>
+</sheetData></worksheet>`
+
+const xlsxSheet2 = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><dimension ref="A1"/><sheetData>
+<row r="1"><c r="A1" t="s"><v>5</v></c><c r="B1" t="inlineStr"><is><t>Device ID</t></is></c></row>
+</sheetData></worksheet>`
+
+const odsContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" office:version="1.2">
+<office:body><office:spreadsheet>
+<table:table table:name="ACL">
+<table:table-column table:number-columns-repeated="4"/>
+<table:table-row>
+<table:table-cell office:value-type="string"><text:p>Card Number</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>From</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>To</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Great<text:s/>Hall</text:p></table:table-cell>
+</table:table-row>
+<table:table-row>
+<table:table-cell office:value-type="float" office:value="6001001"><text:p>6,001,001</text:p></table:table-cell>
+<table:table-cell office:value-type="date" office:date-value="2020-01-01"><text:p>01/01/20</text:p></table:table-cell>
+<table:table-cell office:value-type="date" office:date-value="2020-12-31"><text:p>12/31/20</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Y</text:p></table:table-cell>
+</table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="4"/></table:table-row>
+<table:table-row>
+<table:table-cell office:value-type="float" office:value="6001002"><text:p>6001002</text:p></table:table-cell>
+<table:table-cell office:value-type="date" office:date-value="2020-02-03"><text:p>02/03/20</text:p></table:table-cell>
+<table:table-cell office:value-type="date" office:date-value="2020-11-30"><text:p>11/30/20</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>N</text:p><office:annotation><text:p>comment</text:p></office:annotation></table:table-cell>
+</table:table-row>
+<table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+<table:table table:name="Log">
+<table:table-column table:number-columns-repeated="2"/>
+<table:table-header-rows><table:table-row>
+<table:table-cell office:value-type="string"><text:p>Timestamp</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Device ID</text:p></table:table-cell>
+</table:table-row></table:table-header-rows>
+</table:table>
+</office:spreadsheet></office:body>
+</office:document-content>`
+
+func makeSpreadsheet(t *testing.T, file string, entries [][2]string) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("Error creating spreadsheet file (%v)", err)
+	}
+
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+	for _, e := range entries {
+		method := zip.Deflate
+		if e[0] == "mimetype" {
+			method = zip.Store
+		}
+
+		if w, err := z.CreateHeader(&zip.FileHeader{Name: e[0], Method: method}); err != nil {
+			t.Fatalf("Error creating spreadsheet file (%v)", err)
+		} else if _, err := w.Write([]byte(e[1])); err != nil {
+			t.Fatalf("Error creating spreadsheet file (%v)", err)
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		t.Fatalf("Error creating spreadsheet file (%v)", err)
+	}
+}
+
+func makeXLSX(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "site.xlsx")
+
+	makeSpreadsheet(t, file, [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStylesXML},
+		{"xl/sharedStrings.xml", xlsxSharedStringsXML},
+		{"xl/worksheets/sheet1.xml", xlsxSheet1},
+		{"xl/worksheets/sheet2.xml", xlsxSheet2},
+	})
+
+	return file
+}
+
+func makeODS(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "site.ods")
+
+	makeSpreadsheet(t, file, [][2]string{
+		{"mimetype", "application/vnd.oasis.opendocument.spreadsheet"},
+		{"content.xml", odsContent},
+	})
+
+	return file
+}
+
+func TestParseArea(t *testing.T) {
+	tests := map[string]area{
+		"ACL!A2:E":         {sheet: "ACL", top: 1, left: 0, bottom: 1<<31 - 1, right: 4},
+		"Audit!A1:A1":      {sheet: "Audit", top: 0, left: 0, bottom: 0, right: 0},
+		"Log!B3:AB100":     {sheet: "Log", top: 2, left: 1, bottom: 99, right: 27},
+		"'My Sheet'!C7":    {sheet: "My Sheet", top: 6, left: 2, bottom: 6, right: 2},
+		"'Bob''s'!$A$1:$D": {sheet: "Bob's", top: 0, left: 0, bottom: 1<<31 - 1, right: 3},
+	}
+
+	for a, expected := range tests {
+		r, err := parseArea(a)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing '%v' (%v)", a, err)
+		}
+
+		if !reflect.DeepEqual(*r, expected) {
+			t.Errorf("Incorrect area for '%v'\n   expected:%+v\n   got:     %+v", a, expected, *r)
+		}
+	}
+
+	for _, a := range []string{"ACL", "ACL!", "ACL!2:E", "ACL!E2:A"} {
+		if _, err := parseArea(a); err == nil {
+			t.Errorf("Expected error parsing invalid area '%v'", a)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for ix, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if name := columnName(ix); name != expected {
+			t.Errorf("Incorrect column name for %v - expected:%v, got:%v", ix, expected, name)
+		}
+
+		if c := column(expected); c != ix {
+			t.Errorf("Incorrect column index for %v - expected:%v, got:%v", expected, ix, c)
+		}
+	}
+}
+
+func TestWorkbookRead(t *testing.T) {
+	expected := [][]any{
+		[]any{"Card Number", "From", "To", "Great Hall"},
+		[]any{"6001001", "2020-01-01", "2020-12-31", "Y"},
+		[]any{},
+		[]any{},
+		[]any{"6001002", "2020-02-03", "2020-11-30", "N"},
+	}
+
+	for _, file := range []string{makeXLSX(t), makeODS(t)} {
+		w, err := newWorkbook(file)
+		if err != nil {
+			t.Fatalf("Error opening %v (%v)", file, err)
+		}
+
+		values, err := w.Read("ACL!A1:D")
+		if err != nil {
+			t.Fatalf("Error reading %v (%v)", file, err)
+		}
+
+		// ... the XLSX test file has no blank rows
+		if filepath.Ext(file) == ".xlsx" {
+			expected := [][]any{expected[0], expected[1], expected[4]}
+			if !reflect.DeepEqual(values, expected) {
+				t.Errorf("%v: incorrect values\n   expected:%v\n   got:     %v", file, expected, values)
+			}
+		} else if !reflect.DeepEqual(values, expected) {
+			t.Errorf("%v: incorrect values\n   expected:%v\n   got:     %v", file, expected, values)
+		}
+	}
+}
+
+func TestWorkbookUpdate(t *testing.T) {
+	for _, file := range []string{makeXLSX(t), makeODS(t)} {
+		w, err := newWorkbook(file)
+		if err != nil {
+			t.Fatalf("Error opening %v (%v)", file, err)
+		}
+
+		rows := [][]any{
+			[]any{"2023-01-01 12:34:56", "'405419896"},
+			[]any{"2023-01-02 12:34:56", 303986753},
+			[]any{"2023-01-03 12:34:56", "Tom & Jerry <3"},
+		}
+
+		if err := w.Append("Log!A1:H", rows, false); err != nil {
+			t.Fatalf("%v: error appending rows (%v)", file, err)
+		}
+
+		if err := w.DeleteRows("Log!A1:H", rowRange{start: 2, end: 3}); err != nil {
+			t.Fatalf("%v: error deleting rows (%v)", file, err)
+		}
+
+		if err := w.Write(valueRange{area: "ACL!D3", values: [][]any{[]any{"Y"}}}); err != nil {
+			t.Fatalf("%v: error writing values (%v)", file, err)
+		}
+
+		// ... reload and check
+		w, err = newWorkbook(file)
+		if err != nil {
+			t.Fatalf("Error reopening %v (%v)", file, err)
+		}
+
+		expected := [][]any{
+			[]any{"Timestamp", "Device ID"},
+			[]any{"2023-01-01 12:34:56", "405419896"},
+			[]any{"2023-01-03 12:34:56", "Tom & Jerry <3"},
+		}
+
+		if values, err := w.Read("Log!A1:H"); err != nil {
+			t.Fatalf("%v: error reading log (%v)", file, err)
+		} else if !reflect.DeepEqual(values, expected) {
+			t.Errorf("%v: incorrect log\n   expected:%v\n   got:     %v", file, expected, values)
+		}
+
+		if values, err := w.Read("ACL!A2:D2"); err != nil {
+			t.Fatalf("%v: error reading ACL (%v)", file, err)
+		} else if !reflect.DeepEqual(values, [][]any{[]any{"6001001", "2020-01-01", "2020-12-31", "Y"}}) {
+			t.Errorf("%v: incorrect ACL row %v", file, values)
+		}
+	}
+}
+
+func TestWorkbookWithUnknownSheet(t *testing.T) {
+	w, err := newWorkbook(makeXLSX(t))
+	if err != nil {
+		t.Fatalf("Error opening workbook (%v)", err)
+	}
+
+	if _, err := w.Read("Report!A1:E"); err == nil {
+		t.Errorf("Expected error reading unknown worksheet")
+	}
+}
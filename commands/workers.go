@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/types"
+	"github.com/uhppoted/uhppote-core/uhppote"
+	lib "github.com/uhppoted/uhppoted-lib/acl"
+)
+
+// Bounded pool of per-controller workers for accessing a set of controllers concurrently, so that a slow
+// or offline controller neither stalls nor fails the operation for the other controllers.
+type workers struct {
+	concurrency int           // maximum number of controllers in progress (0 for no limit)
+	timeout     time.Duration // maximum time for each controller, including retries (0 for no limit)
+	retries     int           // number of retries after a controller error
+}
+
+// Controllers with a request in progress, including requests abandoned after a timeout (which cannot be
+// cancelled and run to completion in the background), so that a controller is never sent a request while
+// an earlier request (e.g. from a previous 'run' update) is still in progress.
+var inflight = struct {
+	sync.Mutex
+	controllers map[uint32]bool
+}{
+	controllers: map[uint32]bool{},
+}
+
+// Adds the controller access options to a flagset.
+func (w *workers) flags(flagset *flag.FlagSet) {
+	flagset.IntVar(&w.concurrency, "concurrency", w.concurrency, "Maximum number of controllers accessed concurrently (0 for no limit)")
+	flagset.DurationVar(&w.timeout, "controller-timeout", w.timeout, "Time allowed for each controller (including retries) before it is regarded as unavailable (0 for no limit)")
+	flagset.IntVar(&w.retries, "retries", w.retries, "Number of times a controller request is retried after an error")
+}
+
+func (w workers) validate() error {
+	if w.concurrency < 0 {
+		return fmt.Errorf("invalid --concurrency '%v' - expected a number of controllers", w.concurrency)
+	}
+
+	if w.timeout < 0 {
+		return fmt.Errorf("invalid --controller-timeout '%v' - expected a positive duration", w.timeout)
+	}
+
+	if w.retries < 0 {
+		return fmt.Errorf("invalid --retries '%v' - expected a number of retries", w.retries)
+	}
+
+	return nil
+}
+
+// Retrieves the cards from each controller. Returns the ACL for the controllers that responded and the
+// error for each controller that did not.
+func (w workers) getACL(ctx context.Context, u uhppote.IUHPPOTE, devices []uhppote.Device) (lib.ACL, map[uint32]error) {
+	index := map[uint32]uhppote.Device{}
+	for _, d := range devices {
+		index[d.DeviceID] = d
+	}
+
+	f := func(deviceID uint32) (map[uint32]types.Card, error) {
+		acl, errs := lib.GetACL(u, []uhppote.Device{index[deviceID]})
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		return acl[deviceID], nil
+	}
+
+	acl, errs := dispatch(ctx, w, slices.Collect(maps.Keys(index)), f)
+
+	return lib.ACL(acl), errs
+}
+
+// Updates the cards on each controller in the ACL. Returns the report for the controllers that were
+// updated and the error for each controller that could not be updated.
+func (w workers) putACL(ctx context.Context, u uhppote.IUHPPOTE, acl lib.ACL, withPIN bool, dryrun bool) (map[uint32]lib.Report, map[uint32]error) {
+	f := func(deviceID uint32) (lib.Report, error) {
+		put := lib.PutACL
+		if withPIN {
+			put = lib.PutACLWithPIN
+		}
+
+		rpt, errs := put(u, lib.ACL{deviceID: acl[deviceID]}, dryrun)
+		if len(errs) > 0 {
+			return lib.Report{}, errors.Join(errs...)
+		}
+
+		return rpt[deviceID], nil
+	}
+
+	return dispatch(ctx, w, slices.Collect(maps.Keys(acl)), f)
+}
+
+// Invokes f for each controller in turn, in the order listed. A controller still in progress when the
+// context is cancelled is abandoned and the remaining controllers are skipped, failing with the context
+// error. f must not update any shared state since an abandoned call may still complete in the background.
+func forEach[T any](ctx context.Context, devices []uhppote.Device, f func(uhppote.Device) (T, error)) (map[uint32]T, map[uint32]error) {
+	index := map[uint32]uhppote.Device{}
+	controllers := []uint32{}
+	for _, d := range devices {
+		index[d.DeviceID] = d
+		controllers = append(controllers, d.DeviceID)
+	}
+
+	return dispatch(ctx, workers{concurrency: 1}, controllers, func(deviceID uint32) (T, error) {
+		return f(index[deviceID])
+	})
+}
+
+// Invokes f for each controller, with at most 'concurrency' controllers in progress at any one time.
+// A controller that returns an error is retried up to 'retries' times and a controller that has not
+// completed within the 'timeout' is abandoned (the underlying request cannot be cancelled but its
+// result is discarded and the controller is not retried until the request has completed). Controllers
+// still in progress (or not yet started) when the context is cancelled fail with the context error.
+// Returns the results for the controllers that succeeded and the last error for each controller that
+// failed.
+func dispatch[T any](ctx context.Context, w workers, controllers []uint32, f func(uint32) (T, error)) (map[uint32]T, map[uint32]error) {
+	results := map[uint32]T{}
+	failed := map[uint32]error{}
+
+	var guard sync.Mutex
+	var wg sync.WaitGroup
+
+	limit := len(controllers)
+	if w.concurrency > 0 && w.concurrency < limit {
+		limit = w.concurrency
+	}
+
+	queue := make(chan uint32, len(controllers))
+	for _, id := range controllers {
+		queue <- id
+	}
+
+	close(queue)
+
+	for range limit {
+		wg.Go(func() {
+			for id := range queue {
+				v, err := invoke(ctx, w, id, f)
+
+				guard.Lock()
+				if err != nil {
+					failed[id] = err
+				} else {
+					results[id] = v
+				}
+				guard.Unlock()
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return results, failed
+}
+
+// Invokes f for a single controller, retrying on error until either the call succeeds, the retries
+// are exhausted, the timeout expires or the context is cancelled. Fails immediately if a previous
+// (abandoned) request to the controller is still in progress.
+func invoke[T any](ctx context.Context, w workers, deviceID uint32, f func(uint32) (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	if err := ctx.Err(); err != nil {
+		var v T
+		return v, context.Cause(ctx)
+	}
+
+	if !startRequest(deviceID) {
+		var v T
+		return v, fmt.Errorf("previous request still in progress")
+	}
+
+	done := make(chan result, 1)
+	abandoned := make(chan struct{})
+
+	go func() {
+		defer finishRequest(deviceID)
+
+		var v T
+		var err error
+
+		for attempt := 0; attempt <= w.retries; attempt++ {
+			select {
+			case <-abandoned:
+				return
+			default:
+			}
+
+			if attempt > 0 {
+				warnf("%v  retrying (%v)", deviceID, err)
+			}
+
+			if v, err = f(deviceID); err == nil {
+				break
+			}
+		}
+
+		done <- result{v, err}
+	}()
+
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+
+	case <-timeout:
+		close(abandoned)
+
+		var v T
+		return v, fmt.Errorf("no response within %v", w.timeout)
+
+	case <-ctx.Done():
+		close(abandoned)
+
+		var v T
+		return v, context.Cause(ctx)
+	}
+}
+
+// Marks a controller as having a request in progress. Returns false if the controller already has a
+// request in progress.
+func startRequest(deviceID uint32) bool {
+	inflight.Lock()
+	defer inflight.Unlock()
+
+	if inflight.controllers[deviceID] {
+		return false
+	}
+
+	inflight.controllers[deviceID] = true
+
+	return true
+}
+
+// Clears the 'request in progress' mark for a controller.
+func finishRequest(deviceID uint32) {
+	inflight.Lock()
+	defer inflight.Unlock()
+
+	delete(inflight.controllers, deviceID)
+}
+
+// Formats a set of per-controller errors as e.g. '303986753: no response within 5m0s'.
+func joinErrors(errs map[uint32]error) string {
+	list := []string{}
+	for _, k := range slices.Sorted(maps.Keys(errs)) {
+		list = append(list, fmt.Sprintf("%v: %v", k, errs[k]))
+	}
+
+	return strings.Join(list, "; ")
+}
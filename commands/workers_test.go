@@ -0,0 +1,235 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppote-core/uhppote"
+)
+
+func TestDispatch(t *testing.T) {
+	w := workers{concurrency: 2}
+
+	f := func(deviceID uint32) (uint32, error) {
+		if deviceID == 303986753 {
+			return 0, fmt.Errorf("offline")
+		}
+
+		return deviceID + 1, nil
+	}
+
+	results, failed := dispatch(context.Background(), w, []uint32{201020304, 303986753, 405419896}, f)
+
+	expected := map[uint32]uint32{201020304: 201020305, 405419896: 405419897}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Incorrect results\n   expected:%v\n   got:     %v", expected, results)
+	}
+
+	if len(failed) != 1 || failed[303986753] == nil {
+		t.Errorf("Incorrect failed controllers %v", failed)
+	}
+}
+
+func TestDispatchWithConcurrency(t *testing.T) {
+	w := workers{concurrency: 2}
+
+	var active atomic.Int32
+	var peak atomic.Int32
+
+	f := func(deviceID uint32) (uint32, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+
+		for {
+			if p := peak.Load(); n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		return deviceID, nil
+	}
+
+	results, _ := dispatch(context.Background(), w, []uint32{1, 2, 3, 4, 5, 6}, f)
+
+	if len(results) != 6 {
+		t.Errorf("Incorrect number of results - expected:%v, got:%v", 6, len(results))
+	}
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Exceeded concurrency limit - expected:%v, got:%v", 2, p)
+	}
+}
+
+func TestDispatchWithRetries(t *testing.T) {
+	w := workers{retries: 2}
+
+	var guard sync.Mutex
+	attempts := map[uint32]int{}
+
+	f := func(deviceID uint32) (uint32, error) {
+		guard.Lock()
+		defer guard.Unlock()
+
+		attempts[deviceID]++
+		if deviceID == 405419896 && attempts[deviceID] < 3 {
+			return 0, fmt.Errorf("timeout")
+		} else if deviceID == 303986753 {
+			return 0, fmt.Errorf("offline")
+		}
+
+		return deviceID, nil
+	}
+
+	results, failed := dispatch(context.Background(), w, []uint32{303986753, 405419896}, f)
+
+	if _, ok := results[405419896]; !ok {
+		t.Errorf("Expected result for retried controller %v", 405419896)
+	}
+
+	if _, ok := failed[303986753]; !ok {
+		t.Errorf("Expected failure for offline controller %v", 303986753)
+	}
+
+	expected := map[uint32]int{303986753: 3, 405419896: 3}
+	if !reflect.DeepEqual(attempts, expected) {
+		t.Errorf("Incorrect attempts\n   expected:%v\n   got:     %v", expected, attempts)
+	}
+}
+
+// The abandoned request keeps the controller busy after the test completes, so the slow controller ID is
+// not used by any other test.
+func TestDispatchWithTimeout(t *testing.T) {
+	w := workers{timeout: 50 * time.Millisecond}
+
+	f := func(deviceID uint32) (uint32, error) {
+		if deviceID == 100000001 {
+			time.Sleep(time.Second)
+		}
+
+		return deviceID, nil
+	}
+
+	start := time.Now()
+	results, failed := dispatch(context.Background(), w, []uint32{100000001, 405419896}, f)
+
+	if dt := time.Since(start); dt > 500*time.Millisecond {
+		t.Errorf("Slow controller was not abandoned after timeout (%v)", dt)
+	}
+
+	if _, ok := results[405419896]; !ok {
+		t.Errorf("Expected result for controller %v", 405419896)
+	}
+
+	if _, ok := failed[100000001]; !ok {
+		t.Errorf("Expected timeout for controller %v", 100000001)
+	}
+}
+
+func TestDispatchWithCancel(t *testing.T) {
+	w := workers{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := func(deviceID uint32) (uint32, error) {
+		if deviceID == 100000002 {
+			cancel()
+			time.Sleep(time.Second)
+		}
+
+		return deviceID, nil
+	}
+
+	start := time.Now()
+	_, failed := dispatch(ctx, w, []uint32{100000002}, f)
+
+	if dt := time.Since(start); dt > 500*time.Millisecond {
+		t.Errorf("Controller was not abandoned on cancel (%v)", dt)
+	}
+
+	if err := failed[100000002]; err != context.Canceled {
+		t.Errorf("Incorrect error - expected:%v, got:%v", context.Canceled, err)
+	}
+}
+
+func TestDispatchWithAbandonedRequest(t *testing.T) {
+	w := workers{timeout: 50 * time.Millisecond, retries: 2}
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	f := func(deviceID uint32) (uint32, error) {
+		calls.Add(1)
+		<-release
+
+		return deviceID, nil
+	}
+
+	if _, failed := dispatch(context.Background(), w, []uint32{100000003}, f); failed[100000003] == nil {
+		t.Fatalf("Expected timeout for controller %v", 100000003)
+	}
+
+	// ... abandoned request still in progress
+	if _, failed := dispatch(context.Background(), w, []uint32{100000003}, f); failed[100000003] == nil {
+		t.Errorf("Expected error for controller with request in progress")
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Controller invoked while request in progress - expected %v calls, got %v", 1, n)
+	}
+
+	close(release)
+
+	if !eventually(func() bool {
+		_, failed := dispatch(context.Background(), w, []uint32{100000003}, f)
+		return len(failed) == 0
+	}) {
+		t.Errorf("Controller still busy after abandoned request completed")
+	}
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Abandoned request retried - expected %v calls, got %v", 2, n)
+	}
+}
+
+// The abandoned request keeps the controller busy after the test completes, so the controller IDs are not
+// used by any other test.
+func TestForEachWithCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	devices := []uhppote.Device{
+		uhppote.Device{DeviceID: 100000004},
+		uhppote.Device{DeviceID: 100000005},
+		uhppote.Device{DeviceID: 100000006},
+	}
+
+	f := func(d uhppote.Device) (uint32, error) {
+		if d.DeviceID == 100000005 {
+			cancel()
+			time.Sleep(time.Second)
+		}
+
+		return d.DeviceID, nil
+	}
+
+	start := time.Now()
+	results, failed := forEach(ctx, devices, f)
+
+	if dt := time.Since(start); dt > 500*time.Millisecond {
+		t.Errorf("Controller was not abandoned on cancel (%v)", dt)
+	}
+
+	expected := map[uint32]uint32{100000004: 100000004}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Incorrect results\n   expected:%v\n   got:     %v", expected, results)
+	}
+
+	for _, id := range []uint32{100000005, 100000006} {
+		if err := failed[id]; err != context.Canceled {
+			t.Errorf("%v: incorrect error - expected:%v, got:%v", id, context.Canceled, err)
+		}
+	}
+}
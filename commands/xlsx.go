@@ -0,0 +1,417 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codec for Office Open XML (.xlsx) spreadsheets. Modified worksheets are written with inline
+// strings so that the shared strings table remains valid for the unmodified worksheets.
+type xlsx struct {
+	files    map[string]string
+	dates    map[string]bool
+	date1904 bool
+}
+
+type xlsxWorkbook struct {
+	WorkbookPr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSharedStrings struct {
+	SI []xlsxText `xml:"si"`
+}
+
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string   `xml:"r,attr"`
+			S  string   `xml:"s,attr"`
+			T  string   `xml:"t,attr"`
+			V  string   `xml:"v"`
+			IS xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+
+	var s strings.Builder
+	for _, r := range t.R {
+		s.WriteString(r.T)
+	}
+
+	return s.String()
+}
+
+func (x *xlsx) decode(content map[string][]byte) ([]*worksheet, error) {
+	var wb xlsxWorkbook
+	var rels xlsxRelationships
+
+	if b, ok := content["xl/workbook.xml"]; !ok {
+		return nil, fmt.Errorf("missing workbook")
+	} else if err := xml.Unmarshal(b, &wb); err != nil {
+		return nil, err
+	}
+
+	if b, ok := content["xl/_rels/workbook.xml.rels"]; !ok {
+		return nil, fmt.Errorf("missing workbook relationships")
+	} else if err := xml.Unmarshal(b, &rels); err != nil {
+		return nil, err
+	}
+
+	x.files = map[string]string{}
+	x.dates = map[string]bool{}
+	x.date1904 = wb.WorkbookPr.Date1904 == "1" || wb.WorkbookPr.Date1904 == "true"
+
+	if err := x.decodeStyles(content); err != nil {
+		return nil, err
+	}
+
+	shared, err := x.decodeSharedStrings(content)
+	if err != nil {
+		return nil, err
+	}
+
+	sheets := []*worksheet{}
+	for _, s := range wb.Sheets {
+		file := ""
+		for _, r := range rels.Relationships {
+			if r.ID == s.RID {
+				if strings.HasPrefix(r.Target, "/") {
+					file = strings.TrimPrefix(r.Target, "/")
+				} else {
+					file = path.Join("xl", r.Target)
+				}
+			}
+		}
+
+		b, ok := content[file]
+		if !ok {
+			return nil, fmt.Errorf("missing worksheet '%v'", s.Name)
+		}
+
+		rows, err := x.decodeSheet(b, shared)
+		if err != nil {
+			return nil, fmt.Errorf("worksheet '%v' (%w)", s.Name, err)
+		}
+
+		x.files[s.Name] = file
+		sheets = append(sheets, &worksheet{
+			name: s.Name,
+			rows: rows,
+		})
+	}
+
+	return sheets, nil
+}
+
+func (x *xlsx) decodeStyles(content map[string][]byte) error {
+	b, ok := content["xl/styles.xml"]
+	if !ok {
+		return nil
+	}
+
+	var styles xlsxStyles
+	if err := xml.Unmarshal(b, &styles); err != nil {
+		return err
+	}
+
+	// ... built-in date/time formats
+	formats := map[int]bool{}
+	for _, id := range []int{14, 15, 16, 17, 18, 19, 20, 21, 22, 45, 46, 47} {
+		formats[id] = true
+	}
+
+	for _, f := range styles.NumFmts {
+		code := regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`).ReplaceAllString(f.Code, "")
+		formats[f.ID] = regexp.MustCompile(`[dDmMyYhHsS]`).MatchString(code)
+	}
+
+	for i, xf := range styles.CellXfs {
+		if formats[xf.NumFmtID] {
+			x.dates[fmt.Sprintf("%v", i)] = true
+		}
+	}
+
+	return nil
+}
+
+func (x *xlsx) decodeSharedStrings(content map[string][]byte) ([]string, error) {
+	b, ok := content["xl/sharedStrings.xml"]
+	if !ok {
+		return []string{}, nil
+	}
+
+	var sst xlsxSharedStrings
+	if err := xml.Unmarshal(b, &sst); err != nil {
+		return nil, err
+	}
+
+	shared := []string{}
+	for _, si := range sst.SI {
+		shared = append(shared, si.String())
+	}
+
+	return shared, nil
+}
+
+func (x *xlsx) decodeSheet(b []byte, shared []string) ([][]cell, error) {
+	var ws xlsxWorksheet
+	if err := xml.Unmarshal(b, &ws); err != nil {
+		return nil, err
+	}
+
+	rows := [][]cell{}
+	re := regexp.MustCompile(`^([A-Za-z]+)([0-9]+)$`)
+
+	for _, r := range ws.Rows {
+		row := len(rows)
+		if r.R > 0 {
+			row = r.R - 1
+		}
+
+		for len(rows) <= row {
+			rows = append(rows, []cell{})
+		}
+
+		for _, c := range r.Cells {
+			col := len(rows[row])
+			if match := re.FindStringSubmatch(c.R); len(match) == 3 {
+				col = column(match[1])
+			}
+
+			for len(rows[row]) <= col {
+				rows[row] = append(rows[row], cell{})
+			}
+
+			v := cell{
+				style: c.S,
+			}
+
+			switch c.T {
+			case "s":
+				if ix, err := strconv.Atoi(c.V); err != nil || ix < 0 || ix >= len(shared) {
+					return nil, fmt.Errorf("invalid shared string reference '%v' in cell %v", c.V, c.R)
+				} else {
+					v.value = shared[ix]
+				}
+
+			case "inlineStr":
+				v.value = c.IS.String()
+
+			case "b":
+				if c.V == "1" {
+					v.value = "TRUE"
+				} else {
+					v.value = "FALSE"
+				}
+
+			case "str", "e":
+				v.value = c.V
+
+			default:
+				v.value = c.V
+				v.numeric = c.V != ""
+
+				if f, err := strconv.ParseFloat(c.V, 64); err == nil && x.dates[c.S] {
+					v.value = x.datetime(f)
+					v.numeric = false
+				}
+			}
+
+			rows[row][col] = v
+		}
+	}
+
+	return rows, nil
+}
+
+// Converts an Excel serial date to 'yyyy-mm-dd' or 'yyyy-mm-dd HH:mm:ss'.
+func (x *xlsx) datetime(serial float64) string {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	if x.date1904 {
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	days, fraction := math.Modf(serial)
+	seconds := math.Round(fraction * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	if seconds == 0 {
+		return t.Format("2006-01-02")
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// Converts a 'yyyy-mm-dd' or 'yyyy-mm-dd HH:mm:ss' date to an Excel serial date.
+func (x *xlsx) serial(v string) string {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	if x.date1904 {
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+			return strconv.FormatFloat(t.Sub(epoch).Hours()/24, 'f', -1, 64)
+		}
+	}
+
+	return ""
+}
+
+func (x *xlsx) encode(content map[string][]byte, sheets []*worksheet) error {
+	dirty := false
+
+	for _, sheet := range sheets {
+		if !sheet.dirty {
+			continue
+		}
+
+		file, ok := x.files[sheet.name]
+		if !ok {
+			return fmt.Errorf("unknown worksheet '%v'", sheet.name)
+		}
+
+		b := content[file]
+		data := x.encodeSheet(sheet)
+
+		re := regexp.MustCompile(`(?s)<sheetData\s*/>|<sheetData[^>]*>.*</sheetData>`)
+		if !re.Match(b) {
+			return fmt.Errorf("worksheet '%v' has no sheet data", sheet.name)
+		}
+
+		b = re.ReplaceAllLiteral(b, data)
+		b = regexp.MustCompile(`<dimension\s[^>]*/>`).ReplaceAllLiteral(b, []byte(x.dimension(sheet)))
+
+		content[file] = b
+		dirty = true
+	}
+
+	// ... discard the calculation chain (if any) - it is rebuilt by Excel when the workbook is opened
+	if dirty {
+		if _, ok := content["xl/calcChain.xml"]; ok {
+			delete(content, "xl/calcChain.xml")
+
+			if b, ok := content["[Content_Types].xml"]; ok {
+				content["[Content_Types].xml"] = regexp.MustCompile(`<Override[^>]*PartName="/xl/calcChain.xml"[^>]*/>`).ReplaceAll(b, nil)
+			}
+
+			if b, ok := content["xl/_rels/workbook.xml.rels"]; ok {
+				content["xl/_rels/workbook.xml.rels"] = regexp.MustCompile(`<Relationship[^>]*Target="(?:/xl/)?calcChain.xml"[^>]*/>`).ReplaceAll(b, nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (x *xlsx) encodeSheet(sheet *worksheet) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("<sheetData>")
+	for i, row := range sheet.rows {
+		empty := true
+		for _, c := range row {
+			if c.value != "" || c.style != "" {
+				empty = false
+			}
+		}
+
+		if empty {
+			continue
+		}
+
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row {
+			if c.value == "" && c.style == "" {
+				continue
+			}
+
+			ref := fmt.Sprintf("%v%d", columnName(j), i+1)
+			style := ""
+			if c.style != "" {
+				style = fmt.Sprintf(` s="%v"`, c.style)
+			}
+
+			switch {
+			case c.value == "":
+				fmt.Fprintf(&b, `<c r="%v"%v/>`, ref, style)
+
+			case c.numeric:
+				fmt.Fprintf(&b, `<c r="%v"%v><v>%v</v></c>`, ref, style, c.value)
+
+			case x.dates[c.style] && x.serial(c.value) != "":
+				fmt.Fprintf(&b, `<c r="%v"%v><v>%v</v></c>`, ref, style, x.serial(c.value))
+
+			default:
+				fmt.Fprintf(&b, `<c r="%v"%v t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+				xml.EscapeText(&b, []byte(c.value))
+				b.WriteString(`</t></is></c>`)
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData>")
+
+	return b.Bytes()
+}
+
+func (x *xlsx) dimension(sheet *worksheet) string {
+	rows := 0
+	cols := 0
+	for i, row := range sheet.rows {
+		if len(row) > 0 {
+			rows = i + 1
+		}
+
+		cols = max(cols, len(row))
+	}
+
+	if rows == 0 || cols == 0 {
+		return `<dimension ref="A1"/>`
+	}
+
+	return fmt.Sprintf(`<dimension ref="A1:%v%d"/>`, columnName(cols-1), rows)
+}
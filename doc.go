@@ -11,9 +11,20 @@ the cards and permissions on a set of access controllers from a unified access c
 uhppoted-app-s3 supports the following commands:
 
   - authorise, to authorise application access to the Google Sheets worksheet
+  - tokens, to re-encrypt the stored authorisation tokens with a new key
+  - check-auth, to verify the Google Sheets and Google Drive authorisation
   - load-acl, to download an ACL from a Google Sheets worksheet to a set of access controllers
+  - run, to update a set of access controllers from a Google Sheets worksheet whenever the worksheet is revised
+  - rollback, to restore the cards on a set of access controllers from a snapshot saved by load-acl
   - upload-acl, to retrieve the ACL from a set of controllers and write it to a Google Sheets worksheet
   - compare-acl, to compare an ACL from a Google Sheets worksheet with the cards and permissons on a set of access controllers
+  - get-events, to append the events from a set of access controllers to a Google Sheets worksheet
+  - set-time-profiles, to update the time profiles on a set of access controllers from a Google Sheets worksheet
+  - set-holidays, to program the public holidays from a Google Sheets worksheet on a set of access controllers
+  - load-doors, to update the door settings on a set of access controllers from a Google Sheets worksheet
+  - upload-doors, to upload the door settings from a set of access controllers to a Google Sheets worksheet
+  - status, to write a status dashboard for a set of access controllers to a Google Sheets worksheet
+  - set-time, to synchronise the clocks of a set of access controllers with the host or spreadsheet time
   - get, to download a Google Sheets worksheet as a TSV file
   - put, to store a TSV file to a Google Sheets worksheet
 */